@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+type apiSearchResponse struct {
+	Query string `json:"query"`
+	Count int    `json:"count"`
+
+	booksdb.SearchResults
+}
+
+type apiLibrariesResponse struct {
+	SavedSearches    []booksdb.NamedSearch `json:"saved_searches"`
+	VirtualLibraries []booksdb.NamedSearch `json:"virtual_libraries"`
+}
+
+type apiErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJson(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	value any,
+) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		booksdb.Logger(r.Context()).Error("json encoding error", "error", err)
+	}
+}
+
+// apiQuery combines the free-form q parameter with any number of filter
+// parameters, each a single field:value term such as #read:yes.
+func apiQuery(r *http.Request) string {
+	if err := r.ParseForm(); err != nil {
+		return r.FormValue("q")
+	}
+
+	return strings.Join(append([]string{r.Form.Get("q")}, r.Form["filter"]...), " ")
+}
+
+// apiScope returns the virtual library named by the library parameter,
+// within what the user may see. API clients pass it explicitly instead of
+// relying on the page cookie.
+func apiScope(
+	entries *booksdb.BookEntries,
+	w http.ResponseWriter,
+	r *http.Request,
+) (booksdb.Scope, bool) {
+	scope, err := entries.LibraryScope(r.FormValue("library"), r.Context())
+	if err != nil {
+		writeJson(
+			w,
+			r,
+			http.StatusBadRequest,
+			apiErrorResponse{Error: err.Error()},
+		)
+
+		return scope, false
+	}
+
+	return scope, true
+}
+
+func createApiSearchHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := strings.TrimSpace(apiQuery(r))
+		entries := booksdb.GetBooksEntries()
+
+		scope, ok := apiScope(entries, w, r)
+		if !ok {
+			return
+		}
+
+		content, _ := strconv.ParseBool(r.FormValue("content"))
+
+		results, err := searchBooks(entries, query, r.Context(), booksdb.SearchOptions{
+			Scope:   scope,
+			Syntax:  booksdb.NewQuerySyntax(r.FormValue("syntax")),
+			Saved:   r.FormValue("saved"),
+			Content: content,
+		})
+		if err != nil {
+			writeJson(
+				w,
+				r,
+				http.StatusBadRequest,
+				apiErrorResponse{Error: err.Error()},
+			)
+
+			return
+		}
+
+		writeJson(w, r, http.StatusOK, apiSearchResponse{
+			Query:         query,
+			Count:         len(results.Books),
+			SearchResults: results,
+		})
+	}
+}
+
+func createApiBookHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookId, ok := parseBookId(r)
+		if !ok {
+			writeJson(
+				w,
+				r,
+				http.StatusBadRequest,
+				apiErrorResponse{Error: "invalid book id"},
+			)
+
+			return
+		}
+
+		entries := booksdb.GetBooksEntries()
+
+		scope, ok := apiScope(entries, w, r)
+		if !ok {
+			return
+		}
+
+		details, found := entries.Details(bookId, scope)
+		if !found {
+			writeJson(
+				w,
+				r,
+				http.StatusNotFound,
+				apiErrorResponse{Error: "book not found"},
+			)
+
+			return
+		}
+
+		writeJson(w, r, http.StatusOK, details)
+	}
+}
+
+func createApiCustomColumnsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJson(
+			w,
+			r,
+			http.StatusOK,
+			booksdb.GetBooksEntries().CustomColumns(),
+		)
+	}
+}
+
+func createApiLibrariesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries := booksdb.GetBooksEntries()
+		visible, _ := entries.LibraryScope("", r.Context())
+
+		writeJson(w, r, http.StatusOK, apiLibrariesResponse{
+			SavedSearches: entries.CountIn(
+				entries.SavedSearches(r.Context()),
+				visible,
+			),
+			VirtualLibraries: entries.CountIn(
+				entries.VirtualLibraries(r.Context()),
+				visible,
+			),
+		})
+	}
+}
+
+// apiContentIndexResponse tells whether book contents can be searched and,
+// when the browser indexes EPUBs itself, how far it has got.
+type apiContentIndexResponse struct {
+	Available bool                   `json:"available"`
+	Progress  *booksdb.IndexProgress `json:"progress,omitempty"`
+}
+
+func createApiContentIndexHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries := booksdb.GetBooksEntries()
+		response := apiContentIndexResponse{Available: entries.HasContent()}
+
+		if progress, found := entries.ContentProgress(); found {
+			response.Progress = &progress
+		}
+
+		writeJson(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	assetsPrefix = "/static/"
+	// fingerprintLength is how many hex digits of the content hash asset
+	// URLs carry.
+	fingerprintLength = 12
+	immutableCache    = "public, max-age=31536000, immutable"
+)
+
+// requiredAssets are vendored assets pages cannot work without, checked
+// for as a build from an incomplete checkout would still compile.
+var requiredAssets = []string{"htmx.min.js"}
+
+var errMissingAsset = errors.New("missing static file")
+
+// asset is a static file with its fingerprinted name, strong ETag and,
+// when it makes the file smaller, its gzip variant.
+type asset struct {
+	name        string
+	fingerprint string
+	data        []byte
+	gzipped     []byte
+	etag        string
+}
+
+// fingerprinted returns the name of the asset with its content hash before
+// the extension, e.g. "styles.3f2a9c1b04de.css".
+func (a *asset) fingerprinted() string {
+	ext := path.Ext(a.name)
+
+	return strings.TrimSuffix(a.name, ext) + "." + a.fingerprint + ext
+}
+
+// assetSet serves static files under fingerprinted names, which change
+// with their content, so browsers may cache them for good.
+type assetSet struct {
+	byName        map[string]*asset
+	byFingerprint map[string]*asset
+}
+
+func newAssetSet(files fs.FS) (*assetSet, error) {
+	set := &assetSet{
+		byName:        make(map[string]*asset),
+		byFingerprint: make(map[string]*asset),
+	}
+
+	err := fs.WalkDir(files, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		a := &asset{
+			name:        name,
+			fingerprint: hex.EncodeToString(sum[:])[:fingerprintLength],
+			data:        data,
+			etag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+		}
+
+		if a.gzipped, err = compress(data); err != nil {
+			return fmt.Errorf("error compressing %q: %w", name, err)
+		}
+
+		set.byName[name] = a
+		set.byFingerprint[a.fingerprinted()] = a
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading static files: %w", err)
+	}
+
+	for _, name := range requiredAssets {
+		if _, found := set.byName[name]; !found {
+			return nil, fmt.Errorf("%w %q", errMissingAsset, name)
+		}
+	}
+
+	return set, nil
+}
+
+// compress returns the gzip variant of data, or nil when it is no smaller.
+func compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	writer, err := gzip.NewWriterLevel(&buffer, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	if buffer.Len() >= len(data) {
+		return nil, nil
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// url returns the fingerprinted URL of a static file. Files the set lacks
+// keep their plain URL, so a missing file shows up as a 404 in the browser
+// rather than breaking the whole page.
+func (s *assetSet) url(name string) string {
+	if a, found := s.byName[name]; found {
+		return assetsPrefix + a.fingerprinted()
+	}
+
+	return assetsPrefix + name
+}
+
+// ServeHTTP serves assets by fingerprinted name for good, and by plain name
+// for clients holding old URLs, which must revalidate.
+func (s *assetSet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, assetsPrefix)
+
+	a, found := s.byFingerprint[name]
+	cacheControl := immutableCache
+
+	if !found {
+		a, found = s.byName[name]
+		cacheControl = "no-cache"
+	}
+
+	if !found {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	header := w.Header()
+	header.Set("Cache-Control", cacheControl)
+	header.Set("Content-Type", contentType(a.name))
+
+	content, etag := a.data, a.etag
+
+	if a.gzipped != nil {
+		header.Add("Vary", "Accept-Encoding")
+
+		if acceptsGzip(r) {
+			// Each encoding is a representation of its own.
+			content, etag = a.gzipped, strings.TrimSuffix(a.etag, `"`)+`-gzip"`
+			header.Set("Content-Encoding", "gzip")
+		}
+	}
+
+	header.Set("ETag", etag)
+
+	http.ServeContent(w, r, a.name, time.Time{}, bytes.NewReader(content))
+}
+
+func contentType(name string) string {
+	if kind := mime.TypeByExtension(path.Ext(name)); kind != "" {
+		return kind
+	}
+
+	return "application/octet-stream"
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r lists gzip
+// without refusing it with q=0.
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+
+		value, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !found {
+			return true
+		}
+
+		quality, err := strconv.ParseFloat(value, 64)
+
+		return err == nil && quality > 0
+	}
+
+	return false
+}
+
+// staticAssets are the embedded static files, read once.
+var staticAssets = sync.OnceValues(func() (*assetSet, error) {
+	files, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return nil, err
+	}
+
+	return newAssetSet(files)
+})
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testStyles = strings.Repeat("body { color: black; }\n", 100)
+
+func newTestAssets(t *testing.T) *assetSet {
+	t.Helper()
+
+	assets, err := newAssetSet(fstest.MapFS{
+		"styles.css":  {Data: []byte(testStyles)},
+		"htmx.min.js": {Data: []byte("x")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return assets
+}
+
+func serveAsset(assets *assetSet, url string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+
+	w := httptest.NewRecorder()
+	assets.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestAssetUrl(t *testing.T) {
+	assets := newTestAssets(t)
+
+	url := assets.url("styles.css")
+	if !regexp.MustCompile(`^/static/styles\.[0-9a-f]{12}\.css$`).MatchString(url) {
+		t.Errorf("url(styles.css) = %q, want a fingerprinted URL", url)
+	}
+
+	if got := assets.url("missing.js"); got != "/static/missing.js" {
+		t.Errorf("url(missing.js) = %q, want the plain URL", got)
+	}
+}
+
+func TestServeFingerprintedAsset(t *testing.T) {
+	assets := newTestAssets(t)
+	url := assets.url("styles.css")
+
+	w := serveAsset(assets, url, nil)
+
+	if w.Code != http.StatusOK || w.Body.String() != testStyles {
+		t.Fatalf("GET %s = %d %q", url, w.Code, w.Body.String())
+	}
+
+	if got := w.Header().Get("Cache-Control"); got != immutableCache {
+		t.Errorf("Cache-Control = %q, want %q", got, immutableCache)
+	}
+
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/css") {
+		t.Errorf("Content-Type = %q, want text/css", got)
+	}
+
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) {
+		t.Errorf("ETag = %q, want a strong ETag", etag)
+	}
+
+	w = serveAsset(assets, url, http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("GET %s with If-None-Match = %d, want 304", url, w.Code)
+	}
+}
+
+func TestServeGzippedAsset(t *testing.T) {
+	assets := newTestAssets(t)
+	url := assets.url("styles.css")
+	plainEtag := serveAsset(assets, url, nil).Header().Get("ETag")
+
+	w := serveAsset(assets, url, http.Header{"Accept-Encoding": {"br, gzip"}})
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+
+	if got := w.Header().Get("ETag"); got == plainEtag {
+		t.Errorf("gzip variant has the ETag %q of the plain one", got)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := io.ReadAll(reader); string(body) != testStyles {
+		t.Errorf("gunzipped body = %q", body)
+	}
+
+	w = serveAsset(assets, url, http.Header{"Accept-Encoding": {"gzip;q=0"}})
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding with gzip refused = %q", got)
+	}
+
+	// Compressing a single byte would make it larger.
+	w = serveAsset(assets, assets.url("htmx.min.js"), http.Header{"Accept-Encoding": {"gzip"}})
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding of an incompressible asset = %q", got)
+	}
+}
+
+func TestServePlainAssetUrl(t *testing.T) {
+	assets := newTestAssets(t)
+
+	w := serveAsset(assets, "/static/styles.css", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /static/styles.css = %d", w.Code)
+	}
+
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q, want no-cache", got)
+	}
+
+	if w := serveAsset(assets, "/static/missing.js", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET /static/missing.js = %d, want 404", w.Code)
+	}
+}
+
+func TestMissingRequiredAsset(t *testing.T) {
+	_, err := newAssetSet(fstest.MapFS{"styles.css": {Data: []byte(testStyles)}})
+	if !errors.Is(err, errMissingAsset) {
+		t.Errorf("newAssetSet() without htmx error = %v, want errMissingAsset", err)
+	}
+}
+
+func TestEmbeddedHtmx(t *testing.T) {
+	assets, err := staticAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := assets.url("htmx.min.js")
+	if !regexp.MustCompile(`^/static/htmx\.min\.[0-9a-f]{12}\.js$`).MatchString(url) {
+		t.Errorf("url(htmx.min.js) = %q, want a fingerprinted URL", url)
+	}
+}
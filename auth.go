@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grzadr/calibre-browser/internal/auth"
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+const (
+	sessionCookie = "session"
+	// csrfCookie is readable by scripts, which copy it into csrfHeader or
+	// csrfField of the requests they make.
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+	basicRealm = `Basic realm="Calibre Browser", charset="UTF-8"`
+)
+
+var (
+	errNotLoggedIn  = errors.New("not logged in")
+	errInvalidToken = errors.New("missing or invalid CSRF token")
+)
+
+// userStore holds the users allowed in, when logging in is required.
+var userStore *auth.Store
+
+// crossOrigin rejects state-changing requests other sites make browsers
+// send, before any token is checked.
+var crossOrigin = http.NewCrossOriginProtection()
+
+// publicPath reports whether a path is served without logging in: the
+// login page, the health probes and the static files it needs. Metrics
+// tell about the library and its users, so they need a login.
+func publicPath(path string) bool {
+	switch path {
+	case "/login", "/healthz", "/readyz":
+		return true
+	}
+
+	return strings.HasPrefix(path, assetsPrefix)
+}
+
+// safeMethod reports whether a request only reads.
+func safeMethod(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+// requireLogin lets requests through only from users who logged in, with
+// a session cookie, or who send their credentials with HTTP Basic, as
+// feed readers do. It passes requests through when logging in is off.
+func requireLogin(next http.Handler) http.Handler {
+	if userStore == nil {
+		return next
+	}
+
+	return crossOrigin.Handler(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		if publicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		user, err := authenticate(r)
+
+		switch {
+		case errors.Is(err, errInvalidToken):
+			http.Error(w, err.Error(), http.StatusForbidden)
+
+			return
+		case errors.Is(err, errNotLoggedIn),
+			errors.Is(err, auth.ErrInvalidCredentials),
+			errors.Is(err, auth.ErrNoSession):
+			denyLogin(w, r)
+
+			return
+		case err != nil:
+			booksdb.Logger(r.Context()).
+				Error("authentication error", "error", err)
+			http.Error(w, "authentication error", http.StatusInternalServerError)
+
+			return
+		}
+
+		restriction, err := userRestriction(user, r.Context())
+		if err != nil {
+			booksdb.Logger(r.Context()).
+				Error("authentication error", "error", err)
+			http.Error(w, "authentication error", http.StatusInternalServerError)
+
+			return
+		}
+
+		ctx := auth.WithUser(r.Context(), user)
+		ctx = booksdb.ContextWithRestriction(ctx, restriction)
+		ctx = booksdb.ContextWithLogger(
+			ctx,
+			booksdb.Logger(ctx).With("user", user.Name),
+		)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}))
+}
+
+// authenticate returns the user a request comes from. Requests changing
+// anything need a session and its CSRF token: browsers send HTTP Basic
+// credentials on their own, like cookies, but not the token.
+func authenticate(r *http.Request) (auth.User, error) {
+	if name, password, ok := r.BasicAuth(); ok {
+		if !safeMethod(r) {
+			return auth.User{}, errInvalidToken
+		}
+
+		return userStore.Authenticate(name, password, r.Context())
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return auth.User{}, errNotLoggedIn
+	}
+
+	session, err := userStore.Session(cookie.Value, r.Context())
+	if err != nil {
+		return auth.User{}, err
+	}
+
+	if safeMethod(r) {
+		return session.User, nil
+	}
+
+	token := r.Header.Get(csrfHeader)
+	if token == "" {
+		token = r.PostFormValue(csrfField)
+	}
+
+	if subtle.ConstantTimeCompare(
+		[]byte(token),
+		[]byte(session.CsrfToken),
+	) != 1 {
+		return auth.User{}, errInvalidToken
+	}
+
+	return session.User, nil
+}
+
+// userRestriction returns the rules limiting what a user sees. They are
+// read for every request, so changes apply at once.
+func userRestriction(
+	user auth.User,
+	ctx context.Context,
+) (booksdb.Restriction, error) {
+	rules, err := userStore.Rules(user.Name, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	restriction := make(booksdb.Restriction, len(rules))
+
+	for i, rule := range rules {
+		restriction[i] = booksdb.Rule{
+			Allow: rule.Allow,
+			Field: booksdb.RuleField(rule.Field),
+			Value: rule.Value,
+		}
+	}
+
+	return restriction, nil
+}
+
+// denyLogin asks for credentials the way the client understands: API, feed
+// and metrics clients get a Basic challenge, pages the login form, coming back
+// to where they were afterwards.
+func denyLogin(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") ||
+		strings.HasPrefix(r.URL.Path, "/opds/") ||
+		r.URL.Path == "/metrics" {
+		w.Header().Set("WWW-Authenticate", basicRealm)
+		http.Error(w, "login required", http.StatusUnauthorized)
+
+		return
+	}
+
+	// htmx swaps fragments into a page; the page as a whole has to go.
+	if r.Header.Get("HX-Request") == "true" {
+		page := "/"
+		current, err := url.Parse(r.Header.Get("HX-Current-URL"))
+		if err == nil {
+			page = current.RequestURI()
+		}
+
+		w.Header().Set("HX-Redirect", loginUrl(page))
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	http.Redirect(w, r, loginUrl(r.URL.RequestURI()), http.StatusSeeOther)
+}
+
+func loginUrl(next string) string {
+	return "/login?" + url.Values{"next": {localPath(next)}}.Encode()
+}
+
+// localPath returns next if it is a path on this server and the index
+// otherwise, so the login form cannot send anyone elsewhere. Browsers drop
+// tabs and newlines from URLs and read backslashes as slashes, so "/\t/x"
+// and "/\x" would take them to the host x.
+func localPath(next string) string {
+	if strings.ContainsFunc(next, func(r rune) bool {
+		return r < 0x20 || r == 0x7f || r == '\\'
+	}) {
+		return "/"
+	}
+
+	parsed, err := url.Parse(next)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" ||
+		!strings.HasPrefix(parsed.Path, "/") ||
+		strings.HasPrefix(parsed.Path, "//") {
+		return "/"
+	}
+
+	return next
+}
+
+type loginPage struct {
+	Name  string
+	Next  string
+	Error string
+}
+
+func createLoginPageHandler(templates fs.FS) http.HandlerFunc {
+	tmpl := parsePage(templates, "login.html")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		executePage(w, r, tmpl, loginPage{
+			Next: localPath(r.URL.Query().Get("next")),
+		})
+	}
+}
+
+func createLoginHandler(templates fs.FS) http.HandlerFunc {
+	tmpl := parsePage(templates, "login.html")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PostFormValue("name")
+		next := localPath(r.PostFormValue("next"))
+
+		user, err := userStore.Authenticate(
+			name,
+			r.PostFormValue("password"),
+			r.Context(),
+		)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			booksdb.Logger(r.Context()).Warn("failed login", "name", name)
+			w.WriteHeader(http.StatusUnauthorized)
+			executePage(w, r, tmpl, loginPage{
+				Name:  name,
+				Next:  next,
+				Error: "Invalid user name or password",
+			})
+
+			return
+		} else if err != nil {
+			booksdb.Logger(r.Context()).Error("login error", "error", err)
+			http.Error(w, "login error", http.StatusInternalServerError)
+
+			return
+		}
+
+		session, err := userStore.CreateSession(user, r.Context())
+		if err != nil {
+			booksdb.Logger(r.Context()).Error("login error", "error", err)
+			http.Error(w, "login error", http.StatusInternalServerError)
+
+			return
+		}
+
+		booksdb.Logger(r.Context()).Info("logged in", "user", user.Name)
+		setSessionCookies(
+			w,
+			r,
+			session.Token,
+			session.CsrfToken,
+			session.ExpiresAt,
+		)
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	}
+}
+
+func createLogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// requireLogin already checked the cookie is there.
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			err := userStore.DeleteSession(cookie.Value, r.Context())
+			if err != nil {
+				booksdb.Logger(r.Context()).Error("logout error", "error", err)
+			}
+		}
+
+		setSessionCookies(w, r, "", "", time.Unix(0, 0))
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	}
+}
+
+// setSessionCookies sets the session cookies, or deletes them given
+// a past expiry.
+func setSessionCookies(
+	w http.ResponseWriter,
+	r *http.Request,
+	token, csrfToken string,
+	expires time.Time,
+) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grzadr/calibre-browser/internal/arguments"
+	"github.com/grzadr/calibre-browser/internal/auth"
+)
+
+const (
+	testUser     = "alice"
+	testPassword = "correct horse battery"
+)
+
+// newLoginTestServer serves the test library to one user, who has to log
+// in.
+func newLoginTestServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	if err := openTestLibrary(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := auth.OpenStore(
+		filepath.Join(t.TempDir(), "users.db"),
+		context.Background(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.AddUser(
+		testUser,
+		testPassword,
+		context.Background(),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	userStore = store
+
+	t.Cleanup(func() {
+		userStore = nil
+		store.Close()
+	})
+
+	mux, err := loadRoutes(arguments.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return securityHeaders(requireLogin(mux))
+}
+
+func postForm(path string, values url.Values) *http.Request {
+	r := httptest.NewRequest(
+		http.MethodPost,
+		path,
+		strings.NewReader(values.Encode()),
+	)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return r
+}
+
+// logIn logs the test user in, returning the session and CSRF cookies.
+func logIn(t *testing.T, handler http.Handler) (session, csrf *http.Cookie) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, postForm("/login", url.Values{
+		"name":     {testUser},
+		"password": {testPassword},
+		"next":     {"/tags"},
+	}))
+
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/tags" {
+		t.Fatalf("login: status %d, location %q",
+			w.Code, w.Header().Get("Location"))
+	}
+
+	for _, cookie := range w.Result().Cookies() {
+		switch cookie.Name {
+		case sessionCookie:
+			session = cookie
+		case csrfCookie:
+			csrf = cookie
+		}
+	}
+
+	if session == nil || csrf == nil || !session.HttpOnly || csrf.HttpOnly {
+		t.Fatalf("login: cookies %v", w.Result().Cookies())
+	}
+
+	return session, csrf
+}
+
+func TestLoginRequired(t *testing.T) {
+	handler := newLoginTestServer(t)
+
+	testCases := []struct {
+		name     string
+		request  *http.Request
+		status   int
+		location string
+	}{
+		{
+			"page",
+			httptest.NewRequest(http.MethodGet, "/book/1?x=1", nil),
+			http.StatusSeeOther,
+			"/login?next=%2Fbook%2F1%3Fx%3D1",
+		},
+		{
+			"api",
+			httptest.NewRequest(http.MethodGet, "/api/search?q=hack", nil),
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"login page",
+			httptest.NewRequest(http.MethodGet, "/login", nil),
+			http.StatusOK,
+			"",
+		},
+		{
+			"probe",
+			httptest.NewRequest(http.MethodGet, "/healthz", nil),
+			http.StatusOK,
+			"",
+		},
+		{
+			"metrics",
+			httptest.NewRequest(http.MethodGet, "/metrics", nil),
+			http.StatusUnauthorized,
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, tc.request)
+
+			if w.Code != tc.status {
+				t.Errorf("status %d, want %d", w.Code, tc.status)
+			}
+
+			if got := w.Header().Get("Location"); got != tc.location {
+				t.Errorf("location %q, want %q", got, tc.location)
+			}
+		})
+	}
+
+	htmx := httptest.NewRequest(http.MethodGet, "/library", nil)
+	htmx.Header.Set("HX-Request", "true")
+	htmx.Header.Set("HX-Current-URL", "http://example.com/tags")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, htmx)
+
+	if got := w.Header().Get("HX-Redirect"); got != "/login?next=%2Ftags" {
+		t.Errorf("htmx: HX-Redirect %q", got)
+	}
+
+	scrape := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	scrape.SetBasicAuth(testUser, testPassword)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, scrape)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("metrics with credentials: status %d", w.Code)
+	}
+}
+
+func TestLoginSession(t *testing.T) {
+	handler := newLoginTestServer(t)
+	session, csrf := logIn(t, handler)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/book/1", nil)
+	r.AddCookie(session)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("GET with session: status %d", w.Code)
+	}
+
+	search := url.Values{"search": {"hack"}}
+
+	// The session cookie alone could come from a forged form.
+	w = httptest.NewRecorder()
+	r = postForm("/search", search)
+	r.AddCookie(session)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("POST without token: status %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = postForm("/search", search)
+	r.AddCookie(session)
+	r.Header.Set(csrfHeader, csrf.Value)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("POST with token: status %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = postForm("/search", search)
+	r.AddCookie(session)
+	r.Header.Set(csrfHeader, csrf.Value)
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("cross-site POST: status %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = postForm("/logout", url.Values{csrfField: {csrf.Value}})
+	r.AddCookie(session)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("logout: status %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/book/1", nil)
+	r.AddCookie(session)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("GET after logout: status %d", w.Code)
+	}
+}
+
+func TestLoginFailure(t *testing.T) {
+	handler := newLoginTestServer(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, postForm("/login", url.Values{
+		"name":     {testUser},
+		"password": {"wrong password"},
+		"next":     {"//evil.example.com"},
+	}))
+
+	if w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) > 0 {
+		t.Errorf("status %d, cookies %v", w.Code, w.Result().Cookies())
+	}
+
+	if strings.Contains(w.Body.String(), "evil.example.com") {
+		t.Error("login form keeps a foreign next page")
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	handler := newLoginTestServer(t)
+
+	testCases := []struct {
+		name     string
+		method   string
+		password string
+		status   int
+	}{
+		{"valid", http.MethodGet, testPassword, http.StatusOK},
+		{"wrong password", http.MethodGet, "wrong password", http.StatusUnauthorized},
+		{"no writes", http.MethodPost, testPassword, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/api/search?q=hack", nil)
+			r.SetBasicAuth(testUser, tc.password)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tc.status {
+				t.Errorf("status %d, want %d", w.Code, tc.status)
+			}
+
+			if tc.status == http.StatusUnauthorized &&
+				w.Header().Get("WWW-Authenticate") != basicRealm {
+				t.Errorf("no Basic challenge")
+			}
+		})
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	testCases := map[string]string{
+		"/book/1?x=1":        "/book/1?x=1",
+		"/%09/evil.example":  "/%09/evil.example",
+		"":                   "/",
+		"//evil.example":     "/",
+		`/\evil.example`:     "/",
+		`/a\b`:               "/",
+		"https://evil.ex":    "/",
+		"/\t/evil.example":   "/",
+		"/\n/evil.example":   "/",
+		"/\r\n/evil.example": "/",
+		"/\x00/evil.example": "/",
+		"/\x7f/evil.example": "/",
+		"?next=//evil.ex":    "/",
+		"/%zz":               "/",
+	}
+
+	for next, want := range testCases {
+		if got := localPath(next); got != want {
+			t.Errorf("localPath(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
+
+func TestLoggedInRequestsAreMeasured(t *testing.T) {
+	newLoginTestServer(t)
+
+	mux, err := loadRoutes(arguments.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &routes{}
+	handler.mux.Store(mux)
+
+	r := httptest.NewRequest(http.MethodGet, "/book/2", nil)
+	r.SetBasicAuth(testUser, testPassword)
+	instrument(requireLogin(handler)).ServeHTTP(httptest.NewRecorder(), r)
+
+	var metrics strings.Builder
+	if err := registry.Write(&metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `http_requests_total{route="GET /book/{id}",code="200"}`
+	if !strings.Contains(metrics.String(), want) {
+		t.Errorf("metrics lack %s:\n%s", want, metrics.String())
+	}
+}
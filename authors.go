@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+func createAuthorIndexHandler(templates fs.FS) http.HandlerFunc {
+	tmpl := parsePage(templates, "authors.html")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.FormValue("q")
+		entries := booksdb.GetBooksEntries()
+
+		executePage(w, r, tmpl, struct {
+			Query  string
+			Groups []booksdb.AuthorGroup
+		}{
+			Query:  query,
+			Groups: entries.AuthorIndex(query, pageScope(entries, r)),
+		})
+	}
+}
+
+func createAuthorHandler(templates fs.FS) http.HandlerFunc {
+	tmpl := parsePage(templates, "author.html")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		authorId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		entries := booksdb.GetBooksEntries()
+
+		details, found := entries.AuthorDetails(
+			authorId,
+			pageScope(entries, r),
+		)
+		if !found {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		executePage(w, r, tmpl, details)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+var pageFuncs = template.FuncMap{
+	"definedDate": booksdb.IsDefinedDate,
+	// asset returns the fingerprinted URL of a static file.
+	"asset": func(name string) (string, error) {
+		assets, err := staticAssets()
+		if err != nil {
+			return "", err
+		}
+
+		return assets.url(name), nil
+	},
+	// loginEnabled reports whether pages offer to log out.
+	"loginEnabled": func() bool { return userStore != nil },
+	"bookAuthors": func(bookId uint16) []booksdb.BookAuthor {
+		return booksdb.GetBooksEntries().BookAuthors(bookId)
+	},
+}
+
+// parsePage parses a page template together with the shared layout blocks.
+func parsePage(templates fs.FS, name string) *template.Template {
+	return template.Must(template.New(name).Funcs(pageFuncs).ParseFS(
+		templates, "layout.html", name,
+	)).Lookup(name)
+}
+
+func executePage(
+	w http.ResponseWriter,
+	r *http.Request,
+	tmpl *template.Template,
+	data any,
+) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := tmpl.Execute(w, data); err != nil {
+		booksdb.Logger(r.Context()).Error("template error", "error", err)
+	}
+}
+
+func parseBookId(r *http.Request) (uint16, bool) {
+	bookId, err := strconv.ParseUint(r.PathValue("id"), 10, 16)
+
+	return uint16(bookId), err == nil
+}
+
+func createBookHandler(templates fs.FS) http.HandlerFunc {
+	tmpl := parsePage(templates, "book.html")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookId, ok := parseBookId(r)
+		if !ok {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		entries := booksdb.GetBooksEntries()
+
+		details, found := entries.Details(bookId, pageScope(entries, r))
+		if !found {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		executePage(w, r, tmpl, details)
+	}
+}
+
+// createIsbnHandler redirects a scanned ISBN to the page of the book, so a
+// barcode scanner can tell whether a book is already in the library.
+func createIsbnHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isbn := r.PathValue("isbn")
+
+		entries := booksdb.GetBooksEntries()
+
+		found, err := entries.FindByIdentifier(
+			"isbn",
+			isbn,
+			pageScope(entries, r),
+		)
+
+		switch {
+		case errors.Is(err, booksdb.ErrInvalidIsbn),
+			errors.Is(err, booksdb.ErrInvalidIsbnChecksum):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		case len(found) == 0:
+			http.Error(
+				w,
+				fmt.Sprintf("ISBN %s is not in the library", isbn),
+				http.StatusNotFound,
+			)
+		default:
+			http.Redirect(
+				w,
+				r,
+				fmt.Sprintf("/book/%d", found[0].ID),
+				http.StatusSeeOther,
+			)
+		}
+	}
+}
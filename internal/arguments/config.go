@@ -0,0 +1,132 @@
+package arguments
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	configSetting  = "config"
+	configDirName  = "calibre-browser"
+	configFileName = "config.json"
+	usersDbName    = "users.db"
+	envPrefix      = "CALIBRE_BROWSER_"
+)
+
+var ErrUnknownSetting = errors.New("unknown setting")
+
+// envName returns the environment variable of a setting, e.g.
+// CALIBRE_BROWSER_CACHE_DIR for cache-dir.
+func envName(setting string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(setting, "-", "_"))
+}
+
+// configPath returns the config file to read: the one given as an option
+// or in the environment, otherwise config.json in the user config
+// directory if there is one. An empty path means no file.
+func configPath(option string) string {
+	if option != "" {
+		return option
+	}
+
+	if path := os.Getenv(envName(configSetting)); path != "" {
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	path := filepath.Join(dir, configDirName, configFileName)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+
+	return path
+}
+
+// applyConfigFile sets the options named in a JSON object, e.g.
+//
+//	{"port": 8081, "cache-dir": "/var/cache/calibre-browser"}
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("error decoding config %q: %w", path, err)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		if name == configSetting || fs.Lookup(name) == nil {
+			return fmt.Errorf("config %q: %w %q", path, ErrUnknownSetting, name)
+		}
+
+		// Strings are unquoted; numbers and booleans are set as written.
+		value := string(settings[name])
+		if err := json.Unmarshal(settings[name], &value); err != nil {
+			value = string(settings[name])
+		}
+
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("config %q: %s: %w", path, name, err)
+		}
+	}
+
+	return fs.Set(configSetting, path)
+}
+
+// applyEnvironment sets the options whose CALIBRE_BROWSER_* variable is
+// set.
+func applyEnvironment(fs *flag.FlagSet) (err error) {
+	fs.VisitAll(func(f *flag.Flag) {
+		value, found := os.LookupEnv(envName(f.Name))
+		if !found || err != nil || f.Name == configSetting {
+			return
+		}
+
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), setErr)
+		}
+	})
+
+	return err
+}
+
+// settings returns the value of every option in the form of a config
+// file. None of them is a secret: passwords live in the users database.
+func settings(fs *flag.FlagSet) map[string]any {
+	values := make(map[string]any)
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != configSetting {
+			values[f.Name] = f.Value.(flag.Getter).Get()
+		}
+	})
+
+	return values
+}
+
+// WriteSettings writes the settings the configuration was parsed from to w
+// as a JSON config file.
+func (c Config) WriteSettings(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(c.settings)
+}
@@ -0,0 +1,83 @@
+package arguments
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseArgsLayers(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+
+	dbPath := filepath.Join(dir, "metadata.db")
+	if err := os.WriteFile(dbPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	configFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configFile, []byte(`{
+		"db": "`+dbPath+`",
+		"port": 9000,
+		"locale": "pl",
+		"cache-dir": "/from/file",
+		"tls-self-signed": true
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(envName(configSetting), configFile)
+	t.Setenv(envName("port"), "9001")
+	t.Setenv(envName("cache-dir"), "/from/env")
+
+	conf, err := ParseArgsServer([]string{"web", "-port", "9002"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.DbPath != dbPath || conf.Port != 9002 || conf.Locale != "pl" ||
+		conf.CacheDir != "/from/env" || !conf.TlsSelfSigned ||
+		conf.SearchBackend != "memory" || conf.ConfigPath != configFile {
+		t.Errorf("ParseArgsServer() = %+v", conf)
+	}
+
+	conf, err = ParseArgsServer([]string{
+		"web", "-tls-cert", "cert.pem", "-tls-key", "key.pem",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := conf.WriteSettings(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	var written map[string]any
+	if err := json.Unmarshal(out.Bytes(), &written); err != nil {
+		t.Fatal(err)
+	}
+
+	usersDb := filepath.Join(dir, configDirName, usersDbName)
+	if written["tls-key"] != "key.pem" || written["tls-cert"] != "cert.pem" ||
+		written["port"] != float64(9001) || written["users-db"] != usersDb {
+		t.Errorf("WriteSettings() = %s", out.String())
+	}
+
+	t.Setenv(envName("port"), "0")
+
+	if _, err := ParseArgsServer([]string{"web"}); err == nil {
+		t.Error("ParseArgsServer() accepted port 0")
+	}
+
+	if err := os.WriteFile(configFile, []byte(`{"prot": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseArgsServer([]string{"web", dbPath}); err == nil {
+		t.Error("ParseArgsServer() accepted an unknown setting")
+	}
+}
@@ -1,14 +1,27 @@
 package arguments
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strconv"
 )
 
+const (
+	defaultPort = 8080
+	maxPort     = 65535
+)
+
+var ErrInvalidPort = errors.New("invalid port")
+
+// PortValue is a flag.Value accepting TCP port numbers only, and zero for
+// optional ports meaning none.
 type PortValue struct {
-	Port *string
+	Port     *int
+	Optional bool
 }
 
 func (v PortValue) String() string {
@@ -16,15 +29,79 @@ func (v PortValue) String() string {
 		return ""
 	}
 
-	return *v.Port
+	return strconv.Itoa(*v.Port)
 }
 
 func (v PortValue) Set(s string) error {
+	port, err := strconv.Atoi(s)
+	if v.Optional && err == nil && port == 0 {
+		*v.Port = port
+
+		return nil
+	}
+
+	if err != nil || port < 1 || port > maxPort {
+		return fmt.Errorf(
+			"%w %q: expected a number from 1 to %d",
+			ErrInvalidPort,
+			s,
+			maxPort,
+		)
+	}
+
+	*v.Port = port
+
+	return nil
+}
+
+func (v PortValue) Get() any {
+	return *v.Port
 }
 
 type Config struct {
-	DbPath string
-	Port   int
+	// ConfigPath is the JSON file settings were read from, if any.
+	ConfigPath string
+	DbPath     string
+	// Addr is the host or IP address to listen on; empty means every
+	// interface.
+	Addr string
+	Port int
+	// SocketPath is a Unix socket to listen on instead of a TCP port.
+	SocketPath string
+	// TlsCertPath and TlsKeyPath are PEM files serving HTTPS.
+	TlsCertPath string
+	TlsKeyPath  string
+	// TlsSelfSigned creates a self-signed certificate at TlsCertPath and
+	// TlsKeyPath when there is none yet.
+	TlsSelfSigned bool
+	// RedirectPort is a TCP port redirecting plain HTTP to HTTPS; zero
+	// disables it.
+	RedirectPort int
+	// SearchBackend indexes titles in "memory" or in an SQLite "fts" table.
+	SearchBackend string
+	// CacheDir holds databases derived from the library, e.g. the FTS5
+	// title index.
+	CacheDir string
+	// IndexWorkers bounds how many EPUBs are read at once when their text
+	// is indexed; zero picks a default.
+	IndexWorkers int
+	// Locale is the BCP 47 tag of the language lists are sorted in.
+	Locale string
+	// SynonymsPath is a JSON file of words queries are expanded with.
+	SynonymsPath string
+	// TemplatesDir holds HTML templates replacing the built-in ones.
+	TemplatesDir string
+	// LogFormat writes logs as "text" or "json".
+	LogFormat string
+	// LogLevel is the least severe level logged: debug, info, warn or error.
+	LogLevel string
+	// Auth requires users to log in.
+	Auth bool
+	// UsersDbPath is the SQLite database of users and their sessions.
+	UsersDbPath string
+
+	// settings are the options the configuration was parsed from.
+	settings map[string]any
 }
 
 func validateDbPath(filename string) error {
@@ -38,36 +115,273 @@ func validateDbPath(filename string) error {
 	return nil
 }
 
-func ParseArgsServer(args []string) (conf Config, err error) {
-	log.Printf("parsing server arguments: %+v", args)
+// Tls reports whether the server is configured to serve HTTPS.
+func (c Config) Tls() bool {
+	return c.TlsSelfSigned || c.TlsCertPath != ""
+}
 
-	// Create a new FlagSet for parsing
-	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+func validateTls(conf Config) error {
+	if (conf.TlsCertPath == "") != (conf.TlsKeyPath == "") {
+		return errors.New("-tls-cert and -tls-key must be given together")
+	}
+
+	if conf.RedirectPort != 0 && !conf.Tls() {
+		return errors.New("-redirect-port requires HTTPS")
+	}
+
+	if conf.RedirectPort != 0 && conf.SocketPath != "" {
+		return errors.New("-redirect-port requires a TCP port, not -socket")
+	}
+
+	if conf.RedirectPort != 0 && conf.RedirectPort == conf.Port {
+		return fmt.Errorf(
+			"-redirect-port %d is the HTTPS port",
+			conf.RedirectPort,
+		)
+	}
+
+	return nil
+}
+
+// newFlagSet declares every setting as a flag of conf, with its default.
+func newFlagSet(name string, conf *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
 	fs.Usage = func() {
-		fmt.Fprintf(fs.Output(), "Usage: %s <db filename>\n", args[0])
+		fmt.Fprintf(
+			fs.Output(),
+			"Usage: %s [options] [db filename]\n"+
+				"       %s config check [options] [db filename]\n"+
+				"       %s users [options] list | add|remove|reset|rules|clear <name>\n"+
+				"       %s users [options] allow|deny <name> tag|library|language <value>\n",
+			name,
+			name,
+			name,
+			name,
+		)
 		fmt.Fprintf(fs.Output(), "\nArguments:\n")
 		fmt.Fprintf(
 			fs.Output(),
 			"  db filename    Path to the Calibre database file\n",
 		)
+		fmt.Fprintf(fs.Output(), "\nOptions:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(
+			fs.Output(),
+			"\nEvery option may also be set in the config file, by its name, "+
+				"or in the\nenvironment, e.g. %s for -cache-dir. "+
+				"Options override the\nenvironment, which overrides the "+
+				"config file.\n",
+			envName("cache-dir"),
+		)
 	}
 
-	// Parse flags (currently none, but this allows for future additions)
+	conf.Port = defaultPort
+
+	fs.StringVar(
+		&conf.ConfigPath,
+		configSetting,
+		"",
+		"JSON `file` of settings (default: "+configFileName+
+			" in the user config directory, if present)",
+	)
+	fs.StringVar(
+		&conf.DbPath,
+		"db",
+		"",
+		"`path` of the Calibre database file, unless given as an argument",
+	)
+	fs.StringVar(
+		&conf.Addr,
+		"addr",
+		"",
+		"`host` or IP address to listen on (default: all)",
+	)
+	fs.Var(PortValue{Port: &conf.Port}, "port", "TCP `port` to listen on")
+	fs.StringVar(
+		&conf.SocketPath,
+		"socket",
+		"",
+		"Unix socket `path` to listen on instead of a TCP port",
+	)
+	fs.StringVar(
+		&conf.TlsCertPath,
+		"tls-cert",
+		"",
+		"PEM certificate `file` for HTTPS",
+	)
+	fs.StringVar(
+		&conf.TlsKeyPath,
+		"tls-key",
+		"",
+		"PEM private key `file` for HTTPS",
+	)
+	fs.BoolVar(
+		&conf.TlsSelfSigned,
+		"tls-self-signed",
+		false,
+		"serve HTTPS with a self-signed certificate created at first run "+
+			"(default files: the user config directory)",
+	)
+	fs.Var(
+		PortValue{Port: &conf.RedirectPort, Optional: true},
+		"redirect-port",
+		"TCP `port` redirecting HTTP to HTTPS (default: none)",
+	)
+	fs.StringVar(
+		&conf.SearchBackend,
+		"search-backend",
+		"memory",
+		"title search `backend`: memory or fts",
+	)
+	fs.StringVar(
+		&conf.CacheDir,
+		"cache-dir",
+		"",
+		"`directory` for search caches (default: the user cache directory)",
+	)
+	fs.IntVar(
+		&conf.IndexWorkers,
+		"index-workers",
+		0,
+		"`number` of EPUBs read at once when indexing book text "+
+			"(default: half the CPUs)",
+	)
+	fs.StringVar(
+		&conf.Locale,
+		"locale",
+		"",
+		"`language` titles and names are sorted in, e.g. pl or cs "+
+			"(default: Unicode root order)",
+	)
+	fs.StringVar(
+		&conf.SynonymsPath,
+		"synonyms",
+		"",
+		"JSON `file` mapping query words to synonyms, reloaded when it changes",
+	)
+	fs.StringVar(
+		&conf.TemplatesDir,
+		"templates-dir",
+		"",
+		"`directory` of HTML templates replacing the built-in ones, "+
+			"reloaded on SIGHUP",
+	)
+	fs.StringVar(&conf.LogFormat, "log-format", "text", "log `format`: text or json")
+	fs.StringVar(
+		&conf.LogLevel,
+		"log-level",
+		"info",
+		"least severe `level` logged: debug, info, warn or error",
+	)
+	fs.BoolVar(
+		&conf.Auth,
+		"auth",
+		false,
+		"require users to log in; manage them with the users command",
+	)
+	fs.StringVar(
+		&conf.UsersDbPath,
+		"users-db",
+		"",
+		"SQLite `file` of users and sessions "+
+			"(default: users.db in the user config directory)",
+	)
+
+	return fs
+}
+
+// parseOptions layers the settings: defaults, then the config file, then
+// the environment, then the options. Arguments are left in the flag set.
+func parseOptions(args []string, conf *Config) (*flag.FlagSet, error) {
+	fs := newFlagSet(args[0], conf)
+
 	if err := fs.Parse(args[1:]); err != nil {
+		return fs, err
+	}
+
+	// Options are applied again last, so they override everything else.
+	options := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		options[f.Name] = f.Value.String()
+	})
+
+	if err := applyConfigFile(fs, configPath(conf.ConfigPath)); err != nil {
+		return fs, err
+	}
+
+	if err := applyEnvironment(fs); err != nil {
+		return fs, err
+	}
+
+	for name, value := range options {
+		if err := fs.Set(name, value); err != nil {
+			return fs, err
+		}
+	}
+
+	if conf.UsersDbPath == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return fs, fmt.Errorf("error locating config directory: %w", err)
+		}
+
+		// Set through the flag, so the printed settings show it.
+		path := filepath.Join(dir, configDirName, usersDbName)
+		if err := fs.Set("users-db", path); err != nil {
+			return fs, err
+		}
+	}
+
+	return fs, nil
+}
+
+// parseArgs parses the settings and the database argument of the server.
+func parseArgs(args []string) (conf Config, err error) {
+	fs, err := parseOptions(args, &conf)
+	if err != nil {
 		return conf, err
 	}
 
-	// Get the positional argument (database path)
-	if fs.NArg() < 1 {
+	if fs.NArg() > 0 {
+		if err := fs.Set("db", fs.Arg(0)); err != nil {
+			return conf, err
+		}
+	}
+
+	if conf.DbPath == "" {
 		fs.Usage()
+
 		return conf, fmt.Errorf("missing required argument: database path")
 	}
 
-	conf.DbPath = fs.Arg(0)
-
 	if err := validateDbPath(conf.DbPath); err != nil {
 		return conf, err
 	}
 
+	if err := validateTls(conf); err != nil {
+		return conf, err
+	}
+
+	conf.settings = settings(fs)
+
 	return conf, nil
 }
+
+// ParseArgsUsers parses the settings of the users command, returning its
+// arguments, e.g. "add alice". No database is needed.
+func ParseArgsUsers(args []string) (conf Config, rest []string, err error) {
+	fs, err := parseOptions(args, &conf)
+	if err != nil {
+		return conf, nil, err
+	}
+
+	conf.settings = settings(fs)
+
+	return conf, fs.Args(), nil
+}
+
+func ParseArgsServer(args []string) (conf Config, err error) {
+	slog.Debug("parsing server arguments", "args", args)
+
+	return parseArgs(args)
+}
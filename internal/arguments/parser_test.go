@@ -0,0 +1,85 @@
+package arguments
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPortValueSet(t *testing.T) {
+	portCases := []struct {
+		value    string
+		optional bool
+		want     int
+		valid    bool
+	}{
+		{"8080", false, 8080, true},
+		{"1", false, 1, true},
+		{"65535", false, 65535, true},
+		{"0", false, 0, false},
+		{"0", true, 0, true},
+		{"65536", true, 0, false},
+		{"-1", true, 0, false},
+		{"http", false, 0, false},
+		{"", true, 0, false},
+	}
+
+	for _, tc := range portCases {
+		port := -1
+		err := PortValue{Port: &port, Optional: tc.optional}.Set(tc.value)
+
+		switch {
+		case !tc.valid && !errors.Is(err, ErrInvalidPort):
+			t.Errorf("Set(%q) error = %v, want ErrInvalidPort", tc.value, err)
+		case !tc.valid && port != -1:
+			t.Errorf("Set(%q) changed the port to %d", tc.value, port)
+		case tc.valid && (err != nil || port != tc.want):
+			t.Errorf(
+				"Set(%q) = %d, %v, want %d",
+				tc.value, port, err, tc.want,
+			)
+		}
+	}
+}
+
+func TestValidateTls(t *testing.T) {
+	tlsCases := []struct {
+		name  string
+		conf  Config
+		valid bool
+	}{
+		{"plain HTTP", Config{Port: 8080}, true},
+		{
+			"certificate",
+			Config{Port: 8443, TlsCertPath: "cert.pem", TlsKeyPath: "key.pem"},
+			true,
+		},
+		{"certificate without key", Config{TlsCertPath: "cert.pem"}, false},
+		{"key without certificate", Config{TlsKeyPath: "key.pem"}, false},
+		{
+			"redirect",
+			Config{Port: 8443, TlsSelfSigned: true, RedirectPort: 8080},
+			true,
+		},
+		{"redirect without HTTPS", Config{Port: 8443, RedirectPort: 8080}, false},
+		{
+			"redirect from a socket",
+			Config{
+				SocketPath:    "/run/calibre-browser.sock",
+				TlsSelfSigned: true,
+				RedirectPort:  8080,
+			},
+			false,
+		},
+		{
+			"redirect to itself",
+			Config{Port: 8443, TlsSelfSigned: true, RedirectPort: 8443},
+			false,
+		},
+	}
+
+	for _, tc := range tlsCases {
+		if err := validateTls(tc.conf); (err == nil) != tc.valid {
+			t.Errorf("%s: validateTls() = %v, want valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
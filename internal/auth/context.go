@@ -0,0 +1,17 @@
+package auth
+
+import "context"
+
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying the user a request is made by.
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom returns the user ctx carries, if any.
+func UserFrom(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userKey{}).(User)
+
+	return user, ok
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	passwordScheme = "pbkdf2-sha256"
+	// defaultIterations follows the OWASP recommendation for PBKDF2 with
+	// HMAC-SHA256.
+	defaultIterations = 600_000
+	saltLength        = 16
+	keyLength         = 32
+	// MinPasswordLength is the length passwords must have at least.
+	MinPasswordLength = 8
+)
+
+var (
+	ErrPasswordTooShort = fmt.Errorf(
+		"password must have at least %d characters",
+		MinPasswordLength,
+	)
+	errInvalidHash = errors.New("invalid password hash")
+)
+
+// iterations is how many PBKDF2 rounds new hashes get. Tests lower it;
+// stored hashes keep the count they were made with.
+var iterations = defaultIterations
+
+// hashPassword derives a key from password with a random salt and encodes
+// it with its parameters, e.g. "pbkdf2-sha256$600000$<salt>$<key>".
+func hashPassword(password string) (string, error) {
+	if len([]rune(password)) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+
+	salt := make([]byte, saltLength)
+	rand.Read(salt)
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, keyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		passwordScheme,
+		strconv.Itoa(iterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// verifyPassword reports whether password matches an encoded hash, in
+// time independent of where they differ.
+func verifyPassword(encoded, password string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false, errInvalidHash
+	}
+
+	rounds, err := strconv.Atoi(parts[1])
+	if err != nil || rounds < 1 {
+		return false, errInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, errInvalidHash
+	}
+
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, errInvalidHash
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, rounds, len(want))
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(key, want) == 1, nil
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func init() {
+	// Full-strength hashing would make the tests slow.
+	iterations = 1000
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$1000$") {
+		t.Errorf("hashPassword() = %q, want the scheme and iterations first", hash)
+	}
+
+	if again, _ := hashPassword("correct horse"); again == hash {
+		t.Error("hashPassword() twice gave the same hash, want a new salt")
+	}
+
+	passwordCases := []struct {
+		password string
+		want     bool
+	}{
+		{"correct horse", true},
+		{"correct horse ", false},
+		{"Correct horse", false},
+		{"", false},
+	}
+
+	for _, tc := range passwordCases {
+		got, err := verifyPassword(hash, tc.password)
+		if err != nil || got != tc.want {
+			t.Errorf("verifyPassword(%q) = %v, %v, want %v", tc.password, got, err, tc.want)
+		}
+	}
+
+	if _, err := hashPassword("short"); !errors.Is(err, ErrPasswordTooShort) {
+		t.Errorf("hashPassword(short) error = %v, want %v", err, ErrPasswordTooShort)
+	}
+
+	for _, invalid := range []string{"", "md5$x", "pbkdf2-sha256$0$AA$AA", "pbkdf2-sha256$1$!$AA"} {
+		if _, err := verifyPassword(invalid, "password"); !errors.Is(err, errInvalidHash) {
+			t.Errorf("verifyPassword(%q) error = %v, want %v", invalid, err, errInvalidHash)
+		}
+	}
+}
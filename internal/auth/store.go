@@ -0,0 +1,527 @@
+// Package auth keeps the users allowed to browse the library, in a SQLite
+// database of its own next to Calibre's, and their login sessions.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SessionLifetime is how long a login lasts.
+const SessionLifetime = 30 * 24 * time.Hour
+
+// pragmas let the server and the users command use the database at the
+// same time and delete the rules of removed users.
+const pragmas = "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)" +
+	"&_pragma=foreign_keys(1)"
+
+// maxVerified bounds the credentials remembered as checked.
+const maxVerified = 1024
+
+// maxVerifying bounds the passwords checked at once, so a flood of failed
+// logins, each costing a PBKDF2 run, leaves CPUs to serve the library.
+var maxVerifying = max(1, runtime.NumCPU()/2)
+
+var (
+	ErrUserExists         = errors.New("user already exists")
+	ErrUnknownUser        = errors.New("unknown user")
+	ErrInvalidCredentials = errors.New("invalid user name or password")
+	ErrNoSession          = errors.New("no such session")
+	ErrInvalidName        = errors.New("invalid user name")
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS users (
+	id            INTEGER PRIMARY KEY,
+	name          TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	created_at    INTEGER NOT NULL,
+	updated_at    INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	token_hash TEXT PRIMARY KEY,
+	user_id    INTEGER NOT NULL REFERENCES users (id),
+	csrf_token TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS rules (
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	allow   INTEGER NOT NULL,
+	field   TEXT NOT NULL,
+	value   TEXT NOT NULL,
+	PRIMARY KEY (user_id, allow, field, value)
+);
+`
+
+type User struct {
+	Id   int64
+	Name string
+}
+
+// Rule allows or denies a user the books whose field, e.g. tag, matches
+// value. The library decides what the fields mean.
+type Rule struct {
+	Allow bool
+	Field string
+	Value string
+}
+
+// Session is a login. Its token is only known to the browser holding it;
+// the store keeps a hash.
+type Session struct {
+	Token     string
+	CsrfToken string
+	User      User
+	ExpiresAt time.Time
+}
+
+// Store holds users and sessions. It is safe for concurrent use, also by
+// several processes, e.g. the server and the users command.
+type Store struct {
+	db *sql.DB
+
+	// verified remembers credentials already checked against a password
+	// hash, keyed by their HMAC, so HTTP Basic clients sending them with
+	// every request do not pay for PBKDF2 each time.
+	mu          sync.Mutex
+	verifiedKey []byte
+	verified    map[string]string
+	// dummyHash is checked for unknown users, so they take as long as
+	// known ones.
+	dummyHash string
+	// verifying holds a slot for every password being checked.
+	verifying chan struct{}
+}
+
+// OpenStore opens the users database at path, creating it if needed,
+// readable by the owner only.
+func OpenStore(path string, ctx context.Context) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("error creating users directory: %w", err)
+	}
+
+	// Created up front, so SQLite does not make it readable by anyone.
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error creating users db %q: %w", path, err)
+	}
+
+	file.Close()
+
+	dsn := url.URL{Scheme: "file", Path: path, RawQuery: pragmas}
+
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("error opening users db %q: %w", path, err)
+	}
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("error creating users db %q: %w", path, err)
+	}
+
+	dummyHash, err := hashPassword(rand.Text())
+	if err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	return &Store{
+		db:          db,
+		verifiedKey: []byte(rand.Text()),
+		verified:    make(map[string]string),
+		dummyHash:   dummyHash,
+		verifying:   make(chan struct{}, maxVerifying),
+	}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// validName accepts names without control characters or colons, which
+// HTTP Basic cannot carry.
+func validName(name string) bool {
+	return name != "" && name == strings.TrimSpace(name) &&
+		!strings.ContainsFunc(name, func(r rune) bool {
+			return r < ' ' || r == ':'
+		})
+}
+
+func (s *Store) AddUser(name, password string, ctx context.Context) error {
+	if !validName(name) {
+		return fmt.Errorf("%w %q", ErrInvalidName, name)
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+
+	result, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO users (name, password_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?) ON CONFLICT (name) DO NOTHING`,
+		name,
+		hash,
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("error adding user %q: %w", name, err)
+	}
+
+	if added, _ := result.RowsAffected(); added == 0 {
+		return fmt.Errorf("%w %q", ErrUserExists, name)
+	}
+
+	return nil
+}
+
+// RemoveUser deletes a user with their rules and logs them out.
+func (s *Store) RemoveUser(name string, ctx context.Context) error {
+	return s.updateUser(name, ctx, `DELETE FROM users WHERE id = ?`)
+}
+
+// ResetPassword sets a new password and logs the user out everywhere.
+func (s *Store) ResetPassword(name, password string, ctx context.Context) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.updateUser(
+		name,
+		ctx,
+		`UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`,
+		hash,
+		time.Now().Unix(),
+	)
+}
+
+// updateUser ends the sessions of a user and runs statement, whose last
+// parameter is the id of the user.
+func (s *Store) updateUser(
+	name string,
+	ctx context.Context,
+	statement string,
+	args ...any,
+) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRowContext(
+		ctx,
+		`SELECT id FROM users WHERE name = ?`,
+		name,
+	).Scan(&id); errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w %q", ErrUnknownUser, name)
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM sessions WHERE user_id = ?`,
+		id,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, statement, append(args, id)...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Users lists the names of the users in alphabetical order.
+func (s *Store) Users(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM users ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var names []string
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// Authenticate checks a user name and password.
+func (s *Store) Authenticate(
+	name, password string,
+	ctx context.Context,
+) (User, error) {
+	var (
+		user User
+		hash string
+	)
+
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT id, name, password_hash FROM users WHERE name = ?`,
+		name,
+	).Scan(&user.Id, &user.Name, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := s.verifyPassword(s.dummyHash, password, ctx); err != nil {
+			return user, fmt.Errorf("error checking password: %w", err)
+		}
+
+		return user, ErrInvalidCredentials
+	} else if err != nil {
+		return user, fmt.Errorf("error reading users: %w", err)
+	}
+
+	key := s.credentialsKey(name, password)
+
+	s.mu.Lock()
+	verifiedHash, found := s.verified[key]
+	s.mu.Unlock()
+
+	// A hash checked before is trusted as long as it has not changed.
+	if found && subtle.ConstantTimeCompare([]byte(verifiedHash), []byte(hash)) == 1 {
+		return user, nil
+	}
+
+	if matches, err := s.verifyPassword(hash, password, ctx); err != nil {
+		return user, fmt.Errorf("error checking password of %q: %w", name, err)
+	} else if !matches {
+		return user, ErrInvalidCredentials
+	}
+
+	s.mu.Lock()
+	if len(s.verified) >= maxVerified {
+		clear(s.verified)
+	}
+
+	s.verified[key] = hash
+	s.mu.Unlock()
+
+	return user, nil
+}
+
+// verifyPassword checks a password once a slot is free, waiting for
+// one as long as ctx allows.
+func (s *Store) verifyPassword(
+	hash, password string,
+	ctx context.Context,
+) (bool, error) {
+	select {
+	case s.verifying <- struct{}{}:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+
+	defer func() { <-s.verifying }()
+
+	return verifyPassword(hash, password)
+}
+
+func (s *Store) credentialsKey(name, password string) string {
+	mac := hmac.New(sha256.New, s.verifiedKey)
+	mac.Write([]byte(name + "\x00" + password))
+
+	return string(mac.Sum(nil))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession logs a user in, returning a session with new random
+// tokens. Expired sessions are dropped on the way.
+func (s *Store) CreateSession(user User, ctx context.Context) (Session, error) {
+	now := time.Now()
+	session := Session{
+		Token:     rand.Text(),
+		CsrfToken: rand.Text(),
+		User:      user,
+		ExpiresAt: now.Add(SessionLifetime),
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM sessions WHERE expires_at <= ?`,
+		now.Unix(),
+	); err != nil {
+		return session, fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO sessions (token_hash, user_id, csrf_token, expires_at)
+		VALUES (?, ?, ?, ?)`,
+		hashToken(session.Token),
+		user.Id,
+		session.CsrfToken,
+		session.ExpiresAt.Unix(),
+	); err != nil {
+		return session, fmt.Errorf("error creating session: %w", err)
+	}
+
+	return session, nil
+}
+
+// Session returns the session of a token unless it expired.
+func (s *Store) Session(token string, ctx context.Context) (Session, error) {
+	session := Session{Token: token}
+
+	var expiresAt int64
+
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT users.id, users.name, sessions.csrf_token, sessions.expires_at
+		FROM sessions JOIN users ON users.id = sessions.user_id
+		WHERE sessions.token_hash = ? AND sessions.expires_at > ?`,
+		hashToken(token),
+		time.Now().Unix(),
+	).Scan(&session.User.Id, &session.User.Name, &session.CsrfToken, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return session, ErrNoSession
+	} else if err != nil {
+		return session, fmt.Errorf("error reading session: %w", err)
+	}
+
+	session.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return session, nil
+}
+
+// DeleteSession logs a session out.
+func (s *Store) DeleteSession(token string, ctx context.Context) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM sessions WHERE token_hash = ?`,
+		hashToken(token),
+	)
+
+	return err
+}
+
+// userId looks the id of a user up.
+func (s *Store) userId(name string, ctx context.Context) (int64, error) {
+	var id int64
+
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT id FROM users WHERE name = ?`,
+		name,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return id, fmt.Errorf("%w %q", ErrUnknownUser, name)
+	}
+
+	return id, err
+}
+
+// AddRule restricts what a user may see. Adding a rule twice does nothing.
+func (s *Store) AddRule(name string, rule Rule, ctx context.Context) error {
+	id, err := s.userId(name, ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO rules (user_id, allow, field, value) VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`,
+		id,
+		rule.Allow,
+		rule.Field,
+		rule.Value,
+	); err != nil {
+		return fmt.Errorf("error adding rule of %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// ClearRules lets a user see the whole library again.
+func (s *Store) ClearRules(name string, ctx context.Context) error {
+	id, err := s.userId(name, ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM rules WHERE user_id = ?`,
+		id,
+	); err != nil {
+		return fmt.Errorf("error clearing rules of %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// Rules lists the rules of a user, allow rules first.
+func (s *Store) Rules(name string, ctx context.Context) ([]Rule, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT rules.allow, rules.field, rules.value
+		FROM rules JOIN users ON users.id = rules.user_id
+		WHERE users.name = ?
+		ORDER BY rules.allow DESC, rules.field, rules.value`,
+		name,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rules of %q: %w", name, err)
+	}
+
+	defer rows.Close()
+
+	var rules []Rule
+
+	for rows.Next() {
+		var rule Rule
+		if err := rows.Scan(&rule.Allow, &rule.Field, &rule.Value); err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := OpenStore(
+		filepath.Join(t.TempDir(), "users.db"),
+		context.Background(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestStoreUsers(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.AddUser("alice", "wonderland", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.AddUser("alice", "elsewhere", ctx); !errors.Is(err, ErrUserExists) {
+		t.Errorf("AddUser(alice) again error = %v, want %v", err, ErrUserExists)
+	}
+
+	for _, name := range []string{"", " bob", "bob:smith", "bob\n"} {
+		if err := store.AddUser(name, "password", ctx); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("AddUser(%q) error = %v, want %v", name, err, ErrInvalidName)
+		}
+	}
+
+	if err := store.AddUser("bob", "builder1", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if names, _ := store.Users(ctx); !slices.Equal(names, []string{"alice", "bob"}) {
+		t.Errorf("Users() = %v", names)
+	}
+
+	credentialCases := []struct {
+		name, password string
+		want           error
+	}{
+		{"alice", "wonderland", nil},
+		{"alice", "wonderland", nil},
+		{"alice", "builder1", ErrInvalidCredentials},
+		{"carol", "wonderland", ErrInvalidCredentials},
+	}
+
+	for _, tc := range credentialCases {
+		user, err := store.Authenticate(tc.name, tc.password, ctx)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("Authenticate(%q, %q) error = %v, want %v", tc.name, tc.password, err, tc.want)
+		}
+
+		if err == nil && user.Name != tc.name {
+			t.Errorf("Authenticate(%q) = %+v", tc.name, user)
+		}
+	}
+
+	if err := store.RemoveUser("bob", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.RemoveUser("bob", ctx); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("RemoveUser(bob) again error = %v, want %v", err, ErrUnknownUser)
+	}
+
+	if _, err := store.Authenticate("bob", "builder1", ctx); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate(bob) after removal error = %v", err)
+	}
+}
+
+func TestStoreRules(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.AddUser("kid", "password", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []Rule{
+		{Allow: false, Field: "tag", Value: "Horror"},
+		{Allow: true, Field: "library", Value: "Kids"},
+		{Allow: true, Field: "library", Value: "Kids"},
+	}
+
+	for _, rule := range rules {
+		if err := store.AddRule("kid", rule, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.AddRule("carol", rules[0], ctx); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("AddRule(carol) error = %v, want %v", err, ErrUnknownUser)
+	}
+
+	got, err := store.Rules("kid", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(got, []Rule{rules[1], rules[0]}) {
+		t.Errorf("Rules(kid) = %v", got)
+	}
+
+	if err := store.ClearRules("kid", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := store.Rules("kid", ctx); len(got) != 0 {
+		t.Errorf("Rules(kid) after ClearRules = %v", got)
+	}
+
+	// Rules go with the user, so a new user of the same name has none.
+	if err := store.AddRule("kid", rules[0], ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.RemoveUser("kid", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.AddUser("kid", "password", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := store.Rules("kid", ctx); len(got) != 0 {
+		t.Errorf("Rules(kid) of a new user = %v", got)
+	}
+}
+
+func TestStoreSessions(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.AddUser("alice", "wonderland", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := store.Authenticate("alice", "wonderland", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := store.CreateSession(user, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := store.Session(session.Token, ctx)
+	if err != nil || found.User != user || found.CsrfToken != session.CsrfToken {
+		t.Errorf("Session() = %+v, %v, want %+v", found, err, session)
+	}
+
+	if _, err := store.Session("forged", ctx); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Session(forged) error = %v, want %v", err, ErrNoSession)
+	}
+
+	// Resetting the password logs out and forgets the old password, even
+	// though it was verified before.
+	if err := store.ResetPassword("alice", "looking glass", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Session(session.Token, ctx); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Session() after reset error = %v, want %v", err, ErrNoSession)
+	}
+
+	if _, err := store.Authenticate("alice", "wonderland", ctx); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate(old password) error = %v", err)
+	}
+
+	if _, err := store.Authenticate("alice", "looking glass", ctx); err != nil {
+		t.Errorf("Authenticate(new password) error = %v", err)
+	}
+
+	session, _ = store.CreateSession(user, ctx)
+	if err := store.DeleteSession(session.Token, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Session(session.Token, ctx); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Session() after logout error = %v, want %v", err, ErrNoSession)
+	}
+}
+
+func TestStoreFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.db")
+
+	store, err := OpenStore(path, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("users db mode = %o, want 600", mode)
+	}
+}
+
+func TestAuthenticateWaitsForSlot(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.AddUser("alice", "secret password", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for range cap(store.verifying) {
+		store.verifying <- struct{}{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := store.Authenticate(name, "guess", ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Authenticate(%q) with no free slot error = %v", name, err)
+		}
+	}
+
+	<-store.verifying
+
+	if _, err := store.Authenticate("alice", "secret password", context.Background()); err != nil {
+		t.Errorf("Authenticate with a free slot error = %v", err)
+	}
+}
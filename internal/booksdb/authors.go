@@ -0,0 +1,267 @@
+package booksdb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const otherAuthorsLetter = "#"
+
+type author struct {
+	id      int64
+	name    string
+	sort    string
+	sortKey []byte
+	words   []Word
+	books   []BookEntryId
+}
+
+type BookAuthor struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type AuthorSummary struct {
+	Id    int64  `json:"id"`
+	Name  string `json:"name"`
+	Sort  string `json:"sort"`
+	Count int    `json:"count"`
+}
+
+// AuthorGroup holds the authors whose sort name starts with Letter.
+type AuthorGroup struct {
+	Letter  string          `json:"letter"`
+	Authors []AuthorSummary `json:"authors"`
+}
+
+type AuthorDetails struct {
+	AuthorSummary
+
+	Books BookEntrySlice `json:"books"`
+}
+
+// splitName breaks a person's name into normalized words, treating
+// punctuation as a separator so "J.R.R." and "J. R. R." compare equal.
+func splitName(name string) []Word {
+	return normalizeWordSlice(strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+}
+
+// matchesName reports whether every query word is a prefix of a word of the
+// name, in any order and in either the Cyrillic or Greek script or Latin.
+func matchesName(nameWords, queryWords []Word) bool {
+	for _, query := range queryWords {
+		latin := transliterate(query)
+
+		if !slices.ContainsFunc(nameWords, func(word Word) bool {
+			return strings.HasPrefix(string(word), string(query)) ||
+				strings.HasPrefix(string(transliterate(word)), string(latin))
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func authorLetter(sort string) string {
+	first, _ := utf8.DecodeRuneInString(string(normalizeWord(sort)))
+	if !unicode.IsLetter(first) {
+		return otherAuthorsLetter
+	}
+
+	return string(unicode.ToUpper(first))
+}
+
+func (b *BookEntries) loadAuthors(
+	repo *BookRepository,
+	ctx context.Context,
+) error {
+	rows, err := repo.AllAuthors(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing authors: %w", err)
+	}
+
+	links, err := repo.BookAuthors(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing author links: %w", err)
+	}
+
+	b.authors = make([]author, len(rows))
+	keys := newSortKeys(repo.options.Locale)
+
+	for i, row := range rows {
+		sort := row.Name
+		if row.Sort.Valid && row.Sort.String != "" {
+			sort = row.Sort.String
+		}
+
+		b.authors[i] = author{
+			id:      row.ID,
+			name:    row.Name,
+			sort:    sort,
+			sortKey: keys.key(sort),
+			words:   slices.Concat(splitName(row.Name), splitName(sort)),
+		}
+	}
+
+	slices.SortFunc(b.authors, func(left, right author) int {
+		return compareKeys(left.sortKey, right.sortKey, left.sort, right.sort)
+	})
+
+	b.authorIds = make(map[int64]int, len(b.authors))
+
+	for position, a := range b.authors {
+		b.authorIds[a.id] = position
+	}
+
+	// Links are read in insertion order, which is the order Calibre shows
+	// the authors of a book in.
+	b.bookAuthors = make([][]int, len(b.books))
+
+	for _, link := range links {
+		entryId, found := b.bookIds[uint16(link.Book)]
+		if !found {
+			continue
+		}
+
+		position, found := b.authorIds[link.Author]
+		if !found {
+			continue
+		}
+
+		b.bookAuthors[entryId] = append(b.bookAuthors[entryId], position)
+		b.authors[position].books = append(
+			b.authors[position].books,
+			entryId,
+		)
+	}
+
+	return nil
+}
+
+func (a author) summary(books []BookEntryId) AuthorSummary {
+	return AuthorSummary{
+		Id:    a.id,
+		Name:  a.name,
+		Sort:  a.sort,
+		Count: len(books),
+	}
+}
+
+func (b *BookEntries) matchingAuthors(query string) (positions []int) {
+	words := splitName(query)
+
+	for position, a := range b.authors {
+		if len(a.books) > 0 && matchesName(a.words, words) {
+			positions = append(positions, position)
+		}
+	}
+
+	return positions
+}
+
+// AuthorIndex groups the authors matching query by the first letter of
+// their sort name. Both the display name and the sort name are searched,
+// so "Tolkien J" and "J.R.R. Tolkien" find the same author. Authors without
+// books in scope are left out.
+func (b *BookEntries) AuthorIndex(
+	query string,
+	scope Scope,
+) (groups []AuthorGroup) {
+	for _, position := range b.matchingAuthors(query) {
+		a := b.authors[position]
+
+		books := scope.filter(a.books)
+		if len(books) == 0 {
+			continue
+		}
+
+		letter := authorLetter(a.sort)
+
+		if n := len(groups); n == 0 || groups[n-1].Letter != letter {
+			groups = append(groups, AuthorGroup{Letter: letter})
+		}
+
+		group := &groups[len(groups)-1]
+		group.Authors = append(group.Authors, a.summary(books))
+	}
+
+	return groups
+}
+
+// AuthorDetails returns an author with their books in scope ordered by
+// title.
+func (b *BookEntries) AuthorDetails(
+	authorId int64,
+	scope Scope,
+) (details AuthorDetails, found bool) {
+	position, found := b.authorIds[authorId]
+	if !found {
+		return details, false
+	}
+
+	a := b.authors[position]
+
+	books := scope.filter(a.books)
+	if len(books) == 0 {
+		return details, false
+	}
+
+	details.AuthorSummary = a.summary(books)
+	details.Books = b.selectIds(b.sortByTitle(books))
+
+	return details, true
+}
+
+func (b *BookEntries) bookAuthorsOf(entryId BookEntryId) []BookAuthor {
+	positions := b.bookAuthors[entryId]
+	bookAuthors := make([]BookAuthor, len(positions))
+
+	for i, position := range positions {
+		bookAuthors[i] = BookAuthor{
+			Id:   b.authors[position].id,
+			Name: b.authors[position].name,
+		}
+	}
+
+	return bookAuthors
+}
+
+// BookAuthors returns the authors of a book by its Calibre id, in the order
+// they were entered.
+func (b *BookEntries) BookAuthors(bookId uint16) []BookAuthor {
+	entryId, found := b.bookIds[bookId]
+	if !found {
+		return nil
+	}
+
+	return b.bookAuthorsOf(entryId)
+}
+
+// authorFilter selects books by any author matching the query words.
+type authorFilter struct {
+	query string
+}
+
+func (f authorFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	for _, position := range entries.matchingAuthors(f.query) {
+		for _, id := range entries.authors[position].books {
+			set.add(id)
+		}
+	}
+
+	return set
+}
+
+func parseAuthorFilter(value string, _ time.Time) (queryFilter, error) {
+	return authorFilter{query: value}, nil
+}
@@ -0,0 +1,36 @@
+package booksdb
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchesName(t *testing.T) {
+	words := slices.Concat(
+		splitName("J. R. R. Tolkien"),
+		splitName("Tolkien, J. R. R."),
+	)
+
+	for _, query := range []string{
+		"Tolkien J", "J.R.R. Tolkien", "tolk", "JRR", "",
+	} {
+		want := query != "JRR"
+		if got := matchesName(words, splitName(query)); got != want {
+			t.Errorf("matchesName(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestAuthorLetter(t *testing.T) {
+	for sort, want := range map[string]string{
+		"Tolkien, J. R. R.": "T",
+		"żeromski, Stefan":  "Z",
+		"Булгаков, Михаил":  "Б",
+		"[Anonymous]":       otherAuthorsLetter,
+		"":                  otherAuthorsLetter,
+	} {
+		if got := authorLetter(sort); got != want {
+			t.Errorf("authorLetter(%q) = %q, want %q", sort, got, want)
+		}
+	}
+}
@@ -0,0 +1,735 @@
+package booksdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const maxSavedSearchDepth = 8
+
+var (
+	ErrUnsupportedField = errors.New("unsupported search field")
+	ErrCalibreSyntax    = errors.New("invalid search syntax")
+)
+
+var calibreFieldName = regexp.MustCompile(`^#?[a-z_][a-z0-9_]*$`)
+
+// andFilter, orFilter and notFilter combine filters for the boolean
+// operators of the Calibre search language.
+type (
+	andFilter []queryFilter
+	orFilter  []queryFilter
+	notFilter struct{ filter queryFilter }
+)
+
+func (f andFilter) selectIds(entries *BookEntries, ctx context.Context) bookIdSet {
+	set := newFullBookIdSet(entries.NumBooks())
+
+	for _, filter := range f {
+		set.intersect(filter.selectIds(entries, ctx))
+	}
+
+	return set
+}
+
+func (f orFilter) selectIds(entries *BookEntries, ctx context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	for _, filter := range f {
+		set.union(filter.selectIds(entries, ctx))
+	}
+
+	return set
+}
+
+func (f notFilter) selectIds(entries *BookEntries, ctx context.Context) bookIdSet {
+	set := f.filter.selectIds(entries, ctx)
+	set.complement(entries.NumBooks())
+
+	return set
+}
+
+// setFilter selects a precomputed set of books, e.g. a saved search.
+type setFilter struct {
+	books bookIdSet
+}
+
+func (f setFilter) selectIds(*BookEntries, context.Context) bookIdSet {
+	return f.books.clone()
+}
+
+// textMatcher compares metadata text the way Calibre does: a case and
+// accent insensitive substring by default, the whole value with a leading
+// '=' and a case insensitive regular expression with a leading '~'. For
+// hierarchical values "=.Fiction" also matches "Fiction.Fantasy". Substrings
+// of Cyrillic and Greek text match in Latin spelling too.
+type textMatcher struct {
+	exact       bool
+	descendants bool
+	value       Word
+	pattern     *regexp.Regexp
+}
+
+func newTextMatcher(value string) (textMatcher, error) {
+	if expression, found := strings.CutPrefix(value, "~"); found {
+		pattern, err := regexp.Compile("(?i)" + expression)
+		if err != nil {
+			return textMatcher{}, fmt.Errorf("invalid regular expression: %w", err)
+		}
+
+		return textMatcher{pattern: pattern}, nil
+	}
+
+	if exact, found := strings.CutPrefix(value, "="); found {
+		name, descendants := strings.CutPrefix(exact, tagSeparator)
+
+		return textMatcher{
+			exact:       true,
+			descendants: descendants,
+			value:       normalizeWord(name),
+		}, nil
+	}
+
+	return textMatcher{value: normalizeWord(value)}, nil
+}
+
+func (m textMatcher) matches(text string) bool {
+	switch {
+	case m.pattern != nil:
+		return m.pattern.MatchString(text)
+	case m.descendants:
+		normalized := normalizeWord(text)
+
+		return normalized == m.value || strings.HasPrefix(
+			string(normalized),
+			string(m.value)+tagSeparator,
+		)
+	case m.exact:
+		return normalizeWord(text) == m.value
+	default:
+		normalized := normalizeWord(text)
+
+		return strings.Contains(string(normalized), string(m.value)) ||
+			strings.Contains(
+				string(transliterate(normalized)),
+				string(transliterate(m.value)),
+			)
+	}
+}
+
+type bookTexts func(entries *BookEntries, id BookEntryId) []string
+
+func titleTexts(entries *BookEntries, id BookEntryId) []string {
+	return []string{entries.books[id].Title}
+}
+
+func authorTexts(entries *BookEntries, id BookEntryId) []string {
+	texts := make([]string, len(entries.bookAuthors[id]))
+
+	for i, position := range entries.bookAuthors[id] {
+		texts[i] = entries.authors[position].name
+	}
+
+	return texts
+}
+
+func tagTexts(entries *BookEntries, id BookEntryId) []string {
+	texts := make([]string, len(entries.bookTags[id]))
+
+	for i, position := range entries.bookTags[id] {
+		texts[i] = entries.tags[position].name
+	}
+
+	return texts
+}
+
+func seriesTexts(entries *BookEntries, id BookEntryId) []string {
+	if position := entries.bookSeries[id]; position >= 0 {
+		return []string{entries.series[position].name}
+	}
+
+	return nil
+}
+
+func formatTexts(entries *BookEntries, id BookEntryId) []string {
+	texts := make([]string, len(entries.formats[id]))
+
+	for i, format := range entries.formats[id] {
+		texts[i] = format.Format
+	}
+
+	return texts
+}
+
+func languageTexts(entries *BookEntries, id BookEntryId) []string {
+	return entries.languages[id]
+}
+
+func publisherTexts(entries *BookEntries, id BookEntryId) []string {
+	if publisher := entries.publishers[id]; publisher != "" {
+		return []string{publisher}
+	}
+
+	return nil
+}
+
+// textFilter selects books with any value of one or more text fields
+// matching.
+type textFilter struct {
+	fields []bookTexts
+	match  textMatcher
+}
+
+func (f textFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	for id := range entries.books {
+		for _, texts := range f.fields {
+			if containsMatch(texts(entries, BookEntryId(id)), f.match) {
+				set.add(BookEntryId(id))
+
+				break
+			}
+		}
+	}
+
+	return set
+}
+
+func containsMatch(texts []string, match textMatcher) bool {
+	for _, text := range texts {
+		if match.matches(text) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type bookNumber func(entries *BookEntries, id BookEntryId) (float64, bool)
+
+func ratingNumber(entries *BookEntries, id BookEntryId) (float64, bool) {
+	return entries.ratings[id], entries.ratings[id] > 0
+}
+
+func seriesIndexNumber(entries *BookEntries, id BookEntryId) (float64, bool) {
+	return float64(entries.seriesIndexes[id]), entries.bookSeries[id] >= 0
+}
+
+// numberFilter compares a numeric field; books without a value never match.
+type numberFilter struct {
+	number     bookNumber
+	comparison numericComparison
+}
+
+func (f numberFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	for id := range entries.books {
+		number, found := f.number(entries, BookEntryId(id))
+		if found && f.comparison.matches(number) {
+			set.add(BookEntryId(id))
+		}
+	}
+
+	return set
+}
+
+// presenceFilter is Calibre's field:true and field:false.
+type presenceFilter struct {
+	present func(entries *BookEntries, id BookEntryId) bool
+	want    bool
+}
+
+func (f presenceFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	for id := range entries.books {
+		if f.present(entries, BookEntryId(id)) == f.want {
+			set.add(BookEntryId(id))
+		}
+	}
+
+	return set
+}
+
+// calibreField is a lookup name of Calibre's search language: how to parse
+// its values and how to tell whether a book has one at all.
+type calibreField struct {
+	parse   fieldParser
+	present func(entries *BookEntries, id BookEntryId) bool
+}
+
+func textField(fields ...bookTexts) calibreField {
+	return calibreField{
+		parse: func(value string, _ time.Time) (queryFilter, error) {
+			match, err := newTextMatcher(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return textFilter{fields: fields, match: match}, nil
+		},
+		present: func(entries *BookEntries, id BookEntryId) bool {
+			for _, texts := range fields {
+				if len(texts(entries, id)) > 0 {
+					return true
+				}
+			}
+
+			return false
+		},
+	}
+}
+
+func numberField(number bookNumber) calibreField {
+	return calibreField{
+		parse: func(value string, _ time.Time) (queryFilter, error) {
+			comparison, err := parseNumericComparison(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return numberFilter{number: number, comparison: comparison}, nil
+		},
+		present: func(entries *BookEntries, id BookEntryId) bool {
+			_, found := number(entries, id)
+
+			return found
+		},
+	}
+}
+
+var calibreDaysAgo = regexp.MustCompile(`^(\d+)daysago$`)
+
+// calibreDate rewrites Calibre's relative dates, such as thismonth and
+// 10daysago, into the forms parseDateRange understands.
+func calibreDate(value string, now time.Time) string {
+	var op string
+
+	for _, prefix := range [...]string{">=", "<=", ">", "<", "="} {
+		if rest, found := strings.CutPrefix(value, prefix); found {
+			op, value = prefix, rest
+
+			break
+		}
+	}
+
+	switch lowered := strings.ToLower(value); {
+	case lowered == "thismonth":
+		value = now.Format("2006-01")
+	case calibreDaysAgo.MatchString(lowered):
+		days, _ := strconv.Atoi(calibreDaysAgo.FindStringSubmatch(lowered)[1])
+		value = now.AddDate(0, 0, -days).Format(time.DateOnly)
+	}
+
+	return op + value
+}
+
+func dateField(field DateField) calibreField {
+	return calibreField{
+		parse: func(value string, now time.Time) (queryFilter, error) {
+			return parseDateRange(field, calibreDate(value, now), now)
+		},
+		present: func(entries *BookEntries, id BookEntryId) bool {
+			return !isUndefinedDate(entries.bookDate(field, id))
+		},
+	}
+}
+
+func identifierField(parse fieldParser) calibreField {
+	return calibreField{
+		parse: parse,
+		present: func(entries *BookEntries, id BookEntryId) bool {
+			return len(entries.identifiers[id]) > 0
+		},
+	}
+}
+
+// calibreFields maps the lookup names of Calibre's search language onto
+// filters. Text fields follow Calibre's matching rules rather than those of
+// the plain query language.
+var calibreFields = map[string]calibreField{
+	"title":     textField(titleTexts),
+	"authors":   textField(authorTexts),
+	"author":    textField(authorTexts),
+	"tags":      textField(tagTexts),
+	"tag":       textField(tagTexts),
+	"series":    textField(seriesTexts),
+	"formats":   textField(formatTexts),
+	"format":    textField(formatTexts),
+	"languages": textField(languageTexts),
+	"language":  textField(languageTexts),
+	"publisher": textField(publisherTexts),
+	"comments":  textField(descriptionTexts),
+	// description is not a Calibre field, but an alias for comments
+	// accepted by the simple syntax too.
+	"description": textField(descriptionTexts),
+
+	"rating":       numberField(ratingNumber),
+	"series_index": numberField(seriesIndexNumber),
+
+	"date":          dateField(DateAdded),
+	"timestamp":     dateField(DateAdded),
+	"pubdate":       dateField(DatePublished),
+	"last_modified": dateField(DateModified),
+
+	"isbn":        identifierField(identifierFieldParser("isbn")),
+	"identifier":  identifierField(parseTypedIdentifier),
+	"identifiers": identifierField(parseTypedIdentifier),
+}
+
+// anyTextFields are searched by terms without a field.
+var anyTextFields = []bookTexts{titleTexts, authorTexts, tagTexts, seriesTexts}
+
+type calibreToken struct {
+	field  string
+	value  string
+	quoted bool
+	paren  rune
+}
+
+func (t calibreToken) String() string {
+	switch {
+	case t.paren != 0:
+		return string(t.paren)
+	case t.field != "":
+		return t.field + ":" + t.value
+	default:
+		return t.value
+	}
+}
+
+func (t calibreToken) keyword() string {
+	if t.quoted || t.field != "" || t.paren != 0 {
+		return ""
+	}
+
+	switch keyword := strings.ToLower(t.value); keyword {
+	case "and", "or", "not":
+		return keyword
+	default:
+		return ""
+	}
+}
+
+func readQuoted(runes []rune, position int) (string, int, error) {
+	var value strings.Builder
+
+	for position++; position < len(runes); position++ {
+		switch r := runes[position]; r {
+		case '\\':
+			if position+1 < len(runes) {
+				position++
+				value.WriteRune(runes[position])
+			}
+		case '"':
+			return value.String(), position + 1, nil
+		default:
+			value.WriteRune(r)
+		}
+	}
+
+	return "", position, fmt.Errorf("%w: unterminated quote", ErrCalibreSyntax)
+}
+
+func isTokenEnd(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')'
+}
+
+// tokenizeCalibre splits a query into parentheses and terms. A term is a
+// bare or quoted value, optionally preceded by field: with the value itself
+// quoted as in title:"the hobbit".
+func tokenizeCalibre(query string) (tokens []calibreToken, err error) {
+	runes := []rune(query)
+
+	for position := 0; position < len(runes); {
+		r := runes[position]
+
+		switch {
+		case unicode.IsSpace(r):
+			position++
+
+			continue
+		case r == '(' || r == ')':
+			tokens = append(tokens, calibreToken{paren: r})
+			position++
+
+			continue
+		case r == '"':
+			var token calibreToken
+
+			token.value, position, err = readQuoted(runes, position)
+			if err != nil {
+				return nil, err
+			}
+
+			token.quoted = true
+			tokens = append(tokens, token)
+
+			continue
+		}
+
+		start := position
+		for position < len(runes) && !isTokenEnd(runes[position]) &&
+			runes[position] != ':' {
+			position++
+		}
+
+		token := calibreToken{value: string(runes[start:position])}
+
+		if position < len(runes) && runes[position] == ':' &&
+			calibreFieldName.MatchString(strings.ToLower(token.value)) {
+			token.field = strings.ToLower(token.value)
+			position++
+
+			if position < len(runes) && runes[position] == '"' {
+				token.value, position, err = readQuoted(runes, position)
+				if err != nil {
+					return nil, err
+				}
+
+				token.quoted = true
+				tokens = append(tokens, token)
+
+				continue
+			}
+
+			start = position
+		}
+
+		for position < len(runes) && !isTokenEnd(runes[position]) {
+			position++
+		}
+
+		token.value = string(runes[start:position])
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// calibreParser is a recursive descent parser for Calibre's search
+// language, where "or" binds loosest, "and" may be left out and "not"
+// negates the term or parenthesized group that follows.
+type calibreParser struct {
+	tokens   []calibreToken
+	position int
+	now      time.Time
+	searches map[string]string
+	depth    int
+	// entries resolve the custom columns queries refer to.
+	entries *BookEntries
+}
+
+func (p *calibreParser) peek() (calibreToken, bool) {
+	if p.position >= len(p.tokens) {
+		return calibreToken{}, false
+	}
+
+	return p.tokens[p.position], true
+}
+
+func (p *calibreParser) parseOr() (queryFilter, error) {
+	var filters orFilter
+
+	for {
+		filter, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, filter)
+
+		token, ok := p.peek()
+		if !ok || token.keyword() != "or" {
+			break
+		}
+
+		p.position++
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return filters, nil
+}
+
+func (p *calibreParser) parseAnd() (queryFilter, error) {
+	var filters andFilter
+
+	for {
+		filter, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, filter)
+
+		token, ok := p.peek()
+		if !ok || token.paren == ')' || token.keyword() == "or" {
+			break
+		}
+
+		if token.keyword() == "and" {
+			p.position++
+		}
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return filters, nil
+}
+
+func (p *calibreParser) parseNot() (queryFilter, error) {
+	token, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected end of query", ErrCalibreSyntax)
+	}
+
+	switch {
+	case token.keyword() == "not":
+		p.position++
+
+		filter, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return notFilter{filter: filter}, nil
+	case token.paren == '(':
+		p.position++
+
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if closing, ok := p.peek(); !ok || closing.paren != ')' {
+			return nil, fmt.Errorf("%w: missing ')'", ErrCalibreSyntax)
+		}
+
+		p.position++
+
+		return filter, nil
+	case token.paren == ')' || token.keyword() != "":
+		return nil, fmt.Errorf(
+			"%w: unexpected %q",
+			ErrCalibreSyntax,
+			token,
+		)
+	}
+
+	p.position++
+
+	return p.parseTerm(token)
+}
+
+func (p *calibreParser) parseTerm(token calibreToken) (queryFilter, error) {
+	switch {
+	case token.field == "":
+		match, err := newTextMatcher(token.value)
+		if err != nil {
+			return nil, err
+		}
+
+		return textFilter{fields: anyTextFields, match: match}, nil
+	case token.field == "search":
+		return p.parseSavedSearch(token.value)
+	case token.field == "content":
+		return newContentFilter(strings.TrimPrefix(token.value, "=")), nil
+	case strings.HasPrefix(token.field, customColumnPrefix):
+		return p.entries.parseCustomColumnFilter(
+			strings.TrimPrefix(token.field, customColumnPrefix),
+			token.value,
+			p.now,
+		)
+	}
+
+	field, found := calibreFields[token.field]
+	if !found {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedField, token.field)
+	}
+
+	switch strings.ToLower(token.value) {
+	case "true":
+		return presenceFilter{present: field.present, want: true}, nil
+	case "false":
+		return presenceFilter{present: field.present, want: false}, nil
+	}
+
+	filter, err := field.parse(token.value, p.now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s term: %w", token.field, err)
+	}
+
+	return filter, nil
+}
+
+// parseSavedSearch expands search:name, Calibre's reference to another
+// saved search, guarding against searches that refer to each other.
+func (p *calibreParser) parseSavedSearch(name string) (queryFilter, error) {
+	name = strings.TrimPrefix(name, "=")
+
+	query, found := p.searches[name]
+	if !found {
+		return nil, fmt.Errorf("unknown saved search %q", name)
+	}
+
+	if p.depth >= maxSavedSearchDepth {
+		return nil, fmt.Errorf("saved search %q nests too deeply", name)
+	}
+
+	return p.entries.parseCalibreQuery(query, p.now, p.searches, p.depth+1)
+}
+
+// parseCalibreQuery translates a query in Calibre's search language into a
+// filter of entries. searches holds the saved searches that search:name may
+// refer to.
+func (b *BookEntries) parseCalibreQuery(
+	query string,
+	now time.Time,
+	searches map[string]string,
+	depth int,
+) (queryFilter, error) {
+	tokens, err := tokenizeCalibre(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return andFilter{}, nil
+	}
+
+	parser := &calibreParser{
+		tokens:   tokens,
+		now:      now,
+		searches: searches,
+		depth:    depth,
+		entries:  b,
+	}
+
+	filter, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if token, ok := parser.peek(); ok {
+		return nil, fmt.Errorf(
+			"%w: unexpected %q",
+			ErrCalibreSyntax,
+			token,
+		)
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,281 @@
+package booksdb
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+var calibreTestNow = time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+func daysAgo(days int) time.Time {
+	return calibreTestNow.AddDate(0, 0, -days)
+}
+
+// newCalibreTestEntries builds a small library:
+//
+//	0 The Hobbit       Tolkien    Fiction.Fantasy, read  ★★★★★  EPUB, PDF
+//	1 Guards! Guards!  Pratchett  Fiction.Fantasy.Humor  ★★★★   EPUB, MOBI  Discworld 8
+//	2 Men at Arms      Pratchett  Humor                  -      -           Discworld 15
+//	3 White Teeth      Smith      Fiction                ★★★    AZW3
+func newCalibreTestEntries() *BookEntries {
+	entries := &BookEntries{
+		books: BookEntrySlice{
+			{
+				ID:          1,
+				Title:       "The Hobbit",
+				AddedAt:     daysAgo(400),
+				PublishedAt: time.Date(1937, time.September, 21, 0, 0, 0, 0, time.UTC),
+			},
+			{
+				ID:          2,
+				Title:       "Guards! Guards!",
+				AddedAt:     daysAgo(5),
+				PublishedAt: time.Date(1989, time.January, 1, 0, 0, 0, 0, time.UTC),
+			},
+			{
+				ID:          3,
+				Title:       "Men at Arms",
+				AddedAt:     daysAgo(40),
+				PublishedAt: time.Date(101, time.January, 1, 0, 0, 0, 0, time.UTC),
+			},
+			{
+				ID:          4,
+				Title:       "White Teeth",
+				AddedAt:     daysAgo(2),
+				PublishedAt: time.Date(2000, time.January, 27, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		bookIds: map[uint16]BookEntryId{1: 0, 2: 1, 3: 2, 4: 3},
+		authors: []author{
+			{name: "Terry Pratchett"},
+			{name: "Zadie Smith"},
+			{name: "J. R. R. Tolkien"},
+		},
+		bookAuthors: [][]int{{2}, {0}, {0}, {1}},
+		tags: []tag{
+			{name: "Fiction"},
+			{name: "Fiction.Fantasy"},
+			{name: "Fiction.Fantasy.Humor"},
+			{name: "Humor"},
+			{name: "read"},
+		},
+		bookTags:      [][]int{{1, 4}, {2}, {3}, {0}},
+		series:        []series{{name: "Discworld"}},
+		bookSeries:    []int{-1, 0, 0, -1},
+		seriesIndexes: []SeriesIndex{0, 8, 15, 0},
+		identifiers: [][]Identifier{
+			{{Type: "isbn", Value: "9780261102217"}},
+			nil,
+			nil,
+			nil,
+		},
+		ratings: []float64{5, 4, 0, 3},
+		formats: [][]BookFormat{
+			{{Format: "EPUB"}, {Format: "PDF"}},
+			{{Format: "EPUB"}, {Format: "MOBI"}},
+			nil,
+			{{Format: "AZW3"}},
+		},
+		languages:  [][]string{{"eng"}, {"eng"}, {"eng", "pol"}, {"eng"}},
+		publishers: []string{"Allen & Unwin", "Gollancz", "", "Hamish Hamilton"},
+		customColumns: []customColumn{
+			{
+				CustomColumn: CustomColumn{Label: "shelf", Datatype: customText},
+				values: [][]customValue{
+					{{text: "Favourites"}},
+					nil,
+					nil,
+					{{text: "To read"}},
+				},
+			},
+		},
+		customLabels: map[string]int{"shelf": 0},
+		descriptions: []string{
+			"Bilbo Baggins is swept into a quest to reclaim a dragon's treasure.",
+			"A secret society summons a dragon to Ankh-Morpork.",
+			"",
+			"Two families in London.",
+		},
+	}
+
+	entries.descriptionIndex = newDescriptionIndex(entries.descriptions)
+
+	for field := range entries.dateIndexes {
+		dates := make([]time.Time, entries.NumBooks())
+
+		for id := range dates {
+			dates[id] = entries.bookDate(DateField(field), BookEntryId(id))
+		}
+
+		entries.dateIndexes[field] = newDateIndex(dates)
+	}
+
+	return entries
+}
+
+func TestParseCalibreQuery(t *testing.T) {
+	entries := newCalibreTestEntries()
+	searches := map[string]string{
+		"Humor":  "tags:=humor",
+		"Loop":   "search:Loop",
+		"Unread": "not tags:=read",
+	}
+
+	queryCases := []struct {
+		query string
+		want  []BookEntryId
+	}{
+		{"", []BookEntryId{0, 1, 2, 3}},
+		{"hobbit", []BookEntryId{0}},
+		{"pratchett", []BookEntryId{1, 2}},
+		{"title:guards", []BookEntryId{1}},
+		{`title:"men at"`, []BookEntryId{2}},
+		{"tags:fantasy", []BookEntryId{0, 1}},
+		{`tags:"=Fiction.Fantasy"`, []BookEntryId{0}},
+		{"tags:=fiction.fantasy", []BookEntryId{0}},
+		{"tags:fantasy and not tags:read", []BookEntryId{1}},
+		{"tags:fantasy NOT tags:read", []BookEntryId{1}},
+		{"series:discworld or authors:smith", []BookEntryId{1, 2, 3}},
+		{"not (series:discworld or authors:smith)", []BookEntryId{0}},
+		{"(title:hobbit or title:teeth) authors:tolkien", []BookEntryId{0}},
+		{"search:Humor", []BookEntryId{2}},
+		{`search:"Unread" and tags:fiction`, []BookEntryId{1, 3}},
+	}
+
+	for _, tc := range queryCases {
+		filter, err := entries.parseCalibreQuery(tc.query, calibreTestNow, searches, 0)
+		if err != nil {
+			t.Errorf("parseCalibreQuery(%q) error = %v", tc.query, err)
+
+			continue
+		}
+
+		if got := filter.selectIds(entries, context.Background()).ids(); !slices.Equal(got, tc.want) {
+			t.Errorf("parseCalibreQuery(%q) selected %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	for _, query := range []string{
+		"cover:true",
+		`title:"~["`,
+		"(tags:read",
+		"tags:read)",
+		`title:"open`,
+		"tags:read or",
+		"search:Missing",
+		"search:Loop",
+	} {
+		if _, err := entries.parseCalibreQuery(query, calibreTestNow, searches, 0); err == nil {
+			t.Errorf("parseCalibreQuery(%q) error = nil, want an error", query)
+		}
+	}
+}
+
+// TestCalibreCompatibility runs searches in the forms given in the "Searching
+// and sorting" chapter of the Calibre manual.
+func TestCalibreCompatibility(t *testing.T) {
+	entries := newCalibreTestEntries()
+
+	compatibilityCases := []struct {
+		query string
+		want  []BookEntryId
+	}{
+		// Contains, equality and regular expressions.
+		{"guards", []BookEntryId{1}},
+		{"TITLE:hobbit", []BookEntryId{0}},
+		{"authors:zadie", []BookEntryId{3}},
+		{"authors:=Pratchett", nil},
+		{`authors:"=Terry Pratchett"`, []BookEntryId{1, 2}},
+		{`title:"~^the"`, []BookEntryId{0}},
+		{`title:"~^(the|men)\\s"`, []BookEntryId{0, 2}},
+		{`title:~teeth$`, []BookEntryId{3}},
+		{"publisher:unwin", []BookEntryId{0}},
+		{"formats:epub", []BookEntryId{0, 1}},
+		{"formats:=pdf", []BookEntryId{0}},
+		{"languages:pol", []BookEntryId{2}},
+
+		// Hierarchical items.
+		{`tags:"=Fiction"`, []BookEntryId{3}},
+		{`tags:"=.Fiction"`, []BookEntryId{0, 1, 3}},
+		{`tags:"=.Fiction.Fantasy"`, []BookEntryId{0, 1}},
+
+		// Boolean operators.
+		{"formats:epub and not tags:read", []BookEntryId{1}},
+		{"not tags:read and formats:true", []BookEntryId{1, 3}},
+		{"tags:humor or (authors:smith and rating:>=3)", []BookEntryId{1, 2, 3}},
+		{"series:discworld and not (rating:4 or formats:false)", nil},
+		{"NOT series:true", []BookEntryId{0, 3}},
+
+		// Numeric comparisons.
+		{"rating:>=4", []BookEntryId{0, 1}},
+		{"rating:4", []BookEntryId{1}},
+		{"rating:<4", []BookEntryId{3}},
+		{"rating:!=5", []BookEntryId{1, 3}},
+		{"series_index:>10", []BookEntryId{2}},
+
+		// Dates.
+		{"pubdate:<1990", []BookEntryId{0, 1}},
+		{"pubdate:>=2000", []BookEntryId{3}},
+		{"pubdate:1989", []BookEntryId{1}},
+		{"date:>10daysago", []BookEntryId{1, 3}},
+		{"date:<30daysago", []BookEntryId{0, 2}},
+		{"date:thismonth", []BookEntryId{1, 3}},
+
+		// Presence tests.
+		{"rating:true", []BookEntryId{0, 1, 3}},
+		{"rating:false", []BookEntryId{2}},
+		{"series:true", []BookEntryId{1, 2}},
+		{"publisher:false", []BookEntryId{2}},
+		{"pubdate:false", []BookEntryId{2}},
+		{"identifiers:true", []BookEntryId{0}},
+		{"#shelf:true", []BookEntryId{0, 3}},
+		{"#shelf:false", []BookEntryId{1, 2}},
+		{`#shelf:"=to read"`, []BookEntryId{3}},
+		{"comments:dragon", []BookEntryId{0, 1}},
+		{"comments:false", []BookEntryId{2}},
+	}
+
+	for _, tc := range compatibilityCases {
+		filter, err := entries.parseCalibreQuery(tc.query, calibreTestNow, nil, 0)
+		if err != nil {
+			t.Errorf("parseCalibreQuery(%q) error = %v", tc.query, err)
+
+			continue
+		}
+
+		if got := filter.selectIds(entries, context.Background()).ids(); !slices.Equal(got, tc.want) {
+			t.Errorf("%q selected %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestScopeFilter(t *testing.T) {
+	entries := newCalibreTestEntries()
+	entries.libraryQueries = map[string]string{"Discworld": "series:discworld"}
+	entries.searchKeys = newSortKeys(language.Und)
+
+	scope, err := entries.LibraryScope("Discworld", context.Background())
+	if err != nil {
+		t.Fatalf("LibraryScope error = %v", err)
+	}
+
+	if got := scope.filter([]BookEntryId{0, 1, 2, 3}); !slices.Equal(got, []BookEntryId{1, 2}) {
+		t.Errorf("scope.filter = %v, want [1 2]", got)
+	}
+
+	if _, err := entries.LibraryScope("Missing", context.Background()); err == nil {
+		t.Error("LibraryScope(\"Missing\") error = nil, want an error")
+	}
+
+	if _, found := entries.Details(1, scope); found {
+		t.Error("Details found a book outside the virtual library")
+	}
+
+	if _, found := entries.Details(2, scope); !found {
+		t.Error("Details did not find a book in the virtual library")
+	}
+}
@@ -0,0 +1,74 @@
+package booksdb
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+var ErrUnknownLocale = errors.New("unknown locale")
+
+// ParseLocale parses the BCP 47 tag of the language names are sorted in,
+// e.g. "pl" or "cs". An empty name selects the root collation, which suits
+// most languages written in Latin, Cyrillic or Greek.
+func ParseLocale(name string) (language.Tag, error) {
+	if name == "" {
+		return language.Und, nil
+	}
+
+	locale, err := language.Parse(name)
+	if err != nil {
+		return language.Und, fmt.Errorf("%w %q: %w", ErrUnknownLocale, name, err)
+	}
+
+	return locale, nil
+}
+
+// sortKeys turns names into collation keys of a locale, so "Łukasz" sorts
+// after "Lem" in Polish and "Chmel" after "Hrabal" in Czech. Numbers are
+// compared by value, so "Volume 2" comes before "Volume 10".
+//
+// Keys are computed once while the library is indexed and compared with
+// bytes.Compare afterwards. A collator is not safe for concurrent use, so
+// every index build makes its own.
+type sortKeys struct {
+	collator *collate.Collator
+	buffer   collate.Buffer
+}
+
+func newSortKeys(locale language.Tag) *sortKeys {
+	return &sortKeys{collator: collate.New(locale, collate.Numeric)}
+}
+
+// key returns the collation key of a name. Keys remain valid for the life
+// of sortKeys.
+func (k *sortKeys) key(name string) []byte {
+	return k.collator.KeyFromString(&k.buffer, name)
+}
+
+// compareTitles orders two books by title.
+func (b *BookEntries) compareTitles(left, right BookEntryId) int {
+	return compareKeys(
+		b.titleKeys[left],
+		b.titleKeys[right],
+		b.books[left].Title,
+		b.books[right].Title,
+	)
+}
+
+// sortByTitle returns a copy of ids ordered by title.
+func (b *BookEntries) sortByTitle(ids []BookEntryId) []BookEntryId {
+	return slices.SortedFunc(slices.Values(ids), b.compareTitles)
+}
+
+// compareKeys orders collation keys, breaking ties between equal keys by
+// the names they were made of so the order is stable.
+func compareKeys(leftKey, rightKey []byte, left, right string) int {
+	return cmp.Or(bytes.Compare(leftKey, rightKey), strings.Compare(left, right))
+}
@@ -0,0 +1,56 @@
+package booksdb
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSortKeys(t *testing.T) {
+	sortCases := []struct {
+		locale string
+		names  []string
+		want   []string
+	}{
+		{
+			"",
+			[]string{"Zadie", "Łukasz", "adam", "Lem", "Żeromski"},
+			[]string{"adam", "Lem", "Łukasz", "Zadie", "Żeromski"},
+		},
+		{
+			"pl",
+			[]string{"Łukasz", "Lutz", "Lem", "Zadie", "Żeromski", "Źródło"},
+			[]string{"Lem", "Lutz", "Łukasz", "Zadie", "Źródło", "Żeromski"},
+		},
+		{
+			"cs",
+			[]string{"Chmel", "Hrabal", "Ibsen", "Cibulka"},
+			[]string{"Cibulka", "Hrabal", "Chmel", "Ibsen"},
+		},
+		{
+			"",
+			[]string{"Volume 10", "Volume 2", "volume 1"},
+			[]string{"volume 1", "Volume 2", "Volume 10"},
+		},
+	}
+
+	for _, tc := range sortCases {
+		locale, err := ParseLocale(tc.locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys := newSortKeys(locale)
+		got := slices.SortedFunc(slices.Values(tc.names), func(left, right string) int {
+			return compareKeys(keys.key(left), keys.key(right), left, right)
+		})
+
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("sorted in %q = %q, want %q", tc.locale, got, tc.want)
+		}
+	}
+
+	if _, err := ParseLocale("not a locale"); !errors.Is(err, ErrUnknownLocale) {
+		t.Errorf("ParseLocale error = %v, want %v", err, ErrUnknownLocale)
+	}
+}
@@ -1,8 +1,10 @@
 package booksdb
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 )
 
 type Command byte
@@ -10,38 +12,63 @@ type Command byte
 const (
 	Unknown Command = iota
 	SearchTitle
+	SearchQuery
 )
 
 func NewCommand(cmd string) Command {
 	switch cmd {
 	case "title":
 		return SearchTitle
+	case "search":
+		return SearchQuery
 	default:
 		return Unknown
 	}
 }
 
-type CommandFunc func(index *BookEntries, args []string) (BookEntrySlice, error)
+// Catalog is what commands search. *BookEntries implements it whichever
+// Searcher its titles are indexed with.
+type Catalog interface {
+	SearchTitles(words []string) (BookEntrySlice, error)
+	Search(
+		query string,
+		ctx context.Context,
+		options SearchOptions,
+	) (SearchResults, error)
+}
+
+type CommandFunc func(catalog Catalog, args []string) (BookEntrySlice, error)
 
-func UnknownCommand(index *BookEntries, args []string) (BookEntrySlice, error) {
+func UnknownCommand(catalog Catalog, args []string) (BookEntrySlice, error) {
 	return nil, fmt.Errorf("unknown command")
 }
 
 func SelectEntriesByTitleCommand(
-	entries *BookEntries,
+	catalog Catalog,
 	args []string,
 ) (selected BookEntrySlice, err error) {
-	log.Printf("performing title search for %+v", args)
-	found := entries.titlesIndex.findSimilar(normalizeWordSlice(args))
-	selected = make(BookEntrySlice, len(found))
+	slog.Info("performing title search", "args", args)
 
-	for i, bookId := range found {
-		selected[i] = entries.books[bookId]
-	}
+	return catalog.SearchTitles(args)
+}
+
+// SelectEntriesByQueryCommand treats args as a search query, so field
+// filters like added:<30d can be combined with title words.
+func SelectEntriesByQueryCommand(
+	catalog Catalog,
+	args []string,
+) (selected BookEntrySlice, err error) {
+	slog.Info("performing query search", "args", args)
+
+	results, err := catalog.Search(
+		strings.Join(args, " "),
+		context.Background(),
+		SearchOptions{},
+	)
 
-	return selected, nil
+	return results.Books, err
 }
 
 var CommandMap = [...]CommandFunc{
-	UnknownCommand, SelectEntriesByTitleCommand,
+	UnknownCommand, SelectEntriesByTitleCommand, SelectEntriesByQueryCommand,
 }
@@ -0,0 +1,273 @@
+package booksdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	contentDbName = "full-text-search.db"
+
+	snippetMatchStart = "\x01"
+	snippetMatchEnd   = "\x02"
+	snippetEllipsis   = "…"
+	snippetTokens     = 12
+	// fallbackContext is the number of characters shown before the first
+	// match when a snippet is cut out of plain text.
+	fallbackContext = 80
+	fallbackLength  = 240
+)
+
+var ErrContentUnavailable = errors.New("content search is not available")
+
+// contentSearcher finds the books, by Calibre id, whose text contains every
+// term and quotes the passage that matched. Snippets may be nil.
+type contentSearcher interface {
+	search(ctx context.Context, terms []string) (map[uint16]Snippet, error)
+}
+
+// SnippetPart is a piece of text quoted from a book; Match marks the parts
+// that matched the search.
+type SnippetPart struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// Snippet is a passage around the first match inside a book.
+type Snippet []SnippetPart
+
+// contentStore searches the text Calibre 6+ extracts from book files into
+// full-text-search.db next to metadata.db, through its FTS5 index.
+type contentStore struct {
+	db   *sql.DB
+	path string
+}
+
+// openContentStore opens the full-text database read-only. Libraries
+// without one have no content store, which is not an error. Calibre builds
+// its index with a tokenizer of its own that SQLite elsewhere lacks; such
+// an index cannot be queried, and scanning the text of every book for each
+// search instead would not scale, so it is reported as unavailable.
+func openContentStore(
+	dbPath string,
+	ctx context.Context,
+) (*contentStore, error) {
+	path, err := filepath.Abs(filepath.Join(filepath.Dir(dbPath), contentDbName))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	dsn := url.URL{Scheme: "file", Path: path, RawQuery: "mode=ro"}
+
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("error opening %q: %w", path, err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("error opening %q: %w", path, err)
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		`SELECT rowid FROM books_fts WHERE books_fts MATCH '"probe"' LIMIT 1`,
+	); err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf(
+			"%w: cannot query the index of %q: %w",
+			ErrContentUnavailable,
+			path,
+			err,
+		)
+	}
+
+	return &contentStore{db: db, path: path}, nil
+}
+
+func (s *contentStore) Close() error {
+	return s.db.Close()
+}
+
+// ftsQuery quotes every term, so FTS5 treats it as a phrase rather than
+// query syntax, and requires all of them.
+func ftsQuery(terms []string) string {
+	phrases := make([]string, len(terms))
+
+	for i, term := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+
+	return strings.Join(phrases, " ")
+}
+
+func parseFtsSnippet(raw string) (snippet Snippet) {
+	for raw != "" {
+		before, rest, found := strings.Cut(raw, snippetMatchStart)
+		if before != "" {
+			snippet = append(snippet, SnippetPart{Text: before})
+		}
+
+		if !found {
+			break
+		}
+
+		match, after, _ := strings.Cut(rest, snippetMatchEnd)
+		snippet = append(snippet, SnippetPart{Text: match, Match: true})
+		raw = after
+	}
+
+	return snippet
+}
+
+func (s *contentStore) queryFts(
+	ctx context.Context,
+	terms []string,
+) (*sql.Rows, error) {
+	return s.db.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			"SELECT text.book, snippet(books_fts, 0, char(1), char(2), '%s', %d) "+
+				"FROM books_fts "+
+				"JOIN books_text AS text ON text.id = books_fts.rowid "+
+				"WHERE books_fts MATCH ? "+
+				"ORDER BY rank",
+			snippetEllipsis,
+			snippetTokens,
+		),
+		ftsQuery(terms),
+	)
+}
+
+// search returns a snippet for every book, by Calibre id, whose text
+// contains all terms. A book with several formats is reported once.
+func (s *contentStore) search(
+	ctx context.Context,
+	terms []string,
+) (map[uint16]Snippet, error) {
+	rows, err := s.queryFts(ctx, terms)
+	if err != nil {
+		return nil, fmt.Errorf("error searching %q: %w", s.path, err)
+	}
+	defer rows.Close()
+
+	matches := make(map[uint16]Snippet)
+
+	for rows.Next() {
+		var (
+			book int64
+			raw  string
+		)
+
+		if err := rows.Scan(&book, &raw); err != nil {
+			return nil, fmt.Errorf("error searching %q: %w", s.path, err)
+		}
+
+		if _, found := matches[uint16(book)]; !found {
+			matches[uint16(book)] = parseFtsSnippet(raw)
+		}
+	}
+
+	return matches, rows.Err()
+}
+
+// contentResult keeps what a content filter found, so snippets and errors
+// reach the search results after the filter was evaluated.
+type contentResult struct {
+	snippets map[BookEntryId]Snippet
+	err      error
+}
+
+// contentFilter selects books whose text contains every term.
+type contentFilter struct {
+	terms  []string
+	result *contentResult
+}
+
+func newContentFilter(terms ...string) contentFilter {
+	return contentFilter{terms: terms, result: &contentResult{}}
+}
+
+func (f contentFilter) selectIds(entries *BookEntries, ctx context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	if entries.content == nil {
+		f.result.err = ErrContentUnavailable
+
+		return set
+	}
+
+	matches, err := entries.content.search(ctx, f.terms)
+	if err != nil {
+		f.result.err = err
+
+		return set
+	}
+
+	f.result.snippets = make(map[BookEntryId]Snippet, len(matches))
+
+	for book, snippet := range matches {
+		if entryId, found := entries.bookIds[book]; found {
+			set.add(entryId)
+
+			if snippet != nil {
+				f.result.snippets[entryId] = snippet
+			}
+		}
+	}
+
+	return set
+}
+
+func parseContentFilter(value string, _ time.Time) (queryFilter, error) {
+	return newContentFilter(value), nil
+}
+
+// contentResults returns the content filters of an evaluated filter tree.
+// Negated filters are skipped, as the books they select have no match to
+// quote.
+func contentResults(filter queryFilter) (results []*contentResult) {
+	switch f := filter.(type) {
+	case contentFilter:
+		results = append(results, f.result)
+	case andFilter:
+		for _, child := range f {
+			results = append(results, contentResults(child)...)
+		}
+	case orFilter:
+		for _, child := range f {
+			results = append(results, contentResults(child)...)
+		}
+	}
+
+	return results
+}
+
+// HasContent reports whether the books' text can be searched.
+func (b *BookEntries) HasContent() bool {
+	return b.content != nil
+}
+
+// ContentProgress reports how far the text of the books has been indexed,
+// when the browser indexes it rather than Calibre.
+func (b *BookEntries) ContentProgress() (IndexProgress, bool) {
+	if epub, ok := b.content.(*epubIndex); ok {
+		return epub.Progress(), true
+	}
+
+	return IndexProgress{}, false
+}
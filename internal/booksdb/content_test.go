@@ -0,0 +1,209 @@
+package booksdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeContentDb writes a full-text-search.db into dir with the schema
+// Calibre gives it, indexed with the unicode61 tokenizer. When calibre is
+// set, the index then names Calibre's own tokenizer, as real ones do.
+func writeContentDb(t *testing.T, dir string, calibre bool) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(dir, contentDbName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	statements := []string{
+		`CREATE TABLE books_text (
+			id INTEGER PRIMARY KEY,
+			book INTEGER NOT NULL,
+			timestamp REAL NOT NULL DEFAULT 0,
+			format TEXT NOT NULL COLLATE NOCASE,
+			format_size INTEGER NOT NULL DEFAULT 0,
+			format_hash TEXT NOT NULL DEFAULT '',
+			text_size INTEGER NOT NULL DEFAULT 0,
+			text_hash TEXT NOT NULL DEFAULT '',
+			searchable_text TEXT NOT NULL DEFAULT '',
+			err_msg TEXT DEFAULT '',
+			UNIQUE(book, format)
+		)`,
+		`CREATE VIRTUAL TABLE books_fts USING fts5(
+			searchable_text,
+			content = 'books_text',
+			content_rowid = 'id',
+			tokenize = 'unicode61 remove_diacritics 2'
+		)`,
+		`INSERT INTO books_text (book, format, searchable_text) VALUES
+			(1, 'EPUB', 'In a hole in the ground there lived a hobbit.'),
+			(1, 'PDF', 'In a hole in the ground there lived a hobbit.'),
+			(2, 'EPUB', 'Никогда не разговаривайте с неизвестными.'),
+			(3, 'EPUB', 'The Librarian said Ook and went back to the hole.')`,
+		`INSERT INTO books_fts (books_fts) VALUES ('rebuild')`,
+	}
+
+	if calibre {
+		statements = append(
+			statements,
+			`PRAGMA writable_schema = ON`,
+			`UPDATE sqlite_master
+				SET sql = replace(sql, 'unicode61', 'calibre')
+				WHERE name = 'books_fts'`,
+		)
+	}
+
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newContentTestStore opens a full-text-search.db SQLite can query.
+func newContentTestStore(t *testing.T) *contentStore {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeContentDb(t, dir, false)
+
+	store, err := openContentStore(
+		filepath.Join(dir, "metadata.db"),
+		context.Background(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func snippetMatches(snippet Snippet) (matches []string) {
+	for _, part := range snippet {
+		if part.Match {
+			matches = append(matches, part.Text)
+		}
+	}
+
+	return matches
+}
+
+func TestContentStoreSearch(t *testing.T) {
+	store := newContentTestStore(t)
+
+	if _, err := store.db.Exec(
+		"DELETE FROM books_text",
+	); err == nil {
+		t.Error("full-text database was opened writable")
+	}
+
+	contentCases := []struct {
+		terms   []string
+		books   []uint16
+		matches []string
+	}{
+		{[]string{"hobbit"}, []uint16{1}, []string{"hobbit"}},
+		{[]string{"hole"}, []uint16{1, 3}, []string{"hole"}},
+		{[]string{"hole", "ook"}, []uint16{3}, []string{"Ook", "hole"}},
+		{[]string{"неизвестными"}, []uint16{2}, []string{"неизвестными"}},
+		{[]string{`"quoted" OR`}, nil, nil},
+	}
+
+	for _, tc := range contentCases {
+		found, err := store.search(context.Background(), tc.terms)
+		if err != nil {
+			t.Errorf("search(%q) error = %v", tc.terms, err)
+
+			continue
+		}
+
+		books := make([]uint16, 0, len(found))
+		for book := range found {
+			books = append(books, book)
+		}
+
+		slices.Sort(books)
+
+		if !slices.Equal(books, tc.books) && len(books)+len(tc.books) > 0 {
+			t.Errorf("search(%q) = %v, want %v", tc.terms, books, tc.books)
+
+			continue
+		}
+
+		if len(tc.books) == 0 {
+			continue
+		}
+
+		got := snippetMatches(found[tc.books[0]])
+		if !slices.Equal(got, tc.matches) {
+			t.Errorf(
+				"search(%q) highlighted %q, want %q",
+				tc.terms, got, tc.matches,
+			)
+		}
+	}
+}
+
+func TestOpenContentStoreCalibreTokenizer(t *testing.T) {
+	dir := t.TempDir()
+	writeContentDb(t, dir, true)
+
+	dbPath := filepath.Join(dir, "metadata.db")
+
+	store, err := openContentStore(dbPath, context.Background())
+	if !errors.Is(err, ErrContentUnavailable) {
+		t.Errorf("openContentStore() = %v, %v, want ErrContentUnavailable", store, err)
+	}
+
+	repo, err := NewBookRepository(
+		dbPath,
+		context.Background(),
+		RepositoryOptions{CacheDir: dir},
+	)
+	if err != nil {
+		t.Fatalf("NewBookRepository error = %v", err)
+	}
+
+	if repo.content != nil || repo.epub == nil {
+		t.Errorf("content = %v, epub = %v, want EPUBs indexed instead", repo.content, repo.epub)
+	}
+}
+
+func TestOpenContentStoreMissing(t *testing.T) {
+	store, err := openContentStore(
+		filepath.Join(t.TempDir(), "metadata.db"),
+		context.Background(),
+	)
+	if store != nil || err != nil {
+		t.Errorf("openContentStore without %s = %v, %v, want nil, nil", contentDbName, store, err)
+	}
+}
+
+func TestContentFilterCancelled(t *testing.T) {
+	entries := &BookEntries{
+		books:   make(BookEntrySlice, 1),
+		bookIds: map[uint16]BookEntryId{1: 0},
+		content: newContentTestStore(t),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	filter := newContentFilter("hobbit")
+	if found := filter.selectIds(entries, ctx); found.count() != 0 {
+		t.Errorf("selectIds after cancel = %v", found.ids())
+	}
+
+	if !errors.Is(filter.result.err, context.Canceled) {
+		t.Errorf("error = %v, want %v", filter.result.err, context.Canceled)
+	}
+}
@@ -0,0 +1,547 @@
+package booksdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	customText        = "text"
+	customEnumeration = "enumeration"
+	customBool        = "bool"
+	customInt         = "int"
+	customFloat       = "float"
+	customRating      = "rating"
+	customDatetime    = "datetime"
+	customSeries      = "series"
+	customComments    = "comments"
+
+	customColumnPrefix = "#"
+	ratingScale        = 2
+	multipleSeparator  = ", "
+)
+
+var ErrUnknownColumn = errors.New("unknown custom column")
+
+var customDatetimeLayouts = [...]string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// CustomColumn describes a user defined Calibre column, referred to in
+// queries by its label with a leading '#'.
+type CustomColumn struct {
+	Id         int64  `json:"id"`
+	Label      string `json:"label"`
+	Name       string `json:"name"`
+	Datatype   string `json:"datatype"`
+	IsMultiple bool   `json:"is_multiple"`
+
+	normalized bool
+}
+
+// BookCustomValue is the value of a custom column for one book. Value holds
+// the native value (a slice for multiple-value columns), Display the text
+// shown in the UI.
+type BookCustomValue struct {
+	Label    string `json:"label"`
+	Name     string `json:"name"`
+	Datatype string `json:"datatype"`
+	Display  string `json:"display"`
+	Value    any    `json:"value"`
+}
+
+type customValue struct {
+	text   string
+	number float64
+	flag   bool
+	at     time.Time
+}
+
+type customColumn struct {
+	CustomColumn
+
+	values [][]customValue
+}
+
+func isSupportedCustomDatatype(datatype string) bool {
+	switch datatype {
+	case customText, customEnumeration, customBool, customInt, customFloat,
+		customRating, customDatetime, customSeries, customComments:
+		return true
+	default:
+		return false
+	}
+}
+
+// valuesQuery reads the values of the column. Normalized columns keep
+// distinct values in custom_column_N and link them to books through
+// books_custom_column_N_link, whose extra column holds the series index.
+func (c *customColumn) valuesQuery() string {
+	if !c.normalized {
+		return fmt.Sprintf(
+			"SELECT book, value, NULL FROM custom_column_%d",
+			c.Id,
+		)
+	}
+
+	extra := "NULL"
+	if c.Datatype == customSeries {
+		extra = "link.extra"
+	}
+
+	return fmt.Sprintf(
+		"SELECT link.book, value.value, %s "+
+			"FROM books_custom_column_%d_link AS link "+
+			"JOIN custom_column_%d AS value ON value.id = link.value "+
+			"ORDER BY link.id",
+		extra, c.Id, c.Id,
+	)
+}
+
+func parseCustomDatetime(raw string) (time.Time, error) {
+	for _, layout := range customDatetimeLayouts {
+		if at, err := time.Parse(layout, raw); err == nil {
+			return at, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid datetime %q", raw)
+}
+
+func toFloat(raw any) (float64, error) {
+	switch value := raw.(type) {
+	case int64:
+		return float64(value), nil
+	case float64:
+		return value, nil
+	case bool:
+		if value {
+			return 1, nil
+		}
+
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(value, 64)
+	case []byte:
+		return strconv.ParseFloat(string(value), 64)
+	default:
+		return 0, fmt.Errorf("unexpected number %T", raw)
+	}
+}
+
+func (c *customColumn) convert(
+	raw any,
+	extra sql.NullFloat64,
+) (value customValue, err error) {
+	switch c.Datatype {
+	case customInt, customFloat, customRating:
+		value.number, err = toFloat(raw)
+	case customBool:
+		value.number, err = toFloat(raw)
+		value.flag = value.number != 0
+	case customDatetime:
+		switch at := raw.(type) {
+		case time.Time:
+			value.at = at
+		case string:
+			value.at, err = parseCustomDatetime(at)
+		case []byte:
+			value.at, err = parseCustomDatetime(string(at))
+		default:
+			err = fmt.Errorf("unexpected datetime %T", raw)
+		}
+	default:
+		switch text := raw.(type) {
+		case string:
+			value.text = text
+		case []byte:
+			value.text = string(text)
+		default:
+			value.text = fmt.Sprint(raw)
+		}
+
+		value.number = extra.Float64
+	}
+
+	return value, err
+}
+
+func (c *customColumn) load(
+	ctx context.Context,
+	db *sql.DB,
+	bookIds map[uint16]BookEntryId,
+) error {
+	rows, err := db.QueryContext(ctx, c.valuesQuery())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			book  int64
+			raw   any
+			extra sql.NullFloat64
+		)
+
+		if err := rows.Scan(&book, &raw, &extra); err != nil {
+			return err
+		}
+
+		entryId, found := bookIds[uint16(book)]
+		if !found || raw == nil {
+			continue
+		}
+
+		value, err := c.convert(raw, extra)
+		if err != nil {
+			Logger(ctx).Warn(
+				"skipping invalid custom column value",
+				"column", c.Label,
+				"book", book,
+				"error", err,
+			)
+
+			continue
+		}
+
+		c.values[entryId] = append(c.values[entryId], value)
+	}
+
+	return rows.Err()
+}
+
+func (b *BookEntries) loadCustomColumns(
+	repo *BookRepository,
+	ctx context.Context,
+) error {
+	rows, err := repo.CustomColumns(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing custom columns: %w", err)
+	}
+
+	b.customColumns = make([]customColumn, 0, len(rows))
+	b.customLabels = make(map[string]int, len(rows))
+
+	for _, row := range rows {
+		if !isSupportedCustomDatatype(row.Datatype) {
+			continue
+		}
+
+		column := customColumn{
+			CustomColumn: CustomColumn{
+				Id:         row.ID,
+				Label:      row.Label,
+				Name:       row.Name,
+				Datatype:   row.Datatype,
+				IsMultiple: row.IsMultiple,
+				normalized: row.Normalized,
+			},
+			values: make([][]customValue, len(b.books)),
+		}
+
+		if err := column.load(ctx, repo.db, b.bookIds); err != nil {
+			return fmt.Errorf(
+				"error reading custom column #%s: %w",
+				row.Label,
+				err,
+			)
+		}
+
+		b.customLabels[strings.ToLower(row.Label)] = len(b.customColumns)
+		b.customColumns = append(b.customColumns, column)
+	}
+
+	return nil
+}
+
+func formatRating(value float64) string {
+	stars := int(value) / ratingScale
+	display := strings.Repeat("★", stars)
+
+	if int(value)%ratingScale != 0 {
+		display += "½"
+	}
+
+	return display
+}
+
+func (c *customColumn) display(value customValue) string {
+	switch c.Datatype {
+	case customInt, customFloat:
+		return strconv.FormatFloat(value.number, 'f', -1, 64)
+	case customRating:
+		return formatRating(value.number)
+	case customBool:
+		if value.flag {
+			return "Yes"
+		}
+
+		return "No"
+	case customDatetime:
+		return value.at.Format(time.DateOnly)
+	case customSeries:
+		return fmt.Sprintf("%s [%s]", value.text, SeriesIndex(value.number))
+	default:
+		return value.text
+	}
+}
+
+func (c *customColumn) native(value customValue) any {
+	switch c.Datatype {
+	case customInt:
+		return int64(value.number)
+	case customFloat:
+		return value.number
+	case customRating:
+		return value.number / ratingScale
+	case customBool:
+		return value.flag
+	case customDatetime:
+		return value.at
+	case customSeries:
+		return BookSeries{Name: value.text, Index: SeriesIndex(value.number)}
+	default:
+		return value.text
+	}
+}
+
+func (b *BookEntries) bookCustomValuesOf(
+	entryId BookEntryId,
+) []BookCustomValue {
+	var custom []BookCustomValue
+
+	for i := range b.customColumns {
+		column := &b.customColumns[i]
+		values := column.values[entryId]
+
+		if len(values) == 0 {
+			continue
+		}
+
+		displays := make([]string, len(values))
+		natives := make([]any, len(values))
+
+		for j, value := range values {
+			displays[j] = column.display(value)
+			natives[j] = column.native(value)
+		}
+
+		bookValue := BookCustomValue{
+			Label:    column.Label,
+			Name:     column.Name,
+			Datatype: column.Datatype,
+			Display:  strings.Join(displays, multipleSeparator),
+			Value:    natives[0],
+		}
+
+		if column.IsMultiple {
+			bookValue.Value = natives
+		}
+
+		custom = append(custom, bookValue)
+	}
+
+	return custom
+}
+
+// CustomColumns lists the custom columns that can be searched with
+// #label:value.
+func (b *BookEntries) CustomColumns() []CustomColumn {
+	columns := make([]CustomColumn, len(b.customColumns))
+
+	for i, column := range b.customColumns {
+		columns[i] = column.CustomColumn
+	}
+
+	return columns
+}
+
+var numericOperators = [...]string{">=", "<=", "!=", ">", "<", "="}
+
+type numericComparison struct {
+	op    string
+	value float64
+}
+
+func parseNumericComparison(value string) (numericComparison, error) {
+	comparison := numericComparison{op: "="}
+
+	for _, op := range numericOperators {
+		if rest, found := strings.CutPrefix(value, op); found {
+			comparison.op, value = op, rest
+
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return comparison, fmt.Errorf("invalid number %q", value)
+	}
+
+	comparison.value = number
+
+	return comparison, nil
+}
+
+func (c numericComparison) matches(number float64) bool {
+	switch c.op {
+	case ">=":
+		return number >= c.value
+	case "<=":
+		return number <= c.value
+	case "!=":
+		return number != c.value
+	case ">":
+		return number > c.value
+	case "<":
+		return number < c.value
+	default:
+		return number == c.value
+	}
+}
+
+type customValueMatcher func(value customValue) bool
+
+// matcher interprets a query value according to the column datatype:
+// yes/no for bools, comparisons for numbers and ratings (in stars), date
+// ranges for datetimes and case insensitive substrings, or exact values
+// with a leading '=', for text.
+func (c *customColumn) matcher(
+	value string,
+	now time.Time,
+) (customValueMatcher, error) {
+	switch c.Datatype {
+	case customBool:
+		var want bool
+
+		switch strings.ToLower(value) {
+		case "yes", "true", "checked":
+			want = true
+		case "no", "false", "unchecked":
+			want = false
+		default:
+			return nil, fmt.Errorf("invalid bool %q", value)
+		}
+
+		return func(v customValue) bool { return v.flag == want }, nil
+	case customInt, customFloat, customRating:
+		comparison, err := parseNumericComparison(value)
+		if err != nil {
+			return nil, err
+		}
+
+		scale := 1.0
+		if c.Datatype == customRating {
+			scale = ratingScale
+		}
+
+		return func(v customValue) bool {
+			return comparison.matches(v.number / scale)
+		}, nil
+	case customDatetime:
+		filter, err := parseDateRange(DateAdded, value, now)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(v customValue) bool {
+			return (filter.from.IsZero() || !v.at.Before(filter.from)) &&
+				(filter.to.IsZero() || v.at.Before(filter.to))
+		}, nil
+	default:
+		if exact, found := strings.CutPrefix(value, "="); found {
+			return func(v customValue) bool {
+				return strings.EqualFold(v.text, exact)
+			}, nil
+		}
+
+		needle := string(normalizeWord(value))
+
+		return func(v customValue) bool {
+			return strings.Contains(string(normalizeWord(v.text)), needle)
+		}, nil
+	}
+}
+
+// customColumnFilter selects books with a value of a custom column the
+// matcher accepts.
+type customColumnFilter struct {
+	column  int
+	matches customValueMatcher
+}
+
+func (f customColumnFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	for id, values := range entries.customColumns[f.column].values {
+		for _, v := range values {
+			if f.matches(v) {
+				set.add(BookEntryId(id))
+
+				break
+			}
+		}
+	}
+
+	return set
+}
+
+// customPresenceFilter selects books by whether a custom column is set.
+type customPresenceFilter struct {
+	column int
+	want   bool
+}
+
+func (f customPresenceFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	for id, values := range entries.customColumns[f.column].values {
+		if (len(values) > 0) == f.want {
+			set.add(BookEntryId(id))
+		}
+	}
+
+	return set
+}
+
+// parseCustomColumnFilter checks a filter by a custom column of entries.
+// The values true and false test whether a column is set at all, except
+// for bool columns where they compare the value and "empty" selects unset
+// books.
+func (b *BookEntries) parseCustomColumnFilter(
+	label, value string,
+	now time.Time,
+) (queryFilter, error) {
+	position, found := b.customLabels[strings.ToLower(label)]
+	if !found {
+		return nil, fmt.Errorf("%w %q", ErrUnknownColumn, customColumnPrefix+label)
+	}
+
+	column := &b.customColumns[position]
+
+	presence := map[string]bool{"true": true, "false": false}
+	if column.Datatype == customBool {
+		presence = map[string]bool{"empty": false, "blank": false}
+	}
+
+	if want, found := presence[strings.ToLower(value)]; found {
+		return customPresenceFilter{column: position, want: want}, nil
+	}
+
+	matches, err := column.matcher(value, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s%s: %w", customColumnPrefix, label, err)
+	}
+
+	return customColumnFilter{column: position, matches: matches}, nil
+}
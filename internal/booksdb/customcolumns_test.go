@@ -0,0 +1,152 @@
+package booksdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCustomColumnFilter(t *testing.T) {
+	entries := &BookEntries{
+		books: make(BookEntrySlice, 4),
+		customLabels: map[string]int{
+			"read": 0, "myrating": 1, "shelf": 2,
+		},
+		customColumns: []customColumn{
+			{
+				CustomColumn: CustomColumn{Label: "read", Datatype: customBool},
+				values: [][]customValue{
+					{{flag: true}}, {{flag: false}}, nil, {{flag: true}},
+				},
+			},
+			{
+				CustomColumn: CustomColumn{
+					Label:    "myrating",
+					Datatype: customRating,
+				},
+				values: [][]customValue{
+					{{number: 10}}, {{number: 7}}, {{number: 4}}, nil,
+				},
+			},
+			{
+				CustomColumn: CustomColumn{
+					Label:    "shelf",
+					Datatype: customEnumeration,
+				},
+				values: [][]customValue{
+					{{text: "Living room"}}, nil, {{text: "Bedroom"}}, nil,
+				},
+			},
+		},
+	}
+
+	filterCases := []struct {
+		label string
+		value string
+		want  []BookEntryId
+	}{
+		{"read", "yes", []BookEntryId{0, 3}},
+		{"read", "no", []BookEntryId{1}},
+		{"read", "empty", []BookEntryId{2}},
+		{"myrating", ">=3.5", []BookEntryId{0, 1}},
+		{"myrating", "2", []BookEntryId{2}},
+		{"myrating", "false", []BookEntryId{3}},
+		{"shelf", "ROOM", []BookEntryId{0, 2}},
+		{"shelf", "=bedroom", []BookEntryId{2}},
+		{"shelf", "true", []BookEntryId{0, 2}},
+		{"shelf", "garage", []BookEntryId{}},
+		{"Shelf", "=bedroom", []BookEntryId{2}},
+	}
+
+	for _, tc := range filterCases {
+		filter, err := entries.parseCustomColumnFilter(tc.label, tc.value, time.Now())
+		if err != nil {
+			t.Errorf("#%s:%s error = %v", tc.label, tc.value, err)
+
+			continue
+		}
+
+		got := filter.selectIds(entries, context.Background()).ids()
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("#%s:%s = %v, want %v", tc.label, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestCustomColumnFilterErrors(t *testing.T) {
+	entries := &BookEntries{
+		customLabels: map[string]int{"read": 0, "myrating": 1},
+		customColumns: []customColumn{
+			{CustomColumn: CustomColumn{Label: "read", Datatype: customBool}},
+			{CustomColumn: CustomColumn{Label: "myrating", Datatype: customRating}},
+		},
+	}
+
+	errorCases := []struct {
+		label, value string
+		want         error
+	}{
+		{"nosuch", "x", ErrUnknownColumn},
+		{"myrating", "abc", nil},
+		{"read", "maybe", nil},
+	}
+
+	for _, tc := range errorCases {
+		_, err := entries.parseCustomColumnFilter(tc.label, tc.value, time.Now())
+		if err == nil || (tc.want != nil && !errors.Is(err, tc.want)) {
+			t.Errorf("#%s:%s error = %v, want an error", tc.label, tc.value, err)
+		}
+	}
+
+	if _, err := entries.ParseQuery("dragon #nosuch:x", time.Now()); err == nil {
+		t.Error("ParseQuery accepted an unknown custom column")
+	}
+}
+
+func TestFormatRating(t *testing.T) {
+	for value, want := range map[float64]string{
+		0: "", 2: "★", 7: "★★★½", 10: "★★★★★",
+	} {
+		if got := formatRating(value); got != want {
+			t.Errorf("formatRating(%v) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestCustomColumnLoadSkipsInvalidValues(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for _, statement := range []string{
+		`CREATE TABLE custom_column_1 (book INTEGER, value INTEGER)`,
+		`INSERT INTO custom_column_1 (book, value) VALUES
+			(1, 3), (2, 'three'), (3, 5)`,
+	} {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	column := customColumn{
+		CustomColumn: CustomColumn{Id: 1, Label: "pages", Datatype: customInt},
+		values:       make([][]customValue, 3),
+	}
+
+	if err := column.load(ctx, db, map[uint16]BookEntryId{1: 0, 2: 1, 3: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(column.values[0]) != 1 || len(column.values[1]) != 0 || len(column.values[2]) != 1 {
+		t.Errorf("values = %v, want the invalid one skipped", column.values)
+	}
+}
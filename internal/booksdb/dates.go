@@ -0,0 +1,316 @@
+package booksdb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	daysPerWeek  = 7
+	minValidYear = 102
+)
+
+type DateField byte
+
+const (
+	DateAdded DateField = iota
+	DateModified
+	DatePublished
+	numDateFields
+)
+
+func NewDateField(name string) (DateField, bool) {
+	switch name {
+	case "added", "date":
+		return DateAdded, true
+	case "modified":
+		return DateModified, true
+	case "published", "pubdate":
+		return DatePublished, true
+	default:
+		return 0, false
+	}
+}
+
+// isUndefinedDate reports whether t is unset or Calibre's "undefined" date
+// sentinel (0101-01-01), which it stores instead of NULL.
+func isUndefinedDate(t time.Time) bool {
+	return t.IsZero() || t.Year() < minValidYear
+}
+
+// IsDefinedDate reports whether t holds an actual date.
+func IsDefinedDate(t time.Time) bool {
+	return !isUndefinedDate(t)
+}
+
+type dateIndexEntry struct {
+	at time.Time
+	id BookEntryId
+}
+
+func (b *BookEntries) bookDate(field DateField, id BookEntryId) time.Time {
+	switch field {
+	case DateModified:
+		return b.books[id].ModifiedAt
+	case DatePublished:
+		return b.books[id].PublishedAt
+	default:
+		return b.books[id].AddedAt
+	}
+}
+
+// dateIndex keeps the defined dates of a single column sorted in ascending
+// order, so range queries are answered with two binary searches.
+type dateIndex []dateIndexEntry
+
+func newDateIndex(dates []time.Time) dateIndex {
+	index := make(dateIndex, 0, len(dates))
+
+	for id, at := range dates {
+		if isUndefinedDate(at) {
+			continue
+		}
+
+		index = append(index, dateIndexEntry{at: at, id: BookEntryId(id)})
+	}
+
+	slices.SortFunc(index, func(left, right dateIndexEntry) int {
+		return left.at.Compare(right.at)
+	})
+
+	return index
+}
+
+func (index dateIndex) search(at time.Time) int {
+	pos, _ := slices.BinarySearchFunc(
+		index,
+		at,
+		func(entry dateIndexEntry, target time.Time) int {
+			return entry.at.Compare(target)
+		},
+	)
+
+	return pos
+}
+
+// between returns ids of books dated within [from, to). A zero bound leaves
+// that side of the range open.
+func (index dateIndex) between(from, to time.Time) []BookEntryId {
+	lower, upper := 0, len(index)
+
+	if !from.IsZero() {
+		lower = index.search(from)
+	}
+
+	if !to.IsZero() {
+		upper = index.search(to)
+	}
+
+	if lower >= upper {
+		return nil
+	}
+
+	ids := make([]BookEntryId, upper-lower)
+
+	for i, entry := range index[lower:upper] {
+		ids[i] = entry.id
+	}
+
+	return ids
+}
+
+// dateSpan is a parsed date operand. Absolute dates cover the whole period
+// they name ("2024" is the full year), relative ones ("30d") are instants.
+type dateSpan struct {
+	start    time.Time
+	end      time.Time
+	relative bool
+}
+
+var relativeUnits = map[byte]func(time.Time, int) time.Time{
+	'd': func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -n) },
+	'w': func(t time.Time, n int) time.Time {
+		return t.AddDate(0, 0, -n*daysPerWeek)
+	},
+	'm': func(t time.Time, n int) time.Time { return t.AddDate(0, -n, 0) },
+	'y': func(t time.Time, n int) time.Time { return t.AddDate(-n, 0, 0) },
+	'h': func(t time.Time, n int) time.Time {
+		return t.Add(-time.Duration(n) * time.Hour)
+	},
+}
+
+func parseRelativeDate(value string, now time.Time) (dateSpan, bool) {
+	if len(value) < 2 {
+		return dateSpan{}, false
+	}
+
+	shift, found := relativeUnits[value[len(value)-1]]
+	if !found {
+		return dateSpan{}, false
+	}
+
+	amount, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || amount < 0 {
+		return dateSpan{}, false
+	}
+
+	at := shift(now, amount)
+
+	return dateSpan{start: at, end: at, relative: true}, true
+}
+
+func parseDateSpan(value string, now time.Time) (dateSpan, error) {
+	switch value {
+	case "today":
+		start := time.Date(
+			now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location(),
+		)
+
+		return dateSpan{start: start, end: start.AddDate(0, 0, 1)}, nil
+	case "yesterday":
+		end := time.Date(
+			now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location(),
+		)
+
+		return dateSpan{start: end.AddDate(0, 0, -1), end: end}, nil
+	}
+
+	if span, ok := parseRelativeDate(value, now); ok {
+		return span, nil
+	}
+
+	layouts := [...]struct {
+		layout string
+		next   func(time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	}
+
+	for _, candidate := range layouts {
+		if start, err := time.Parse(candidate.layout, value); err == nil {
+			return dateSpan{start: start, end: candidate.next(start)}, nil
+		}
+	}
+
+	return dateSpan{}, fmt.Errorf("invalid date %q", value)
+}
+
+// dateFilter selects books whose date lies within [from, to).
+type dateFilter struct {
+	field DateField
+	from  time.Time
+	to    time.Time
+}
+
+func (f dateFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	for _, id := range entries.dateIndexes[f.field].between(f.from, f.to) {
+		set.add(id)
+	}
+
+	return set
+}
+
+var dateOperators = [...]string{">=", "<=", ">", "<", "="}
+
+// flipDateOperator turns an age comparison into a date comparison: a book
+// added less than 30 days ago was added after the instant 30 days ago.
+func flipDateOperator(op string) string {
+	switch op {
+	case ">":
+		return "<"
+	case "<":
+		return ">"
+	case ">=":
+		return "<="
+	case "<=":
+		return ">="
+	default:
+		return op
+	}
+}
+
+func parseDateRange(
+	field DateField,
+	value string,
+	now time.Time,
+) (dateFilter, error) {
+	filter := dateFilter{field: field}
+
+	if lower, upper, found := strings.Cut(value, ".."); found {
+		var bounds []time.Time
+
+		for _, part := range [...]string{lower, upper} {
+			if part == "" {
+				continue
+			}
+
+			span, err := parseDateSpan(part, now)
+			if err != nil {
+				return filter, err
+			}
+
+			bounds = append(bounds, span.start, span.end)
+		}
+
+		if len(bounds) == 0 {
+			return filter, fmt.Errorf("invalid date range %q", value)
+		}
+
+		// Bounds are ordered so "30d..7d" and "7d..30d" mean the same.
+		if lower != "" {
+			filter.from = slices.MinFunc(bounds, time.Time.Compare)
+		}
+
+		if upper != "" {
+			filter.to = slices.MaxFunc(bounds, time.Time.Compare)
+		}
+
+		return filter, nil
+	}
+
+	op := ""
+
+	for _, candidate := range dateOperators {
+		if rest, found := strings.CutPrefix(value, candidate); found {
+			op, value = candidate, rest
+
+			break
+		}
+	}
+
+	span, err := parseDateSpan(value, now)
+	if err != nil {
+		return filter, err
+	}
+
+	if span.relative {
+		if op == "" || op == "=" {
+			op = "<="
+		}
+
+		op = flipDateOperator(op)
+	}
+
+	switch op {
+	case ">":
+		filter.from = span.end
+	case ">=":
+		filter.from = span.start
+	case "<":
+		filter.to = span.start
+	case "<=":
+		filter.to = span.end
+	default:
+		filter.from, filter.to = span.start, span.end
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,70 @@
+package booksdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateRange(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	dateCases := []struct {
+		value string
+		from  time.Time
+		to    time.Time
+	}{
+		{">2024-01-01", day(2024, 1, 2), time.Time{}},
+		{">=2024-01-01", day(2024, 1, 1), time.Time{}},
+		{"<2024", time.Time{}, day(2024, 1, 1)},
+		{"<=2024", time.Time{}, day(2025, 1, 1)},
+		{"2024-03", day(2024, 3, 1), day(2024, 4, 1)},
+		{"1990..1999", day(1990, 1, 1), day(2000, 1, 1)},
+		{"..1999", time.Time{}, day(2000, 1, 1)},
+		{"1990..", day(1990, 1, 1), time.Time{}},
+		{"<30d", now.AddDate(0, 0, -30), time.Time{}},
+		{">1y", time.Time{}, now.AddDate(-1, 0, 0)},
+		{"30d..7d", now.AddDate(0, 0, -30), now.AddDate(0, 0, -7)},
+		{"7d..30d", now.AddDate(0, 0, -30), now.AddDate(0, 0, -7)},
+		{"today", day(2025, 6, 15), day(2025, 6, 16)},
+	}
+
+	for _, tc := range dateCases {
+		t.Run(tc.value, func(t *testing.T) {
+			filter, err := parseDateRange(DateAdded, tc.value, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !filter.from.Equal(tc.from) || !filter.to.Equal(tc.to) {
+				t.Errorf(
+					"got [%v, %v), want [%v, %v)",
+					filter.from, filter.to, tc.from, tc.to,
+				)
+			}
+		})
+	}
+
+	for _, value := range []string{"", "soon", "2024-13", "..", "x..2024"} {
+		if _, err := parseDateRange(DateAdded, value, now); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestDateIndexSkipsUndefinedDates(t *testing.T) {
+	undefined := time.Date(101, 1, 1, 0, 0, 0, 0, time.UTC)
+	index := newDateIndex([]time.Time{
+		time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC),
+		undefined,
+		{},
+		time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	got := index.between(time.Time{}, time.Time{})
+	if len(got) != 2 || got[0] != 3 || got[1] != 0 {
+		t.Errorf("got %v, want [3 0]", got)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unicode"
 
 	"github.com/grzadr/calibre-browser/internal/model"
@@ -23,19 +25,61 @@ type (
 type BookRepository struct {
 	*model.Queries
 
-	dbPath string
+	db      *sql.DB
+	dbPath  string
+	options RepositoryOptions
+	content *contentStore
+	// epub searches the text of EPUBs when there is no content store.
+	epub     *epubIndex
+	synonyms *synonymDictionary
+	// cache holds the FTS5 tables of the SearchFts backend.
+	cache *sql.DB
+	// searcher indexes the titles of the entries in use.
+	searcher Searcher
 }
 
 func NewBookRepository(
 	dbPath string,
 	ctx context.Context,
+	options RepositoryOptions,
 ) (*BookRepository, error) {
 	sqlDb, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("error opening db %q: %w", dbPath, err)
 	}
 
-	return &BookRepository{dbPath: dbPath, Queries: model.New(sqlDb)}, nil
+	// A full-text database that cannot be read or queried, as those Calibre
+	// indexes with its own tokenizer cannot, is treated as missing, so the
+	// library is still served and its EPUBs are searched instead.
+	content, err := openContentStore(dbPath, ctx)
+	if err != nil {
+		Logger(ctx).Warn(
+			"cannot use the full-text database, indexing EPUBs instead",
+			"error", err,
+		)
+	}
+
+	repo := &BookRepository{
+		dbPath:  dbPath,
+		db:      sqlDb,
+		options: options,
+		content: content,
+		Queries: model.New(sqlDb),
+	}
+
+	if options.SynonymsPath != "" {
+		repo.synonyms = newSynonymDictionary(options.SynonymsPath)
+	}
+
+	if content == nil {
+		if repo.epub, err = newEpubIndex(dbPath, options); err != nil {
+			sqlDb.Close()
+
+			return nil, fmt.Errorf("error opening content index: %w", err)
+		}
+	}
+
+	return repo, nil
 }
 
 var diacriticalMap = map[rune]string{
@@ -71,15 +115,59 @@ func normalizeWordSlice(words []string) (lowered []Word) {
 }
 
 type BookEntries struct {
-	books       BookEntrySlice
-	titlesIndex *BookSearchIndex
+	books            BookEntrySlice
+	bookIds          map[uint16]BookEntryId
+	titles           Searcher
+	dateIndexes      [numDateFields]dateIndex
+	identifiers      [][]Identifier
+	identifierIndex  identifierIndex
+	series           []series
+	seriesIds        map[int64]int
+	bookSeries       []int
+	seriesIndexes    []SeriesIndex
+	authors          []author
+	authorIds        map[int64]int
+	bookAuthors      [][]int
+	tags             []tag
+	tagIds           map[int64]int
+	bookTags         [][]int
+	tagOrder         []int
+	ratings          []float64
+	formats          [][]BookFormat
+	languages        [][]string
+	publishers       []string
+	customColumns    []customColumn
+	customLabels     map[string]int
+	descriptions     []string
+	descriptionIndex descriptionIndex
+	vocabulary       vocabulary
+	titleKeys        [][]byte
+	synonyms         *synonymDictionary
+	content          contentSearcher
+	savedQueries     map[string]string
+	libraryQueries   map[string]string
+	searchKeys       *sortKeys
+	named            atomic.Pointer[namedSearches]
+	evaluating       sync.Mutex
+	// restrictions caches the books each restriction allows.
+	restrictions sync.Map
+	// tagTrees caches the tag tree of each scope by its key.
+	tagTrees sync.Map
 }
 
 func NewBookEntries(
 	repo *BookRepository,
 	ctx context.Context,
 ) (*BookEntries, error) {
-	entries := &BookEntries{}
+	entries := &BookEntries{synonyms: repo.synonyms}
+
+	// A nil store must not become a non-nil interface.
+	switch {
+	case repo.content != nil:
+		entries.content = repo.content
+	case repo.epub != nil:
+		entries.content = repo.epub
+	}
 
 	var err error
 
@@ -88,12 +176,72 @@ func NewBookEntries(
 	}
 
 	titles := make([]string, len(entries.books))
+	entries.bookIds = make(map[uint16]BookEntryId, len(entries.books))
+	entries.titleKeys = make([][]byte, len(entries.books))
+	keys := newSortKeys(repo.options.Locale)
+
+	var dates [numDateFields][]time.Time
+
+	for field := range dates {
+		dates[field] = make([]time.Time, len(entries.books))
+	}
 
 	for id, entry := range entries.books {
+		entries.bookIds[entry.ID] = BookEntryId(id)
 		titles[id] = entry.Title
+		entries.titleKeys[id] = keys.key(entry.Title)
+		dates[DateAdded][id] = entry.AddedAt
+		dates[DateModified][id] = entry.ModifiedAt
+		dates[DatePublished][id] = entry.PublishedAt
+	}
+
+	if entries.titles, err = repo.newSearcher(titles, ctx); err != nil {
+		return nil, fmt.Errorf("error indexing titles %q: %w", repo.dbPath, err)
+	}
+
+	if fts, ok := entries.titles.(*ftsSearcher); ok {
+		fts.usedBy(entries)
+	}
+
+	for field, column := range dates {
+		entries.dateIndexes[field] = newDateIndex(column)
+	}
+
+	if err := entries.loadIdentifiers(repo, ctx); err != nil {
+		return nil, fmt.Errorf("error indexing %q: %w", repo.dbPath, err)
+	}
+
+	if err := entries.loadSeries(repo, ctx); err != nil {
+		return nil, fmt.Errorf("error indexing %q: %w", repo.dbPath, err)
+	}
+
+	if err := entries.loadAuthors(repo, ctx); err != nil {
+		return nil, fmt.Errorf("error indexing %q: %w", repo.dbPath, err)
+	}
+
+	if err := entries.loadTags(repo, ctx); err != nil {
+		return nil, fmt.Errorf("error indexing %q: %w", repo.dbPath, err)
+	}
+
+	if err := entries.loadMetadata(repo, ctx); err != nil {
+		return nil, fmt.Errorf("error indexing %q: %w", repo.dbPath, err)
+	}
+
+	if err := entries.loadCustomColumns(repo, ctx); err != nil {
+		return nil, fmt.Errorf("error indexing %q: %w", repo.dbPath, err)
+	}
+
+	if err := entries.loadDescriptions(repo, ctx); err != nil {
+		return nil, fmt.Errorf("error indexing %q: %w", repo.dbPath, err)
 	}
 
-	entries.titlesIndex = NewTitleIndex(titles)
+	entries.vocabulary = newVocabulary(titles, entries.descriptions)
+
+	// Saved searches refer to every other kind of metadata, so they are
+	// evaluated last.
+	if err := entries.loadNamedSearches(repo, ctx); err != nil {
+		return nil, fmt.Errorf("error indexing %q: %w", repo.dbPath, err)
+	}
 
 	return entries, nil
 }
@@ -102,13 +250,82 @@ func (b *BookEntries) NumBooks() int {
 	return len(b.books)
 }
 
+// BookDetails is a book with the metadata shown on its own page.
+type BookDetails struct {
+	model.BookEntryRow
+
+	AuthorList  []BookAuthor      `json:"author_list"`
+	Identifiers []Identifier      `json:"identifiers"`
+	Series      *BookSeries       `json:"series,omitempty"`
+	Tags        []BookTag         `json:"tags"`
+	Rating      float64           `json:"rating,omitempty"`
+	Formats     []BookFormat      `json:"formats"`
+	Languages   []string          `json:"languages"`
+	Publisher   string            `json:"publisher,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Custom      []BookCustomValue `json:"custom_columns"`
+}
+
+// HasPublishedAt reports whether the publication date is known, as Calibre
+// stores a sentinel instead of NULL.
+func (d BookDetails) HasPublishedAt() bool {
+	return !isUndefinedDate(d.PublishedAt)
+}
+
+// Stars renders the rating the way Calibre shows it, e.g. ★★★½.
+func (d BookDetails) Stars() string {
+	return formatRating(d.Rating * ratingScale)
+}
+
+// Details looks a book up by its Calibre id. Books outside scope are not
+// found.
+func (b *BookEntries) Details(
+	bookId uint16,
+	scope Scope,
+) (details BookDetails, found bool) {
+	entryId, found := b.bookIds[bookId]
+	if !found || !scope.allows(entryId) {
+		return details, false
+	}
+
+	return BookDetails{
+		BookEntryRow: b.books[entryId],
+		AuthorList:   b.bookAuthorsOf(entryId),
+		Identifiers:  b.identifiers[entryId],
+		Series:       b.bookSeriesOf(entryId),
+		Tags:         b.bookTagsOf(entryId),
+		Rating:       b.ratings[entryId],
+		Formats:      b.formats[entryId],
+		Languages:    b.languages[entryId],
+		Publisher:    b.publishers[entryId],
+		Description:  b.descriptions[entryId],
+		Custom:       b.bookCustomValuesOf(entryId),
+	}, true
+}
+
 var (
 	repository *BookRepository
 	index      atomic.Pointer[BookEntries]
+	// refreshing serializes refreshes, which replace the searcher and the
+	// options of the repository.
+	refreshing sync.Mutex
 )
 
+// RefreshBookEntries reloads the library and swaps the new entries in. The
+// previous entries, which requests may still be using, are left to the
+// garbage collector together with their title searcher, and the text of
+// new or modified EPUBs is indexed in the background.
 func RefreshBookEntries(repo *BookRepository, ctx context.Context) error {
+	refreshing.Lock()
+	defer refreshing.Unlock()
+
+	return refreshBookEntries(repo, ctx)
+}
+
+func refreshBookEntries(repo *BookRepository, ctx context.Context) error {
 	entries, err := NewBookEntries(repo, ctx)
+	recordRefresh(entries, err)
+
 	if err != nil {
 		return fmt.Errorf(
 			"failed to refresh book entries %q: %w",
@@ -119,11 +336,21 @@ func RefreshBookEntries(repo *BookRepository, ctx context.Context) error {
 
 	index.Store(entries)
 
+	if repo.epub != nil {
+		repo.epub.update(entries.epubBooks(), ctx)
+	}
+
+	repo.searcher = entries.titles
+
 	return nil
 }
 
-func PopulateBooksRepository(dbPath string, ctx context.Context) (err error) {
-	repository, err = NewBookRepository(dbPath, ctx)
+func PopulateBooksRepository(
+	dbPath string,
+	ctx context.Context,
+	options RepositoryOptions,
+) (err error) {
+	repository, err = NewBookRepository(dbPath, ctx, options)
 	if err != nil {
 		return fmt.Errorf(
 			"failed to populate books repository %q: %w",
@@ -137,12 +364,49 @@ func PopulateBooksRepository(dbPath string, ctx context.Context) (err error) {
 	return err
 }
 
+// ReloadBooksRepository applies new options to the repository and reloads
+// the library. The cache directory and the number of index workers are
+// only read when the repository is opened, so they keep their values. If
+// the library cannot be reloaded, the previous options stay in place.
+func ReloadBooksRepository(options RepositoryOptions, ctx context.Context) error {
+	refreshing.Lock()
+	defer refreshing.Unlock()
+
+	// The entries are stored after the repository is set.
+	if GetBooksEntries() == nil {
+		return ErrNotLoaded
+	}
+
+	repo := repository
+	previous, synonyms := repo.options, repo.synonyms
+
+	options.CacheDir = repo.options.CacheDir
+	options.IndexWorkers = repo.options.IndexWorkers
+
+	if options.SynonymsPath != repo.options.SynonymsPath {
+		repo.synonyms = nil
+		if options.SynonymsPath != "" {
+			repo.synonyms = newSynonymDictionary(options.SynonymsPath)
+		}
+	}
+
+	repo.options = options
+
+	if err := refreshBookEntries(repo, ctx); err != nil {
+		repo.options, repo.synonyms = previous, synonyms
+
+		return err
+	}
+
+	return nil
+}
+
 func ExecuteCommand(
-	index *BookEntries,
+	catalog Catalog,
 	cmd string,
 	args []string,
 ) (BookEntrySlice, error) {
-	return CommandMap[NewCommand(cmd)](index, args)
+	return CommandMap[NewCommand(cmd)](catalog, args)
 }
 
 func GetBooksEntries() *BookEntries {
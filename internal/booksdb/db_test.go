@@ -0,0 +1,70 @@
+package booksdb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadKeepsOptionsOnFailure(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// The database has no tables, so every refresh fails.
+	repo, err := NewBookRepository(
+		filepath.Join(dir, "metadata.db"),
+		ctx,
+		RepositoryOptions{CacheDir: dir},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousRepository, previousEntries := repository, index.Load()
+	repository = repo
+	index.Store(&BookEntries{})
+
+	t.Cleanup(func() {
+		repository = previousRepository
+		index.Store(previousEntries)
+	})
+
+	err = ReloadBooksRepository(RepositoryOptions{
+		SearchBackend: SearchFts,
+		SynonymsPath:  filepath.Join(dir, "synonyms.json"),
+	}, ctx)
+	if err == nil {
+		t.Fatal("ReloadBooksRepository succeeded without a library")
+	}
+
+	if repo.options.SearchBackend != SearchMemory || repo.options.SynonymsPath != "" {
+		t.Errorf("options after a failed reload = %+v", repo.options)
+	}
+
+	if repo.synonyms != nil {
+		t.Error("synonyms replaced by a failed reload")
+	}
+}
+
+func TestNewBookRepositoryWithUnreadableContent(t *testing.T) {
+	dir := t.TempDir()
+
+	// A directory in place of the database cannot be opened.
+	if err := os.Mkdir(filepath.Join(dir, contentDbName), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewBookRepository(
+		filepath.Join(dir, "metadata.db"),
+		context.Background(),
+		RepositoryOptions{CacheDir: dir},
+	)
+	if err != nil {
+		t.Fatalf("NewBookRepository error = %v", err)
+	}
+
+	if repo.content != nil || repo.epub == nil {
+		t.Errorf("content = %v, epub = %v, want EPUBs indexed instead", repo.content, repo.epub)
+	}
+}
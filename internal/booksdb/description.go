@@ -0,0 +1,399 @@
+package booksdb
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// skippedElements hold no text a reader of the description would see.
+var skippedElements = map[string]bool{"script": true, "style": true}
+
+// inlineElements do not separate the words around them, unlike any other
+// element, e.g. "<i>chapter</i>." or "<p>one</p><p>two</p>".
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "cite": true, "code": true,
+	"em": true, "font": true, "i": true, "small": true, "span": true,
+	"strong": true, "sub": true, "sup": true, "u": true,
+}
+
+// tagName returns the lower-case name of a tag given without its angle
+// brackets and leading slash.
+func tagName(tag string) string {
+	end := strings.IndexFunc(tag, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '/'
+	})
+	if end < 0 {
+		end = len(tag)
+	}
+
+	return strings.ToLower(tag[:end])
+}
+
+// htmlText converts the HTML Calibre stores descriptions in to plain text.
+// Tags are dropped along with scripts and styles, entities are decoded and
+// whitespace, paragraph breaks included, is collapsed.
+func htmlText(source string) string {
+	var text strings.Builder
+
+	for source != "" {
+		start := strings.IndexByte(source, '<')
+		if start < 0 {
+			text.WriteString(source)
+
+			break
+		}
+
+		text.WriteString(source[:start])
+		source = source[start:]
+
+		if rest, found := strings.CutPrefix(source, "<!--"); found {
+			_, source, _ = strings.Cut(rest, "-->")
+
+			continue
+		}
+
+		end := strings.IndexByte(source, '>')
+		if end < 0 {
+			break
+		}
+
+		tag, closing := strings.CutPrefix(source[1:end], "/")
+		name := tagName(tag)
+		source = source[end+1:]
+
+		if !inlineElements[name] {
+			text.WriteByte(' ')
+		}
+
+		if !closing && skippedElements[name] {
+			closing := strings.Index(strings.ToLower(source), "</"+name)
+			if closing < 0 {
+				break
+			}
+
+			source = source[closing:]
+		}
+	}
+
+	return strings.Join(strings.Fields(html.UnescapeString(text.String())), " ")
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// textSpans returns the byte offsets of the words of a text. Unlike titles,
+// descriptions are split on punctuation too.
+func textSpans(text string) (spans [][2]int) {
+	start := -1
+
+	for position, r := range text {
+		switch {
+		case isWordRune(r) && start < 0:
+			start = position
+		case !isWordRune(r) && start >= 0:
+			spans = append(spans, [2]int{start, position})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+
+	return spans
+}
+
+func splitText(text string) []Word {
+	spans := textSpans(text)
+	words := make([]Word, len(spans))
+
+	for i, span := range spans {
+		words[i] = normalizeWord(text[span[0]:span[1]])
+	}
+
+	return words
+}
+
+// descriptionIndex maps every word of the descriptions, and the Latin
+// spelling of Cyrillic and Greek ones, to the books, in library order,
+// whose description contains it.
+type descriptionIndex map[Word][]BookEntryId
+
+func newDescriptionIndex(descriptions []string) descriptionIndex {
+	index := make(descriptionIndex)
+
+	for id, description := range descriptions {
+		entryId := BookEntryId(id)
+
+		for _, word := range splitText(description) {
+			for _, form := range wordForms(word) {
+				ids := index[form]
+				if len(ids) == 0 || ids[len(ids)-1] != entryId {
+					index[form] = append(ids, entryId)
+				}
+			}
+		}
+	}
+
+	return index
+}
+
+// find returns the books whose description contains every word, or nil when
+// no word can be looked up.
+func (index descriptionIndex) find(words []Word, capacity int) bookIdSet {
+	var found bookIdSet
+
+	for _, word := range words {
+		for _, part := range splitText(string(word)) {
+			set := newBookIdSet(capacity)
+			for _, form := range wordForms(part) {
+				for _, id := range index[form] {
+					set.add(id)
+				}
+			}
+
+			if found == nil {
+				found = set
+			} else {
+				found.intersect(set)
+			}
+		}
+	}
+
+	return found
+}
+
+func (b *BookEntries) loadDescriptions(
+	repo *BookRepository,
+	ctx context.Context,
+) error {
+	comments, err := repo.BookComments(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing comments: %w", err)
+	}
+
+	b.descriptions = make([]string, len(b.books))
+
+	for _, row := range comments {
+		if entryId, found := b.bookIds[uint16(row.Book)]; found {
+			b.descriptions[entryId] = htmlText(row.Text)
+		}
+	}
+
+	b.descriptionIndex = newDescriptionIndex(b.descriptions)
+
+	return nil
+}
+
+func descriptionTexts(entries *BookEntries, id BookEntryId) []string {
+	if description := entries.descriptions[id]; description != "" {
+		return []string{description}
+	}
+
+	return nil
+}
+
+// descriptionFilter selects books whose description contains every word.
+type descriptionFilter struct {
+	words []Word
+}
+
+func (f descriptionFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	found := entries.descriptionIndex.find(f.words, entries.NumBooks())
+	if found == nil {
+		return newBookIdSet(entries.NumBooks())
+	}
+
+	return found
+}
+
+func parseDescriptionFilter(value string, _ time.Time) (queryFilter, error) {
+	return descriptionFilter{words: splitText(value)}, nil
+}
+
+// descriptionWords returns the words of the description filters of an
+// evaluated filter tree, leaving out negated ones.
+func descriptionWords(filter queryFilter) (words []Word) {
+	switch f := filter.(type) {
+	case descriptionFilter:
+		words = append(words, f.words...)
+	case andFilter:
+		for _, child := range f {
+			words = append(words, descriptionWords(child)...)
+		}
+	case orFilter:
+		for _, child := range f {
+			words = append(words, descriptionWords(child)...)
+		}
+	}
+
+	return words
+}
+
+// alignStart moves a cut forward to the start of a word, so excerpts do not
+// begin mid-word.
+func alignStart(text string, position int) int {
+	if position == 0 {
+		return 0
+	}
+
+	if space := strings.IndexByte(text[position:], ' '); space >= 0 {
+		return position + space + 1
+	}
+
+	return position
+}
+
+// alignEnd moves a cut back to the end of a word.
+func alignEnd(text string, position int) int {
+	if position >= len(text) {
+		return len(text)
+	}
+
+	if space := strings.LastIndexByte(text[:position], ' '); space > 0 {
+		return space
+	}
+
+	for !utf8.RuneStart(text[position]) {
+		position--
+	}
+
+	return position
+}
+
+// snippetWords returns the words a snippet marks, as they are compared to
+// the words of a text.
+func snippetWords(words []Word) map[Word]bool {
+	wanted := make(map[Word]bool, len(words))
+
+	for _, word := range words {
+		for _, part := range splitText(string(word)) {
+			wanted[transliterate(part)] = true
+		}
+	}
+
+	return wanted
+}
+
+// textSnippet quotes a text, e.g. a description, around the first of the
+// words it contains and marks each of them, or returns nil if there is none.
+func textSnippet(description string, words []Word) Snippet {
+	wanted := snippetWords(words)
+	spans := textSpans(description)
+	first := -1
+
+	for i, span := range spans {
+		if wanted[transliterate(normalizeWord(description[span[0]:span[1]]))] {
+			first = i
+
+			break
+		}
+	}
+
+	if first < 0 {
+		return nil
+	}
+
+	start := alignStart(
+		description,
+		max(0, spans[first][0]-fallbackContext),
+	)
+	start = min(start, spans[first][0])
+	end := alignEnd(description, start+fallbackLength)
+
+	var (
+		snippet  Snippet
+		position = start
+	)
+
+	if start > 0 {
+		snippet = append(snippet, SnippetPart{Text: snippetEllipsis})
+	}
+
+	for _, span := range spans[first:] {
+		if span[1] > end {
+			break
+		}
+
+		if !wanted[transliterate(normalizeWord(description[span[0]:span[1]]))] {
+			continue
+		}
+
+		if span[0] > position {
+			snippet = append(snippet, SnippetPart{Text: description[position:span[0]]})
+		}
+
+		snippet = append(snippet, SnippetPart{
+			Text:  description[span[0]:span[1]],
+			Match: true,
+		})
+		position = span[1]
+	}
+
+	if end > position {
+		snippet = append(snippet, SnippetPart{Text: description[position:end]})
+	}
+
+	if end < len(description) {
+		snippet = append(snippet, SnippetPart{Text: snippetEllipsis})
+	}
+
+	return snippet
+}
+
+// titleMatches reports whether a title contains any of the words, as the
+// title index matches them.
+func titleMatches(title string, words []Word) bool {
+	for _, word := range splitTitle(title) {
+		for _, wanted := range words {
+			if transliterate(word) == transliterate(wanted) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// addDescriptionSnippets quotes the descriptions of the listed books that
+// were not found by their title and have no snippet yet.
+func (b *BookEntries) addDescriptionSnippets(
+	query Query,
+	ids []BookEntryId,
+	snippets map[uint16]Snippet,
+) map[uint16]Snippet {
+	words := query.words
+
+	for _, filter := range query.filters {
+		words = append(words, descriptionWords(filter)...)
+	}
+
+	if len(words) == 0 {
+		return snippets
+	}
+
+	for _, id := range ids {
+		book := b.books[id]
+
+		if _, found := snippets[book.ID]; found ||
+			titleMatches(book.Title, query.words) {
+			continue
+		}
+
+		if snippet := textSnippet(b.descriptions[id], words); snippet != nil {
+			if snippets == nil {
+				snippets = make(map[uint16]Snippet)
+			}
+
+			snippets[book.ID] = snippet
+		}
+	}
+
+	return snippets
+}
@@ -0,0 +1,119 @@
+package booksdb
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestHtmlText(t *testing.T) {
+	htmlCases := []struct {
+		source string
+		want   string
+	}{
+		{"plain text", "plain text"},
+		{"<div><p>A <b>hobbit</b> &amp; a ring.</p></div>", "A hobbit & a ring."},
+		{"<p>one</p><p>two</p>", "one two"},
+		{"line<br/>break", "line break"},
+		{`<script type="text/javascript">alert("<p>")</script><p>kept</p>`, "kept"},
+		{"<STYLE>p { color: red }</STYLE>text", "text"},
+		{"<!-- hidden <p>comment</p> -->shown", "shown"},
+		{"&lt;script&gt; stays text", "<script> stays text"},
+		{"unclosed <b", "unclosed"},
+		{"<p>An <em>inline</em>, <span class=\"x\">tag</span>.</p>", "An inline, tag."},
+	}
+
+	for _, tc := range htmlCases {
+		if got := htmlText(tc.source); got != tc.want {
+			t.Errorf("htmlText(%q) = %q, want %q", tc.source, got, tc.want)
+		}
+	}
+}
+
+func TestDescriptionSearch(t *testing.T) {
+	entries := newCalibreTestEntries()
+	titles := make([]string, entries.NumBooks())
+
+	for id, book := range entries.books {
+		titles[id] = book.Title
+	}
+
+	entries.titles = NewTitleIndex(titles)
+
+	searchCases := []struct {
+		query    string
+		want     []string
+		snippets []uint16
+	}{
+		{"dragon", []string{"The Hobbit", "Guards! Guards!"}, []uint16{1, 2}},
+		{"Dragon's", []string{"The Hobbit"}, []uint16{1}},
+		{"hobbit dragon", []string{"The Hobbit"}, nil},
+		{"ankh morpork", []string{"Guards! Guards!"}, []uint16{2}},
+		{"teeth london", []string{"White Teeth"}, nil},
+		{"description:london", []string{"White Teeth"}, []uint16{4}},
+		{"description:dragon hobbit", []string{"The Hobbit"}, nil},
+		{"description:dragon description:ankh", []string{"Guards! Guards!"}, []uint16{2}},
+	}
+
+	for _, tc := range searchCases {
+		results, err := entries.Search(tc.query, context.Background(), SearchOptions{})
+		if err != nil {
+			t.Errorf("Search(%q) error = %v", tc.query, err)
+
+			continue
+		}
+
+		var got []string
+		for _, book := range results.Books {
+			got = append(got, book.Title)
+		}
+
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("Search(%q) = %q, want %q", tc.query, got, tc.want)
+		}
+
+		var quoted []uint16
+		for bookId := range results.Snippets {
+			quoted = append(quoted, bookId)
+		}
+
+		slices.Sort(quoted)
+
+		if !slices.Equal(quoted, tc.snippets) {
+			t.Errorf("Search(%q) quoted books %v, want %v", tc.query, quoted, tc.snippets)
+		}
+	}
+}
+
+func TestTextSnippet(t *testing.T) {
+	description := "It begins in a quiet village where nothing happens, " +
+		"and nothing keeps happening for a good many chapters. " +
+		"Many pages later a dragon wakes beneath the mountain, " +
+		"and the dwarves, who lost their home to the Dragon long ago, " +
+		"march east to take it back before winter comes to the valley, " +
+		"followed by a burglar who would rather be at home."
+
+	snippet := textSnippet(description, []Word{"dragon"})
+	if len(snippet) == 0 {
+		t.Fatal("textSnippet found no match")
+	}
+
+	if snippet[0].Text != snippetEllipsis || snippet[len(snippet)-1].Text != snippetEllipsis {
+		t.Errorf("snippet %v is not cut on both ends", snippet)
+	}
+
+	var matches []string
+	for _, part := range snippet {
+		if part.Match {
+			matches = append(matches, part.Text)
+		}
+	}
+
+	if !slices.Equal(matches, []string{"dragon", "Dragon"}) {
+		t.Errorf("snippet marks %q, want dragon and Dragon", matches)
+	}
+
+	if textSnippet(description, []Word{"hobbit"}) != nil {
+		t.Error("textSnippet quoted a description without a match")
+	}
+}
@@ -0,0 +1,181 @@
+package booksdb
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	epubContainerPath = "META-INF/container.xml"
+	// epubMaxDocumentSize guards against documents that would not fit in
+	// memory, e.g. a zip bomb.
+	epubMaxDocumentSize = 64 << 20
+)
+
+var ErrInvalidEpub = errors.New("invalid EPUB")
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Manifest []struct {
+		Id        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		Idref string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// formatPath returns where Calibre keeps a format of a book, relative to
+// the library directory.
+func (b *BookEntries) formatPath(id BookEntryId, format string) (string, bool) {
+	for _, file := range b.formats[id] {
+		if strings.EqualFold(file.Format, format) {
+			return filepath.Join(
+				filepath.FromSlash(b.books[id].Path),
+				file.Name+"."+strings.ToLower(file.Format),
+			), true
+		}
+	}
+
+	return "", false
+}
+
+func readZipFile(archive *zip.Reader, name string) ([]byte, error) {
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, epubMaxDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > epubMaxDocumentSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, epubMaxDocumentSize)
+	}
+
+	return data, nil
+}
+
+func decodeZipXml(archive *zip.Reader, name string, value any) error {
+	data, err := readZipFile(archive, name)
+	if err != nil {
+		return err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// EPUBs in the wild declare all sorts of encodings; the markup that
+	// matters is ASCII either way.
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	decoder.Strict = false
+
+	return decoder.Decode(value)
+}
+
+// spineDocuments lists the documents of an EPUB in reading order, as
+// paths inside the archive.
+func spineDocuments(archive *zip.Reader) ([]string, error) {
+	var container epubContainer
+	if err := decodeZipXml(archive, epubContainerPath, &container); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidEpub, epubContainerPath, err)
+	}
+
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("%w: no package document", ErrInvalidEpub)
+	}
+
+	packagePath := container.Rootfiles[0].FullPath
+
+	var opf epubPackage
+	if err := decodeZipXml(archive, packagePath, &opf); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidEpub, packagePath, err)
+	}
+
+	hrefs := make(map[string]string, len(opf.Manifest))
+
+	for _, item := range opf.Manifest {
+		if strings.Contains(item.MediaType, "html") {
+			hrefs[item.Id] = item.Href
+		}
+	}
+
+	documents := make([]string, 0, len(opf.Spine))
+
+	for _, item := range opf.Spine {
+		href, found := hrefs[item.Idref]
+		if !found {
+			continue
+		}
+
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+
+		documents = append(
+			documents,
+			path.Join(path.Dir(packagePath), strings.Split(href, "#")[0]),
+		)
+	}
+
+	return documents, nil
+}
+
+// extractEpubText returns the text of an EPUB's documents in reading order,
+// one paragraph per document.
+func extractEpubText(file string) (string, error) {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidEpub, err)
+	}
+	defer archive.Close()
+
+	documents, err := spineDocuments(&archive.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	texts := make([]string, 0, len(documents))
+
+	for _, document := range documents {
+		data, err := readZipFile(&archive.Reader, document)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s: %w", ErrInvalidEpub, document, err)
+		}
+
+		if text := htmlText(xhtmlBody(string(data))); text != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	return strings.Join(texts, "\n"), nil
+}
+
+// xhtmlBody cuts the head off a document, so its title and styles are not
+// taken for text.
+func xhtmlBody(document string) string {
+	position := strings.Index(strings.ToLower(document), "<body")
+	if position < 0 {
+		return document
+	}
+
+	return document[position:]
+}
@@ -0,0 +1,262 @@
+package booksdb
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestEpub writes an EPUB whose spine lists the chapters in order,
+// under file names that need escaping in the package document.
+func writeTestEpub(t *testing.T, file string, chapters ...string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+
+	archive := zip.NewWriter(output)
+	files := map[string]string{
+		"mimetype": "application/epub+zip",
+		epubContainerPath: `<?xml version="1.0"?>
+<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles>
+</container>`,
+	}
+
+	var manifest, spine string
+
+	for i, chapter := range chapters {
+		id := string(rune('a' + i))
+		manifest += `<item id="` + id + `" href="Text/part%20` + id +
+			`.xhtml" media-type="application/xhtml+xml"/>`
+		spine += `<itemref idref="` + id + `"/>`
+		files["OEBPS/Text/part "+id+".xhtml"] = `<html><head>` +
+			`<title>Running head</title></head><body>` + chapter + `</body></html>`
+	}
+
+	files["OEBPS/content.opf"] = `<package><manifest>` + manifest +
+		`<item id="css" href="style.css" media-type="text/css"/></manifest>` +
+		`<spine>` + spine + `</spine></package>`
+
+	for name, content := range files {
+		writer, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractEpubText(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "book.epub")
+	writeTestEpub(t, file, "<p>First <i>chapter</i>.</p>", "<p>Second &amp; last.</p>")
+
+	text, err := extractEpubText(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "First chapter.\nSecond & last."; text != want {
+		t.Errorf("extractEpubText = %q, want %q", text, want)
+	}
+
+	if _, err := extractEpubText(filepath.Join(t.TempDir(), "missing.epub")); err == nil {
+		t.Error("extractEpubText of a missing file error = nil")
+	}
+}
+
+func waitForIndex(t *testing.T, index *epubIndex) IndexProgress {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for index.Progress().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("indexing did not finish")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	return index.Progress()
+}
+
+func TestEpubIndex(t *testing.T) {
+	library := t.TempDir()
+	options := RepositoryOptions{CacheDir: t.TempDir(), IndexWorkers: 2}
+	dbPath := filepath.Join(library, "metadata.db")
+	books := []epubBook{
+		{id: 1, path: filepath.Join("Tolkien", "Hobbit.epub")},
+		{id: 2, path: filepath.Join("Pratchett", "Guards.epub")},
+		{id: 3, path: filepath.Join("Nobody", "Missing.epub")},
+	}
+
+	writeTestEpub(t, filepath.Join(library, books[0].path),
+		"<p>In a hole in the ground there lived a hobbit.</p>")
+	writeTestEpub(t, filepath.Join(library, books[1].path),
+		"<p>The dragon landed on the roof of the Watch House.</p>",
+		"<p>The Librarian said Ook.</p>")
+
+	index, err := newEpubIndex(dbPath, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index.update(books, context.Background())
+
+	progress := waitForIndex(t, index)
+	if progress.Indexed != 3 || progress.Failed != 1 || progress.Total != 3 {
+		t.Errorf("progress = %+v, want 3 indexed, 1 failed", progress)
+	}
+
+	searchCases := []struct {
+		terms []string
+		want  []uint16
+	}{
+		{[]string{"hobbit"}, []uint16{1}},
+		{[]string{"the"}, []uint16{1, 2}},
+		{[]string{"dragon ook"}, []uint16{2}},
+		{[]string{"dragon", "hobbit"}, nil},
+		{[]string{"Running"}, nil},
+	}
+
+	for _, tc := range searchCases {
+		found, err := index.search(context.Background(), tc.terms)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := slices.Sorted(func(yield func(uint16) bool) {
+			for id := range found {
+				if !yield(id) {
+					return
+				}
+			}
+		})
+
+		if !slices.Equal(ids, tc.want) {
+			t.Errorf("search(%q) = %v, want %v", tc.terms, ids, tc.want)
+		}
+
+		for id, snippet := range found {
+			if len(snippetMatches(snippet)) == 0 {
+				t.Errorf("search(%q) quoted book %d without a match", tc.terms, id)
+			}
+		}
+	}
+
+	// A new index starts from the cache and reads only what changed.
+	cached, err := newEpubIndex(dbPath, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found := cached.find([]Word{"hobbit"}); !slices.Equal(found, []uint16{1}) {
+		t.Errorf("cached find(hobbit) = %v, want [1]", found)
+	}
+
+	if todo := cached.changed(books[:2]); len(todo) != 0 {
+		t.Errorf("unchanged files were read again: %v", todo)
+	}
+}
+
+func TestEpubIndexReplacedBook(t *testing.T) {
+	library := t.TempDir()
+	options := RepositoryOptions{CacheDir: t.TempDir(), IndexWorkers: 1}
+	books := []epubBook{
+		{id: 1, path: "One.epub"},
+		{id: 2, path: "Two.epub"},
+	}
+
+	writeTestEpub(t, filepath.Join(library, books[0].path), "<p>A dragon.</p>")
+	writeTestEpub(t, filepath.Join(library, books[1].path), "<p>Another dragon.</p>")
+
+	index, err := newEpubIndex(filepath.Join(library, "metadata.db"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index.update(books, context.Background())
+	waitForIndex(t, index)
+
+	// The file is rewritten in the same second, so its size has to change.
+	writeTestEpub(t, filepath.Join(library, books[0].path), "<p>The wizards of the tower.</p>")
+	index.update(books, context.Background())
+	waitForIndex(t, index)
+
+	if found := index.find([]Word{"dragon"}); !slices.Equal(found, []uint16{2}) {
+		t.Errorf("find(dragon) = %v, want [2]", found)
+	}
+
+	if found := index.find([]Word{"wizards"}); !slices.Equal(found, []uint16{1}) {
+		t.Errorf("find(wizards) = %v, want [1]", found)
+	}
+
+	// Books whose file is gone until the next update are found unquoted.
+	if err := os.Remove(filepath.Join(library, books[0].path)); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := index.search(context.Background(), []string{"tower"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snippet, ok := found[1]; !ok || snippet != nil {
+		t.Errorf("search(tower) = %v, want book 1 unquoted", found)
+	}
+}
+
+func TestEpubIndexQuotesDeepMatch(t *testing.T) {
+	library := t.TempDir()
+	options := RepositoryOptions{CacheDir: t.TempDir(), IndexWorkers: 1}
+	books := []epubBook{{id: 1, path: "Long.epub"}}
+	filler := "<p>" + strings.Repeat("Nothing happens here. ", 4<<10) + "</p>"
+
+	writeTestEpub(
+		t,
+		filepath.Join(library, books[0].path),
+		filler,
+		"<p>At last the dragon woke.</p>",
+	)
+
+	index, err := newEpubIndex(filepath.Join(library, "metadata.db"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index.update(books, context.Background())
+	waitForIndex(t, index)
+
+	found, err := index.search(context.Background(), []string{"dragon"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if matches := snippetMatches(found[1]); !slices.Equal(matches, []string{"dragon"}) {
+		t.Errorf("search(dragon) quoted %v, want [dragon]", matches)
+	}
+
+	if snippet := found[1]; len(snippet) == 0 || snippet[0].Text != snippetEllipsis {
+		t.Errorf("search(dragon) = %v, want the quote to start with an ellipsis", snippet)
+	}
+}
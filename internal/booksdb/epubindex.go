@@ -0,0 +1,569 @@
+package booksdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	epubFormat = "EPUB"
+	// epubCacheVersion changes whenever extraction or tokenization does, so
+	// stale caches are rebuilt.
+	epubCacheVersion = 2
+	// epubSnippetLimit caps the books quoted per search.
+	epubSnippetLimit = 25
+	// epubSnippetWindow is how much of the text of a book is split into
+	// words at a time while looking for the passage to quote.
+	epubSnippetWindow = 16 << 10
+	// epubProgressStep is how many books are indexed between progress
+	// messages in the log.
+	epubProgressStep = 100
+)
+
+// IndexProgress tells how far the background indexing of book files has
+// got. Indexed counts books taken from the cache too.
+type IndexProgress struct {
+	Indexed int  `json:"indexed"`
+	Failed  int  `json:"failed"`
+	Total   int  `json:"total"`
+	Running bool `json:"running"`
+}
+
+// epubBook is a book to index, by Calibre id, with the path of its EPUB
+// relative to the library.
+type epubBook struct {
+	id   uint16
+	path string
+}
+
+// epubEntry is what the cache keeps of an indexed file: its distinct
+// words, valid as long as the file keeps its size and modification time.
+type epubEntry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Words   []Word
+}
+
+type epubCache struct {
+	Version int
+	Books   map[uint16]epubEntry
+}
+
+type epubResult struct {
+	id    uint16
+	entry epubEntry
+	err   error
+}
+
+// epubIndex searches the text of EPUBs for libraries without Calibre's
+// full-text database. It keeps an inverted index of the words of every
+// book, built by a pool of workers in the background and saved to a cache
+// file, so only new and modified files are read after a restart. Words are
+// matched without regard to their position, so "content:" phrases match
+// books containing all of their words.
+type epubIndex struct {
+	root      string
+	cachePath string
+	workers   int
+
+	mu       sync.RWMutex
+	books    map[uint16]epubEntry
+	postings map[Word][]uint16
+	progress IndexProgress
+	// pending is the list of books queued while a pass was running.
+	pending []epubBook
+}
+
+func newEpubIndex(dbPath string, options RepositoryOptions) (*epubIndex, error) {
+	path, err := filepath.Abs(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := options.IndexWorkers
+	if workers <= 0 {
+		workers = max(1, runtime.GOMAXPROCS(0)/2)
+	}
+
+	sum := sha256.Sum256([]byte(path))
+	index := &epubIndex{
+		root: filepath.Dir(path),
+		cachePath: filepath.Join(
+			options.cacheDir(),
+			"content-"+hex.EncodeToString(sum[:8])+".gob",
+		),
+		workers:  workers,
+		books:    make(map[uint16]epubEntry),
+		postings: make(map[Word][]uint16),
+	}
+
+	if err := index.load(); err != nil {
+		slog.Warn(
+			"ignoring content index cache",
+			"path", index.cachePath,
+			"error", err,
+		)
+	}
+
+	return index, nil
+}
+
+func (x *epubIndex) load() error {
+	file, err := os.Open(x.cachePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var cache epubCache
+	if err := gob.NewDecoder(file).Decode(&cache); err != nil {
+		return err
+	}
+
+	if cache.Version != epubCacheVersion {
+		return fmt.Errorf("cache version %d is outdated", cache.Version)
+	}
+
+	x.books = cache.Books
+	x.rebuildPostings()
+
+	return nil
+}
+
+// save writes the cache to a temporary file first, so a crash never leaves
+// a truncated cache behind.
+func (x *epubIndex) save() error {
+	if err := os.MkdirAll(filepath.Dir(x.cachePath), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(x.cachePath), "content-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	x.mu.RLock()
+	err = gob.NewEncoder(file).Encode(
+		epubCache{Version: epubCacheVersion, Books: x.books},
+	)
+	x.mu.RUnlock()
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), x.cachePath)
+}
+
+// rebuildPostings recreates the inverted index from the words of every
+// book. Callers hold the lock or own the index.
+func (x *epubIndex) rebuildPostings() {
+	ids := make([]uint16, 0, len(x.books))
+	for id := range x.books {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	x.postings = make(map[Word][]uint16)
+
+	for _, id := range ids {
+		x.addPostings(id, x.books[id].Words)
+	}
+}
+
+func (x *epubIndex) addPostings(id uint16, words []Word) {
+	for _, word := range words {
+		x.postings[word] = append(x.postings[word], id)
+	}
+}
+
+// removePostings takes a book out of the lists of its words.
+func (x *epubIndex) removePostings(id uint16, words []Word) {
+	for _, word := range words {
+		ids := slices.DeleteFunc(x.postings[word], func(other uint16) bool {
+			return other == id
+		})
+
+		if len(ids) == 0 {
+			delete(x.postings, word)
+		} else {
+			x.postings[word] = ids
+		}
+	}
+}
+
+// Progress returns the state of the background indexing.
+func (x *epubIndex) Progress() IndexProgress {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return x.progress
+}
+
+// update indexes the EPUBs of books in the background. When a pass is
+// already running, books are indexed once it completes.
+func (x *epubIndex) update(books []epubBook, ctx context.Context) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.progress.Running {
+		x.pending = books
+
+		return
+	}
+
+	x.progress = IndexProgress{Total: len(books), Running: true}
+
+	go x.run(books, ctx)
+}
+
+func (x *epubIndex) run(books []epubBook, ctx context.Context) {
+	for {
+		x.index(books, ctx)
+
+		if err := x.save(); err != nil {
+			Logger(ctx).Error(
+				"error saving content index cache",
+				"path", x.cachePath,
+				"error", err,
+			)
+		}
+
+		x.mu.Lock()
+		books, x.pending = x.pending, nil
+
+		if books == nil || ctx.Err() != nil {
+			x.progress.Running = false
+			x.mu.Unlock()
+
+			return
+		}
+
+		x.progress = IndexProgress{Total: len(books), Running: true}
+		x.mu.Unlock()
+	}
+}
+
+// changed returns the books whose file is not in the cache as it is on
+// disk, along with their file's details, and forgets books whose file is
+// gone. Files are looked at before taking the lock, so searches are not
+// held up on a slow disk.
+func (x *epubIndex) changed(books []epubBook) (todo []epubResult) {
+	files := make([]epubResult, len(books))
+
+	for i, book := range books {
+		info, err := os.Stat(filepath.Join(x.root, book.path))
+		if err != nil {
+			files[i] = epubResult{id: book.id, err: err}
+
+			continue
+		}
+
+		files[i] = epubResult{id: book.id, entry: epubEntry{
+			Path:    book.path,
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC(),
+		}}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	listed := make(map[uint16]bool, len(books))
+
+	for _, file := range files {
+		if file.err != nil {
+			todo = append(todo, file)
+
+			continue
+		}
+
+		listed[file.id] = true
+
+		if cached, found := x.books[file.id]; found &&
+			cached.Path == file.entry.Path && cached.Size == file.entry.Size &&
+			cached.ModTime.Equal(file.entry.ModTime) {
+			x.progress.Indexed++
+
+			continue
+		}
+
+		todo = append(todo, file)
+	}
+
+	for id, entry := range x.books {
+		if !listed[id] {
+			x.removePostings(id, entry.Words)
+			delete(x.books, id)
+		}
+	}
+
+	return todo
+}
+
+func (x *epubIndex) extract(book epubResult) epubResult {
+	if book.err != nil {
+		return book
+	}
+
+	text, err := extractEpubText(filepath.Join(x.root, book.entry.Path))
+	if err != nil {
+		book.err = err
+
+		return book
+	}
+
+	words := splitText(text)
+	slices.Sort(words)
+	book.entry.Words = slices.Compact(words)
+
+	return book
+}
+
+// index reads every changed file with a bounded pool of workers, adding
+// each book to the index as soon as it is read.
+func (x *epubIndex) index(books []epubBook, ctx context.Context) {
+	started := time.Now()
+	todo := x.changed(books)
+
+	jobs := make(chan epubResult)
+	results := make(chan epubResult)
+
+	var workers sync.WaitGroup
+
+	for range x.workers {
+		workers.Go(func() {
+			for book := range jobs {
+				results <- x.extract(book)
+			}
+		})
+	}
+
+	go func() {
+		defer close(results)
+		defer workers.Wait()
+		defer close(jobs)
+
+		for _, book := range todo {
+			select {
+			case jobs <- book:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for result := range results {
+		x.mu.Lock()
+
+		if result.err != nil {
+			Logger(ctx).Warn(
+				"cannot index the text of a book",
+				"book", result.id,
+				"error", result.err,
+			)
+			x.progress.Failed++
+		} else {
+			if previous, found := x.books[result.id]; found {
+				x.removePostings(result.id, previous.Words)
+			}
+
+			x.books[result.id] = result.entry
+			x.addPostings(result.id, result.entry.Words)
+		}
+
+		x.progress.Indexed++
+
+		if x.progress.Indexed%epubProgressStep == 0 {
+			Logger(ctx).Info(
+				"indexing the text of books",
+				"indexed", x.progress.Indexed,
+				"total", x.progress.Total,
+			)
+		}
+
+		x.mu.Unlock()
+	}
+
+	progress := x.Progress()
+	Logger(ctx).Info(
+		"indexed the text of books",
+		"indexed", progress.Indexed,
+		"total", progress.Total,
+		"read", len(todo),
+		"failed", progress.Failed,
+		"duration", time.Since(started).Round(time.Millisecond),
+	)
+}
+
+// find returns the books, in Calibre id order, containing every word.
+func (x *epubIndex) find(words []Word) []uint16 {
+	words = slices.Compact(slices.Sorted(slices.Values(words)))
+	counts := make(map[uint16]int)
+
+	x.mu.RLock()
+
+	for _, word := range words {
+		for _, id := range x.postings[word] {
+			counts[id]++
+		}
+	}
+
+	x.mu.RUnlock()
+
+	var found []uint16
+
+	for id, count := range counts {
+		if count == len(words) {
+			found = append(found, id)
+		}
+	}
+
+	slices.Sort(found)
+
+	return found
+}
+
+// search returns the books containing every word of the terms, quoting
+// the first of them from the files of the books, a few read at once.
+func (x *epubIndex) search(
+	ctx context.Context,
+	terms []string,
+) (map[uint16]Snippet, error) {
+	var words []Word
+
+	for _, term := range terms {
+		words = append(words, splitText(term)...)
+	}
+
+	matches := make(map[uint16]Snippet)
+
+	if len(words) == 0 {
+		return matches, nil
+	}
+
+	found := x.find(words)
+	snippets := make([]Snippet, min(len(found), epubSnippetLimit))
+	slots := make(chan struct{}, x.workers)
+
+	var quoting sync.WaitGroup
+
+	for i := range snippets {
+		quoting.Go(func() {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if ctx.Err() == nil {
+				snippets[i] = x.snippet(found[i], words, ctx)
+			}
+		})
+	}
+
+	quoting.Wait()
+
+	for i, id := range found {
+		matches[id] = nil
+
+		if i < len(snippets) {
+			matches[id] = snippets[i]
+		}
+	}
+
+	return matches, nil
+}
+
+// snippet reads the text of a book again to quote it. Books whose file
+// cannot be read any more are found without a quote.
+func (x *epubIndex) snippet(
+	id uint16,
+	words []Word,
+	ctx context.Context,
+) Snippet {
+	x.mu.RLock()
+	path := x.books[id].Path
+	x.mu.RUnlock()
+
+	text, err := extractEpubText(filepath.Join(x.root, path))
+	if err != nil {
+		Logger(ctx).Debug(
+			"error quoting book text",
+			"book", id,
+			"error", err,
+		)
+
+		return nil
+	}
+
+	return bookSnippet(text, words)
+}
+
+// bookSnippet quotes the text of a book around the first of the words,
+// looking through it a window at a time rather than splitting it into
+// words all at once.
+func bookSnippet(text string, words []Word) Snippet {
+	wanted := snippetWords(words)
+
+	for offset := 0; offset < len(text); {
+		end := offset + alignEnd(text[offset:], epubSnippetWindow)
+
+		for _, span := range textSpans(text[offset:end]) {
+			word := text[offset+span[0] : offset+span[1]]
+			if !wanted[transliterate(normalizeWord(word))] {
+				continue
+			}
+
+			// Enough text on both sides for textSnippet to cut its own.
+			position := offset + span[0]
+			start := max(0, position-2*fallbackContext)
+
+			for !utf8.RuneStart(text[start]) {
+				start--
+			}
+
+			stop := position + alignEnd(text[position:], 2*fallbackLength)
+
+			return textSnippet(text[start:stop], words)
+		}
+
+		offset = end
+	}
+
+	return nil
+}
+
+// epubBooks lists the books with an EPUB.
+func (b *BookEntries) epubBooks() []epubBook {
+	var books []epubBook
+
+	for id, book := range b.books {
+		if path, found := b.formatPath(BookEntryId(id), epubFormat); found {
+			books = append(books, epubBook{id: book.ID, path: path})
+		}
+	}
+
+	return books
+}
@@ -0,0 +1,245 @@
+package booksdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	isbn10Length = 10
+	isbn13Length = 13
+	isbn10Mod    = 11
+	isbn13Mod    = 10
+	isbn13Prefix = "978"
+)
+
+var (
+	ErrInvalidIsbn         = errors.New("invalid ISBN")
+	ErrInvalidIsbnChecksum = errors.New("invalid ISBN checksum")
+)
+
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// cleanIsbn drops the separators people and barcode scanners put in ISBNs.
+func cleanIsbn(isbn string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '.':
+			return -1
+		case 'x':
+			return 'X'
+		default:
+			return r
+		}
+	}, strings.TrimSpace(isbn))
+}
+
+func isbn10Valid(isbn string) bool {
+	sum := 0
+
+	for i, r := range isbn {
+		digit := int(r - '0')
+
+		switch {
+		case r == 'X' && i == isbn10Length-1:
+			digit = 10
+		case r < '0' || r > '9':
+			return false
+		}
+
+		sum += digit * (isbn10Length - i)
+	}
+
+	return sum%isbn10Mod == 0
+}
+
+func isbn13CheckDigit(digits string) (byte, bool) {
+	sum := 0
+
+	for i, r := range digits {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+
+		sum += int(r-'0') * weight
+	}
+
+	return byte('0' + (isbn13Mod-sum%isbn13Mod)%isbn13Mod), true
+}
+
+// NormalizeIsbn validates an ISBN-10 or ISBN-13, ignoring hyphens and
+// spaces, and returns it as an ISBN-13 so both forms compare equal.
+func NormalizeIsbn(isbn string) (string, error) {
+	cleaned := cleanIsbn(isbn)
+
+	switch len(cleaned) {
+	case isbn10Length:
+		if !isbn10Valid(cleaned) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidIsbnChecksum, isbn)
+		}
+
+		digits := isbn13Prefix + cleaned[:isbn10Length-1]
+		check, _ := isbn13CheckDigit(digits)
+
+		return digits + string(check), nil
+	case isbn13Length:
+		check, ok := isbn13CheckDigit(cleaned[:isbn13Length-1])
+		if !ok {
+			return "", fmt.Errorf("%w: %q", ErrInvalidIsbn, isbn)
+		}
+
+		if check != cleaned[isbn13Length-1] {
+			return "", fmt.Errorf("%w: %q", ErrInvalidIsbnChecksum, isbn)
+		}
+
+		return cleaned, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidIsbn, isbn)
+	}
+}
+
+// normalizeIdentifier builds the exact-match key of an identifier. ISBNs are
+// validated and converted to ISBN-13, other values only compare case
+// insensitively.
+func normalizeIdentifier(idType, value string) (Identifier, error) {
+	key := Identifier{
+		Type:  strings.ToLower(strings.TrimSpace(idType)),
+		Value: strings.ToLower(strings.TrimSpace(value)),
+	}
+
+	if key.Type == "isbn" {
+		isbn, err := NormalizeIsbn(value)
+		if err != nil {
+			return key, err
+		}
+
+		key.Value = isbn
+	}
+
+	return key, nil
+}
+
+type identifierIndex map[Identifier][]BookEntryId
+
+func (b *BookEntries) loadIdentifiers(
+	repo *BookRepository,
+	ctx context.Context,
+) error {
+	rows, err := repo.BookIdentifiers(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing identifiers: %w", err)
+	}
+
+	b.identifiers = make([][]Identifier, len(b.books))
+	b.identifierIndex = make(identifierIndex, len(rows))
+
+	for _, row := range rows {
+		entryId, found := b.bookIds[uint16(row.Book)]
+		if !found {
+			continue
+		}
+
+		b.addIdentifier(entryId, row.Type, row.Val)
+	}
+
+	return nil
+}
+
+// addIdentifier lists an identifier of a book and indexes it. Malformed
+// ISBNs are indexed by their literal value, which lookups fall back to.
+func (b *BookEntries) addIdentifier(
+	entryId BookEntryId,
+	idType, value string,
+) {
+	key, err := normalizeIdentifier(idType, value)
+	if err != nil {
+		key = literalIdentifier(key, value)
+	}
+
+	// books.isbn usually repeats the isbn row of identifiers.
+	if slices.Contains(b.identifierIndex[key], entryId) {
+		return
+	}
+
+	b.identifierIndex[key] = append(b.identifierIndex[key], entryId)
+	b.identifiers[entryId] = append(
+		b.identifiers[entryId],
+		Identifier{Type: key.Type, Value: value},
+	)
+}
+
+// literalIdentifier is the key of an identifier that does not normalize,
+// such as an ISBN with a wrong check digit, stripped of separators only.
+func literalIdentifier(key Identifier, value string) Identifier {
+	key.Value = cleanIsbn(value)
+
+	return key
+}
+
+// identifierFilter selects books having an identifier equal to key.
+type identifierFilter struct {
+	key Identifier
+}
+
+func (f identifierFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	for _, id := range entries.identifierIndex[f.key] {
+		set.add(id)
+	}
+
+	return set
+}
+
+// identifierFieldParser looks values up like FindByIdentifier, except that
+// a malformed ISBN no book has simply matches nothing.
+func identifierFieldParser(idType string) fieldParser {
+	return func(value string, _ time.Time) (queryFilter, error) {
+		key, err := normalizeIdentifier(idType, value)
+		if err != nil {
+			key = literalIdentifier(key, value)
+		}
+
+		return identifierFilter{key: key}, nil
+	}
+}
+
+// parseTypedIdentifier handles the generic identifier:type:value form.
+func parseTypedIdentifier(value string, now time.Time) (queryFilter, error) {
+	idType, idValue, found := strings.Cut(value, ":")
+	if !found || idType == "" || idValue == "" {
+		return nil, fmt.Errorf("expected type:value, got %q", value)
+	}
+
+	return identifierFieldParser(idType)(idValue, now)
+}
+
+// FindByIdentifier returns the books with the given identifier, e.g. all
+// copies of an ISBN, within scope. A malformed ISBN is an error unless a
+// book of the library has it as it is.
+func (b *BookEntries) FindByIdentifier(
+	idType, value string,
+	scope Scope,
+) (BookEntrySlice, error) {
+	key, err := normalizeIdentifier(idType, value)
+	if err != nil {
+		key = literalIdentifier(key, value)
+		if _, found := b.identifierIndex[key]; !found {
+			return nil, err
+		}
+	}
+
+	return b.selectIds(scope.filter(b.identifierIndex[key])), nil
+}
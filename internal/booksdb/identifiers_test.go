@@ -0,0 +1,79 @@
+package booksdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNormalizeIsbn(t *testing.T) {
+	isbnCases := []struct {
+		isbn string
+		want string
+		err  error
+	}{
+		{"9780261102354", "9780261102354", nil},
+		{"978-0-261-10235-4", "9780261102354", nil},
+		{"0261102354", "9780261102354", nil},
+		{"0-261-10235-4", "9780261102354", nil},
+		{" 0 261 10235 4 ", "9780261102354", nil},
+		{"080442957X", "9780804429573", nil},
+		{"080442957x", "9780804429573", nil},
+		{"9791032305690", "9791032305690", nil},
+		{"0261102355", "", ErrInvalidIsbnChecksum},
+		{"9780261102355", "", ErrInvalidIsbnChecksum},
+		{"97802611023", "", ErrInvalidIsbn},
+		{"97802611023AB", "", ErrInvalidIsbn},
+		{"", "", ErrInvalidIsbn},
+	}
+
+	for _, tc := range isbnCases {
+		got, err := NormalizeIsbn(tc.isbn)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("NormalizeIsbn(%q) error = %v, want %v", tc.isbn, err, tc.err)
+
+			continue
+		}
+
+		if got != tc.want {
+			t.Errorf("NormalizeIsbn(%q) = %q, want %q", tc.isbn, got, tc.want)
+		}
+	}
+}
+
+func TestMalformedIsbnLookup(t *testing.T) {
+	entries := newCalibreTestEntries()
+	entries.identifiers = make([][]Identifier, entries.NumBooks())
+	entries.identifierIndex = make(identifierIndex)
+	entries.addIdentifier(0, "isbn", "978-0-261-10221-7")
+	entries.addIdentifier(1, "isbn", "978-0-261-10235-5")
+
+	found, err := entries.FindByIdentifier("isbn", "9780261102355", Scope{})
+	if err != nil || len(found) != 1 || found[0].ID != 2 {
+		t.Errorf("FindByIdentifier(malformed) = %v, %v, want Guards! Guards!", found, err)
+	}
+
+	if _, err := entries.FindByIdentifier("isbn", "0261102355", Scope{}); !errors.Is(err, ErrInvalidIsbnChecksum) {
+		t.Errorf("FindByIdentifier(unknown malformed) error = %v, want %v", err, ErrInvalidIsbnChecksum)
+	}
+
+	queryCases := map[string]int{
+		"isbn:978-0261102355": 2,
+		"isbn:0261102214":     1,
+		"isbn:0261102355":     0,
+		"isbn:97802611023":    0,
+	}
+
+	for query, want := range queryCases {
+		results, err := entries.Search(query, context.Background(), SearchOptions{})
+		if err != nil {
+			t.Errorf("Search(%q) error = %v", query, err)
+
+			continue
+		}
+
+		if len(results.Books) != min(want, 1) || want > 0 && results.Books[0].ID != uint16(want) {
+			t.Errorf("Search(%q) = %v, want book %d", query, results.Books, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package booksdb
+
+import "math/bits"
+
+const bitsPerBlock = 64
+
+// bookIdSet is a fixed-size bitset over the entries of a BookEntries
+// snapshot, used to combine the results of query filters.
+type bookIdSet []uint64
+
+func newBookIdSet(capacity int) bookIdSet {
+	return make(bookIdSet, (capacity+bitsPerBlock-1)/bitsPerBlock)
+}
+
+func newFullBookIdSet(capacity int) bookIdSet {
+	set := newBookIdSet(capacity)
+
+	for i := range capacity {
+		set.add(BookEntryId(i))
+	}
+
+	return set
+}
+
+func (set bookIdSet) add(id BookEntryId) {
+	set[int(id)/bitsPerBlock] |= 1 << (uint(id) % bitsPerBlock)
+}
+
+func (set bookIdSet) has(id BookEntryId) bool {
+	return set[int(id)/bitsPerBlock]&(1<<(uint(id)%bitsPerBlock)) != 0
+}
+
+func (set bookIdSet) intersect(other bookIdSet) {
+	for i := range set {
+		set[i] &= other[i]
+	}
+}
+
+func (set bookIdSet) union(other bookIdSet) {
+	for i := range set {
+		set[i] |= other[i]
+	}
+}
+
+// complement flips every member of a set holding capacity entries.
+func (set bookIdSet) complement(capacity int) {
+	for i := range set {
+		set[i] = ^set[i]
+	}
+
+	if tail := capacity % bitsPerBlock; tail != 0 {
+		set[len(set)-1] &= 1<<tail - 1
+	}
+}
+
+func (set bookIdSet) clone() bookIdSet {
+	return append(bookIdSet(nil), set...)
+}
+
+func (set bookIdSet) count() (total int) {
+	for _, block := range set {
+		total += bits.OnesCount64(block)
+	}
+
+	return total
+}
+
+// countIn counts the members of the set also in other.
+func (set bookIdSet) countIn(other bookIdSet) (total int) {
+	for i, block := range set {
+		total += bits.OnesCount64(block & other[i])
+	}
+
+	return total
+}
+
+// ids returns the members of the set in ascending order.
+func (set bookIdSet) ids() []BookEntryId {
+	ids := make([]BookEntryId, 0, set.count())
+
+	for i, block := range set {
+		for block != 0 {
+			offset := bits.TrailingZeros64(block)
+			ids = append(ids, BookEntryId(i*bitsPerBlock+offset))
+			block &= block - 1
+		}
+	}
+
+	return ids
+}
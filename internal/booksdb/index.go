@@ -24,6 +24,16 @@ func splitTitle(title string) []Word {
 	))
 }
 
+// titleSize is what the score of a title is normalized by, together with
+// the length of the query: the length of its last word.
+func titleSize(words []Word) Count {
+	if len(words) == 0 {
+		return 0
+	}
+
+	return Count(len(words[len(words)-1]))
+}
+
 type BookSearchIndex struct {
 	words    map[Word][]BookEntryId
 	numWords []Count
@@ -42,13 +52,12 @@ func NewTitleIndex(titles []string) (index *BookSearchIndex) {
 	for id, title := range titles {
 		entryId := BookEntryId(id)
 
-		for _, word := range splitTitle(title) {
-			index.numWords[entryId] = Count(len(word))
+		words := splitTitle(title)
+		index.numWords[entryId] = titleSize(words)
 
-			if ids, found := index.words[word]; found {
-				index.words[word] = append(ids, entryId)
-			} else {
-				index.words[word] = []BookEntryId{entryId}
+		for _, word := range words {
+			for _, form := range wordForms(word) {
+				index.words[form] = append(index.words[form], entryId)
 			}
 		}
 	}
@@ -79,28 +88,54 @@ func (index *BookSearchIndex) findSimilar(
 		for _, bookId := range index.words[word] {
 			counts[bookId]++
 		}
+
+		latin := transliterate(word)
+		if latin == word {
+			continue
+		}
+
+		// Books found by the word as typed already counted it.
+		typed := make(map[BookEntryId]bool, len(index.words[word]))
+		for _, bookId := range index.words[word] {
+			typed[bookId] = true
+		}
+
+		for _, bookId := range index.words[latin] {
+			if !typed[bookId] {
+				counts[bookId]++
+			}
+		}
 	}
 
-	scores := make([]SimilarityIndexScore, len(counts))
+	scores := make([]SimilarityIndexScore, 0, len(counts))
 	querySize := Count(len(words))
-	i := 0
 
 	for bookId, count := range counts {
-		scores[i] = SimilarityIndexScore{
-			id: bookId,
-			score: float32(
-				count,
-			) / float32(
-				index.numWords[bookId]+querySize-count,
-			),
-		}
-		i++
+		scores = append(scores, SimilarityIndexScore{
+			id:    bookId,
+			score: similarity(count, index.numWords[bookId], querySize),
+		})
 	}
 
+	return rankBySimilarity(scores)
+}
+
+// similarity scores a title of the given size sharing count words with
+// a query of querySize words.
+func similarity(count, size, querySize Count) float32 {
+	return float32(count) / float32(size+querySize-count)
+}
+
+// rankBySimilarity orders books by score, best first, and books scoring
+// the same by id, so every Searcher ranks them alike.
+func rankBySimilarity(scores []SimilarityIndexScore) []BookEntryId {
 	slices.SortFunc(
 		scores,
 		func(left, right SimilarityIndexScore) int {
-			return cmp.Compare(right.score, left.score)
+			return cmp.Or(
+				cmp.Compare(right.score, left.score),
+				cmp.Compare(left.id, right.id),
+			)
 		},
 	)
 
@@ -2,6 +2,7 @@ package booksdb
 
 import (
 	"cmp"
+	"context"
 	"math/rand"
 	"slices"
 	"strings"
@@ -176,3 +177,27 @@ func BenchmarkFindSimilarScaling(b *testing.B) {
 		})
 	}
 }
+
+func BenchmarkSearchers(b *testing.B) {
+	for _, tc := range testCases {
+		titles := generateTitles(tc.numBooks, tc.maxTitleLength)
+		query := generateQueryWords(tc.querySize)
+
+		searchers := newTestSearchers(b, titles)
+		assertSameRanking(b, searchers, query)
+
+		for _, backend := range []SearchBackend{SearchMemory, SearchFts} {
+			searcher := searchers[backend.String()]
+
+			b.Run(backend.String()+"_"+tc.name, func(b *testing.B) {
+				ctx := context.Background()
+
+				for b.Loop() {
+					if _, err := searcher.FindSimilar(query, ctx); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
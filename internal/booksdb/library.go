@@ -0,0 +1,297 @@
+package booksdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// namedSearches holds the saved searches and virtual libraries as
+// evaluated on one day, so relative dates such as date:<30daysago move
+// with the calendar.
+type namedSearches struct {
+	day       string
+	saved     []NamedSearch
+	libraries []NamedSearch
+}
+
+const (
+	savedSearchesPreference    = "saved_searches"
+	virtualLibrariesPreference = "virtual_libraries"
+)
+
+var (
+	ErrUnknownLibrary     = errors.New("unknown virtual library")
+	ErrUnknownSavedSearch = errors.New("unknown saved search")
+)
+
+// NamedSearch is a search stored in Calibre, either a saved search or the
+// definition of a virtual library. Error is set when the query uses syntax
+// the browser cannot evaluate; such searches are listed but select nothing.
+type NamedSearch struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	Count int    `json:"count"`
+	Error string `json:"error,omitempty"`
+
+	books bookIdSet
+}
+
+// Scope limits what a request sees to a subset of the library, e.g. a
+// virtual library. The zero Scope covers every book; LibraryScope makes
+// scopes that respect the restriction of the user asking.
+type Scope struct {
+	Library string
+
+	books bookIdSet
+	// key identifies the scope within a library snapshot, for caches; it is
+	// empty for scopes LibraryScope did not make.
+	key string
+}
+
+func (s Scope) allows(id BookEntryId) bool {
+	return s.books == nil || s.books.has(id)
+}
+
+// filter returns the allowed ids without modifying ids.
+func (s Scope) filter(ids []BookEntryId) []BookEntryId {
+	if s.books == nil {
+		return ids
+	}
+
+	allowed := make([]BookEntryId, 0, len(ids))
+
+	for _, id := range ids {
+		if s.books.has(id) {
+			allowed = append(allowed, id)
+		}
+	}
+
+	return allowed
+}
+
+// newSet returns the allowed books as a set the caller may modify.
+func (s Scope) newSet(capacity int) bookIdSet {
+	if s.books == nil {
+		return newFullBookIdSet(capacity)
+	}
+
+	return s.books.clone()
+}
+
+// loadPreference reads a JSON object of names to Calibre queries stored in
+// the preferences table. Libraries that never saved one have no row.
+func loadPreference(
+	repo *BookRepository,
+	ctx context.Context,
+	key string,
+) (map[string]string, error) {
+	raw, err := repo.Preference(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading preference %q: %w", key, err)
+	}
+
+	var searches map[string]string
+	if err := json.Unmarshal([]byte(raw), &searches); err != nil {
+		return nil, fmt.Errorf("error decoding preference %q: %w", key, err)
+	}
+
+	return searches, nil
+}
+
+// evaluateSearches runs every query once a day, so filtering by a saved
+// search or virtual library in between is a set intersection.
+func (b *BookEntries) evaluateSearches(
+	queries map[string]string,
+	savedSearches map[string]string,
+	now time.Time,
+	sortKeys *sortKeys,
+	ctx context.Context,
+) []NamedSearch {
+	searches := make([]NamedSearch, 0, len(queries))
+
+	for name, query := range queries {
+		search := NamedSearch{Name: name, Query: query}
+
+		filter, err := b.parseCalibreQuery(query, now, savedSearches, 0)
+		if err != nil {
+			Logger(ctx).Warn("skipping Calibre search", "name", name, "error", err)
+			search.Error = err.Error()
+			search.books = newBookIdSet(b.NumBooks())
+		} else {
+			search.books = filter.selectIds(b, ctx)
+		}
+
+		search.Count = search.books.count()
+		searches = append(searches, search)
+	}
+
+	keys := make(map[string][]byte, len(searches))
+
+	for _, search := range searches {
+		keys[search.Name] = sortKeys.key(search.Name)
+	}
+
+	slices.SortFunc(searches, func(left, right NamedSearch) int {
+		return compareKeys(keys[left.Name], keys[right.Name], left.Name, right.Name)
+	})
+
+	return searches
+}
+
+func (b *BookEntries) loadNamedSearches(
+	repo *BookRepository,
+	ctx context.Context,
+) error {
+	savedSearches, err := loadPreference(repo, ctx, savedSearchesPreference)
+	if err != nil {
+		return err
+	}
+
+	libraries, err := loadPreference(repo, ctx, virtualLibrariesPreference)
+	if err != nil {
+		return err
+	}
+
+	b.savedQueries = savedSearches
+	b.libraryQueries = libraries
+	b.searchKeys = newSortKeys(repo.options.Locale)
+	b.namedSearchesOn(time.Now(), ctx)
+
+	return nil
+}
+
+// namedSearches returns the saved searches and virtual libraries as of
+// today, evaluating them again on the first call of each day.
+func (b *BookEntries) namedSearches(ctx context.Context) *namedSearches {
+	return b.namedSearchesOn(time.Now(), ctx)
+}
+
+func (b *BookEntries) namedSearchesOn(
+	now time.Time,
+	ctx context.Context,
+) *namedSearches {
+	day := now.Format(time.DateOnly)
+	if named := b.named.Load(); named != nil && named.day == day {
+		return named
+	}
+
+	b.evaluating.Lock()
+	defer b.evaluating.Unlock()
+
+	if named := b.named.Load(); named != nil && named.day == day {
+		return named
+	}
+
+	// Every request shares the results, so one going away must not cut
+	// the evaluation short.
+	ctx = context.WithoutCancel(ctx)
+	named := &namedSearches{
+		day: day,
+		saved: b.evaluateSearches(
+			b.savedQueries,
+			b.savedQueries,
+			now,
+			b.searchKeys,
+			ctx,
+		),
+		libraries: b.evaluateSearches(
+			b.libraryQueries,
+			b.savedQueries,
+			now,
+			b.searchKeys,
+			ctx,
+		),
+	}
+
+	// Restrictions and scopes of other days may select other books.
+	b.named.Store(named)
+	b.restrictions.Clear()
+	b.tagTrees.Clear()
+
+	return named
+}
+
+func findNamedSearch(searches []NamedSearch, name string) (NamedSearch, bool) {
+	position := slices.IndexFunc(searches, func(search NamedSearch) bool {
+		return search.Name == name
+	})
+	if position < 0 {
+		return NamedSearch{}, false
+	}
+
+	return searches[position], true
+}
+
+// SavedSearches lists the saved searches of the library by name.
+func (b *BookEntries) SavedSearches(ctx context.Context) []NamedSearch {
+	return b.namedSearches(ctx).saved
+}
+
+// VirtualLibraries lists the virtual libraries of the library by name.
+func (b *BookEntries) VirtualLibraries(ctx context.Context) []NamedSearch {
+	return b.namedSearches(ctx).libraries
+}
+
+// NumBooksIn counts the books in scope.
+func (b *BookEntries) NumBooksIn(scope Scope) int {
+	if scope.books == nil {
+		return b.NumBooks()
+	}
+
+	return scope.books.count()
+}
+
+// CountIn returns copies of searches counting only the books in scope.
+func (b *BookEntries) CountIn(
+	searches []NamedSearch,
+	scope Scope,
+) []NamedSearch {
+	if scope.books == nil {
+		return searches
+	}
+
+	counted := slices.Clone(searches)
+
+	for i := range counted {
+		counted[i].Count = counted[i].books.countIn(scope.books)
+	}
+
+	return counted
+}
+
+// LibraryScope returns the scope of a virtual library, or of the whole
+// library for an empty name, within the restriction ctx carries, if any.
+func (b *BookEntries) LibraryScope(
+	name string,
+	ctx context.Context,
+) (Scope, error) {
+	named := b.namedSearches(ctx)
+	scope := Scope{Library: name}
+
+	if name != "" {
+		books, err := b.libraryBooks(named, name)
+		if err != nil {
+			return Scope{}, err
+		}
+
+		scope.books = books
+	}
+
+	scope = b.restrict(scope, ctx)
+	scope.key = strings.Join(
+		[]string{named.day, name, RestrictionFrom(ctx).key()},
+		"\x00",
+	)
+
+	return scope, nil
+}
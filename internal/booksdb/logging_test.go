@@ -0,0 +1,48 @@
+package booksdb
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSearchLogsToContextLogger(t *testing.T) {
+	entries := newCalibreTestEntries()
+	titles := make([]string, entries.NumBooks())
+
+	for id, book := range entries.books {
+		titles[id] = book.Title
+	}
+
+	entries.titles = NewTitleIndex(titles)
+
+	var output bytes.Buffer
+
+	logger := slog.New(slog.NewTextHandler(
+		&output,
+		&slog.HandlerOptions{Level: slog.LevelDebug},
+	)).With("request_id", "abc")
+
+	ctx := ContextWithLogger(context.Background(), logger)
+
+	if _, err := entries.Search("hobbit", ctx, SearchOptions{}); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`msg="search completed"`,
+		"request_id=abc",
+		"query=hobbit",
+		"books=1",
+	} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("log %q lacks %q", output.String(), want)
+		}
+	}
+
+	if Logger(context.Background()) != slog.Default() {
+		t.Error("Logger() without a logger in the context is not the default")
+	}
+}
@@ -0,0 +1,77 @@
+package booksdb
+
+import (
+	"context"
+	"fmt"
+)
+
+// BookFormat is one of the files Calibre keeps for a book, e.g. its EPUB.
+// Name is the file name in the book's directory, without the extension.
+type BookFormat struct {
+	Format string `json:"format"`
+	Size   int64  `json:"size"`
+	Name   string `json:"name"`
+}
+
+// loadMetadata reads the single-table fields searched with Calibre's
+// syntax: ratings (in stars, zero when unrated), formats, languages and
+// publishers.
+func (b *BookEntries) loadMetadata(
+	repo *BookRepository,
+	ctx context.Context,
+) error {
+	ratings, err := repo.BookRatings(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing ratings: %w", err)
+	}
+
+	formats, err := repo.BookFormats(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing formats: %w", err)
+	}
+
+	languages, err := repo.BookLanguages(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing languages: %w", err)
+	}
+
+	publishers, err := repo.BookPublishers(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing publishers: %w", err)
+	}
+
+	b.ratings = make([]float64, len(b.books))
+	b.formats = make([][]BookFormat, len(b.books))
+	b.languages = make([][]string, len(b.books))
+	b.publishers = make([]string, len(b.books))
+
+	for _, row := range ratings {
+		if entryId, found := b.bookIds[uint16(row.Book)]; found {
+			b.ratings[entryId] = float64(row.Rating.Int64) / ratingScale
+		}
+	}
+
+	for _, row := range formats {
+		if entryId, found := b.bookIds[uint16(row.Book)]; found {
+			b.formats[entryId] = append(b.formats[entryId], BookFormat{
+				Format: row.Format,
+				Size:   row.UncompressedSize,
+				Name:   row.Name,
+			})
+		}
+	}
+
+	for _, row := range languages {
+		if entryId, found := b.bookIds[uint16(row.Book)]; found {
+			b.languages[entryId] = append(b.languages[entryId], row.LangCode)
+		}
+	}
+
+	for _, row := range publishers {
+		if entryId, found := b.bookIds[uint16(row.Book)]; found {
+			b.publishers[entryId] = row.Name
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,405 @@
+package booksdb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// queryFilter narrows a search down to the books it selects. Filters of a
+// query are combined with AND.
+type queryFilter interface {
+	selectIds(entries *BookEntries, ctx context.Context) bookIdSet
+}
+
+type fieldParser func(value string, now time.Time) (queryFilter, error)
+
+func dateFieldParser(field DateField) fieldParser {
+	return func(value string, now time.Time) (queryFilter, error) {
+		return parseDateRange(field, value, now)
+	}
+}
+
+var queryFields = map[string]fieldParser{
+	"added":     dateFieldParser(DateAdded),
+	"date":      dateFieldParser(DateAdded),
+	"modified":  dateFieldParser(DateModified),
+	"published": dateFieldParser(DatePublished),
+	"pubdate":   dateFieldParser(DatePublished),
+
+	"author":  parseAuthorFilter,
+	"authors": parseAuthorFilter,
+	"tag":     parseTagFilter,
+	"tags":    parseTagFilter,
+
+	"isbn":        identifierFieldParser("isbn"),
+	"doi":         identifierFieldParser("doi"),
+	"amazon":      identifierFieldParser("amazon"),
+	"goodreads":   identifierFieldParser("goodreads"),
+	"google":      identifierFieldParser("google"),
+	"identifier":  parseTypedIdentifier,
+	"identifiers": parseTypedIdentifier,
+
+	"description": parseDescriptionFilter,
+	"comments":    parseDescriptionFilter,
+
+	"content": parseContentFilter,
+}
+
+// Query is a parsed search: free words matched against titles and
+// field:value filters such as added:>2024-01-01, published:1990..1999 or
+// #read:yes for custom columns.
+type Query struct {
+	words   []Word
+	filters []queryFilter
+	// content, when set, adds the books whose text contains the words.
+	content *contentFilter
+	// expansions select what the words stand for according to the synonym
+	// dictionary.
+	expansions []queryFilter
+}
+
+// ParseQuery splits a search string into words and field filters. Relative
+// dates are resolved against now. Tokens with an unknown field are treated
+// as plain words, while filters by unknown custom columns are errors.
+func (b *BookEntries) ParseQuery(
+	query string,
+	now time.Time,
+) (parsed Query, err error) {
+	var words []string
+
+	for _, token := range strings.Fields(query) {
+		name, value, found := strings.Cut(token, ":")
+
+		if label, custom := strings.CutPrefix(name, customColumnPrefix); custom &&
+			found && label != "" && value != "" {
+			filter, err := b.parseCustomColumnFilter(label, value, now)
+			if err != nil {
+				return parsed, fmt.Errorf("invalid %s filter: %w", name, err)
+			}
+
+			parsed.filters = append(parsed.filters, filter)
+
+			continue
+		}
+
+		parse, known := queryFields[strings.ToLower(name)]
+
+		if !found || !known || value == "" {
+			words = append(words, token)
+
+			continue
+		}
+
+		filter, err := parse(value, now)
+		if err != nil {
+			return parsed, fmt.Errorf("invalid %s filter: %w", name, err)
+		}
+
+		parsed.filters = append(parsed.filters, filter)
+	}
+
+	parsed.words = normalizeWordSlice(words)
+
+	return parsed, nil
+}
+
+func (q Query) IsEmpty() bool {
+	return len(q.words) == 0 && len(q.filters) == 0
+}
+
+// search returns ids ranked by title similarity, followed by the books
+// whose description contains every word and then by those found through
+// synonyms of the words, restricted to the books selected by every filter.
+// Descriptions and synonyms thus weigh less than titles. Queries with
+// filters only list matching books in library order.
+func (b *BookEntries) search(
+	query Query,
+	scope Scope,
+	ctx context.Context,
+) ([]BookEntryId, error) {
+	if query.IsEmpty() {
+		return nil, nil
+	}
+
+	var mask bookIdSet
+
+	if len(query.filters) > 0 || scope.books != nil {
+		mask = scope.newSet(b.NumBooks())
+
+		for _, filter := range query.filters {
+			mask.intersect(filter.selectIds(b, ctx))
+		}
+	}
+
+	if len(query.words) == 0 {
+		if mask == nil {
+			return nil, nil
+		}
+
+		return mask.ids(), nil
+	}
+
+	found, err := b.titles.FindSimilar(query.words, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if described := b.descriptionIndex.find(
+		query.words,
+		b.NumBooks(),
+	); described != nil {
+		found = appendMissing(found, described)
+	}
+
+	for _, expansion := range query.expansions {
+		found = appendMissing(found, expansion.selectIds(b, ctx))
+	}
+
+	if query.content != nil {
+		found = appendMissing(found, query.content.selectIds(b, ctx))
+	}
+
+	if mask != nil {
+		found = slices.DeleteFunc(found, func(id BookEntryId) bool {
+			return !mask.has(id)
+		})
+	}
+
+	return found, nil
+}
+
+// appendMissing appends the members of set not in ids, in library order.
+func appendMissing(ids []BookEntryId, set bookIdSet) []BookEntryId {
+	listed := make(map[BookEntryId]bool, len(ids))
+
+	for _, id := range ids {
+		listed[id] = true
+	}
+
+	for _, id := range set.ids() {
+		if !listed[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+func (b *BookEntries) selectIds(ids []BookEntryId) BookEntrySlice {
+	selected := make(BookEntrySlice, len(ids))
+
+	for i, bookId := range ids {
+		selected[i] = b.books[bookId]
+	}
+
+	return selected
+}
+
+// SearchTitles ranks books by the words their titles share with words.
+func (b *BookEntries) SearchTitles(words []string) (BookEntrySlice, error) {
+	found, err := b.titles.FindSimilar(
+		normalizeWordSlice(words),
+		context.Background(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.selectIds(found), nil
+}
+
+// QuerySyntax selects the language a search is written in.
+type QuerySyntax byte
+
+const (
+	// SyntaxSimple ranks titles by the free words and applies field:value
+	// filters.
+	SyntaxSimple QuerySyntax = iota
+	// SyntaxCalibre follows Calibre's search language and lists matches in
+	// library order.
+	SyntaxCalibre
+)
+
+func NewQuerySyntax(name string) QuerySyntax {
+	switch name {
+	case "calibre":
+		return SyntaxCalibre
+	default:
+		return SyntaxSimple
+	}
+}
+
+// SearchOptions narrow a search beyond its query.
+type SearchOptions struct {
+	Scope  Scope
+	Syntax QuerySyntax
+	// Saved is the name of a Calibre saved search the results must match.
+	Saved string
+	// Content also lists books whose text contains the free words of a
+	// simple query. Calibre syntax searches text with content: terms.
+	Content bool
+}
+
+// SearchResults are the matching books with, for books found by their
+// text, the passage that matched keyed by Calibre id. When nothing matches,
+// Suggestion may offer a corrected spelling of the query that does.
+type SearchResults struct {
+	Books      BookEntrySlice     `json:"books"`
+	Snippets   map[uint16]Snippet `json:"snippets,omitempty"`
+	Suggestion string             `json:"suggestion,omitempty"`
+}
+
+// snippets collects the passages quoted by the content filters of a query
+// for the listed books, reporting a failed content search as an error.
+func (b *BookEntries) snippets(
+	query Query,
+	ids []BookEntryId,
+) (map[uint16]Snippet, error) {
+	var results []*contentResult
+
+	for _, filter := range query.filters {
+		results = append(results, contentResults(filter)...)
+	}
+
+	if query.content != nil {
+		results = append(results, query.content.result)
+	}
+
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	snippets := make(map[uint16]Snippet)
+
+	for _, result := range results {
+		if result.err != nil {
+			return nil, result.err
+		}
+
+		for _, id := range ids {
+			bookId := b.books[id].ID
+
+			if _, found := snippets[bookId]; found {
+				continue
+			}
+
+			if snippet, found := result.snippets[id]; found {
+				snippets[bookId] = snippet
+			}
+		}
+	}
+
+	return snippets, nil
+}
+
+// parseCalibreSearch wraps a query in Calibre's syntax as a single filter.
+// search:name may refer to any saved search of the library.
+func (b *BookEntries) parseCalibreSearch(
+	query string,
+	now time.Time,
+) (parsed Query, err error) {
+	if strings.TrimSpace(query) == "" {
+		return parsed, nil
+	}
+
+	filter, err := b.parseCalibreQuery(query, now, b.savedQueries, 0)
+	if err != nil {
+		return parsed, err
+	}
+
+	parsed.filters = []queryFilter{filter}
+
+	return parsed, nil
+}
+
+// Search parses query and returns the matching books. It logs to the logger
+// ctx carries, if any.
+func (b *BookEntries) Search(
+	query string,
+	ctx context.Context,
+	options SearchOptions,
+) (results SearchResults, err error) {
+	now := time.Now()
+
+	parsed, ids, err := b.find(query, now, ctx, options)
+	if err != nil {
+		return results, err
+	}
+
+	if results.Snippets, err = b.snippets(parsed, ids); err != nil {
+		return results, err
+	}
+
+	results.Snippets = b.addDescriptionSnippets(parsed, ids, results.Snippets)
+
+	results.Books = b.selectIds(ids)
+
+	if len(results.Books) == 0 && len(parsed.words) > 0 {
+		results.Suggestion = b.suggest(query, now, ctx, options)
+	}
+
+	Logger(ctx).Debug(
+		"search completed",
+		"query", query,
+		"books", len(results.Books),
+		"duration", time.Since(now),
+	)
+
+	return results, nil
+}
+
+// find parses query and returns the ids of the books it matches, before
+// they are quoted and listed.
+func (b *BookEntries) find(
+	query string,
+	now time.Time,
+	ctx context.Context,
+	options SearchOptions,
+) (parsed Query, ids []BookEntryId, err error) {
+	switch options.Syntax {
+	case SyntaxCalibre:
+		parsed, err = b.parseCalibreSearch(query, now)
+	default:
+		parsed, err = b.ParseQuery(query, now)
+		parsed.expansions = b.expand(parsed.words, now)
+	}
+
+	if err != nil {
+		return parsed, nil, err
+	}
+
+	if options.Saved != "" {
+		saved, found := findNamedSearch(
+			b.namedSearches(ctx).saved,
+			options.Saved,
+		)
+		if !found {
+			return parsed, nil, fmt.Errorf(
+				"%w %q",
+				ErrUnknownSavedSearch,
+				options.Saved,
+			)
+		}
+
+		parsed.filters = append(parsed.filters, setFilter{books: saved.books})
+	}
+
+	if options.Content && len(parsed.words) > 0 && b.content != nil {
+		terms := make([]string, len(parsed.words))
+
+		for i, word := range parsed.words {
+			terms[i] = string(word)
+		}
+
+		content := newContentFilter(terms...)
+		parsed.content = &content
+	}
+
+	// Callers may pass any scope; the restriction of ctx always applies.
+	ids, err = b.search(parsed, b.restrict(options.Scope, ctx), ctx)
+
+	return parsed, ids, err
+}
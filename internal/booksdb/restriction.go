@@ -0,0 +1,248 @@
+package booksdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// RuleField is the metadata a restriction rule matches books by.
+type RuleField string
+
+const (
+	RuleTag      RuleField = "tag"
+	RuleLibrary  RuleField = "library"
+	RuleLanguage RuleField = "language"
+)
+
+var (
+	ErrUnknownRuleField = errors.New("unknown rule field")
+	ErrInvalidRule      = errors.New("invalid rule")
+)
+
+// Rule allows or denies the books whose field matches Value. Tags match
+// whole and case insensitively, together with the tags below them, so
+// "Adult" also covers "Adult.Horror". Libraries are Calibre's virtual
+// libraries by name. Languages match by ISO 639 code, e.g. "en" or "eng".
+type Rule struct {
+	Allow bool
+	Field RuleField
+	Value string
+}
+
+// NewRule checks the field and value of a rule.
+func NewRule(allow bool, field string, value string) (Rule, error) {
+	rule := Rule{Allow: allow, Field: RuleField(field), Value: value}
+
+	switch rule.Field {
+	case RuleTag, RuleLibrary:
+		if strings.TrimSpace(value) == "" {
+			return rule, fmt.Errorf("%w: empty %s", ErrInvalidRule, field)
+		}
+	case RuleLanguage:
+		if _, err := language.Parse(value); err != nil {
+			return rule, fmt.Errorf("%w: language %q: %w", ErrInvalidRule, value, err)
+		}
+	default:
+		return rule, fmt.Errorf("%w %q", ErrUnknownRuleField, field)
+	}
+
+	return rule, nil
+}
+
+func (r Rule) String() string {
+	verb := "deny"
+	if r.Allow {
+		verb = "allow"
+	}
+
+	return fmt.Sprintf("%s %s %q", verb, r.Field, r.Value)
+}
+
+// Restriction limits a user to part of the library. A book is visible when
+// it matches an allow rule of every field that has some, and no deny rule.
+// The zero Restriction allows every book.
+type Restriction []Rule
+
+func (r Restriction) key() string {
+	rules := make([]string, len(r))
+
+	for i, rule := range r {
+		rules[i] = rule.String()
+	}
+
+	return strings.Join(rules, "\n")
+}
+
+type restrictionKey struct{}
+
+// ContextWithRestriction returns a copy of ctx limiting the scopes made
+// with it to the books restriction allows.
+func ContextWithRestriction(
+	ctx context.Context,
+	restriction Restriction,
+) context.Context {
+	return context.WithValue(ctx, restrictionKey{}, restriction)
+}
+
+// RestrictionFrom returns the restriction ctx carries, if any.
+func RestrictionFrom(ctx context.Context) Restriction {
+	restriction, _ := ctx.Value(restrictionKey{}).(Restriction)
+
+	return restriction
+}
+
+// ruleBooks returns the books a rule matches. A rule that cannot be
+// evaluated, e.g. naming a virtual library that is gone, matches every
+// book when denying and none when allowing, so it hides rather than
+// leaks.
+func (b *BookEntries) ruleBooks(rule Rule, ctx context.Context) bookIdSet {
+	var (
+		books bookIdSet
+		err   error
+	)
+
+	switch rule.Field {
+	case RuleTag:
+		books = textFilter{
+			fields: []bookTexts{tagTexts},
+			match: textMatcher{
+				exact:       true,
+				descendants: true,
+				value:       normalizeWord(rule.Value),
+			},
+		}.selectIds(b, ctx)
+	case RuleLibrary:
+		books, err = b.libraryBooks(b.namedSearches(ctx), rule.Value)
+	case RuleLanguage:
+		books, err = b.languageBooks(rule.Value)
+	default:
+		err = fmt.Errorf("%w %q", ErrUnknownRuleField, rule.Field)
+	}
+
+	if err != nil {
+		Logger(ctx).Warn(
+			"cannot evaluate restriction rule",
+			"rule", rule.String(),
+			"error", err,
+		)
+
+		books = newBookIdSet(b.NumBooks())
+		if !rule.Allow {
+			books.complement(b.NumBooks())
+		}
+	}
+
+	return books
+}
+
+func (b *BookEntries) libraryBooks(
+	named *namedSearches,
+	name string,
+) (bookIdSet, error) {
+	library, found := findNamedSearch(named.libraries, name)
+	if !found {
+		return nil, fmt.Errorf("%w %q", ErrUnknownLibrary, name)
+	}
+
+	if library.Error != "" {
+		return nil, fmt.Errorf(
+			"virtual library %q cannot be used: %s",
+			name,
+			library.Error,
+		)
+	}
+
+	return library.books, nil
+}
+
+func (b *BookEntries) languageBooks(code string) (bookIdSet, error) {
+	tag, err := language.Parse(code)
+	if err != nil {
+		return nil, fmt.Errorf("invalid language %q: %w", code, err)
+	}
+
+	base, _ := tag.Base()
+	books := newBookIdSet(b.NumBooks())
+
+	for id, codes := range b.languages {
+		for _, bookCode := range codes {
+			if bookTag, err := language.Parse(bookCode); err == nil {
+				if bookBase, _ := bookTag.Base(); bookBase == base {
+					books.add(BookEntryId(id))
+
+					break
+				}
+			}
+		}
+	}
+
+	return books, nil
+}
+
+// restrictedBooks returns the books a restriction allows, nil for all.
+// The set is computed once per restriction, library snapshot and day.
+func (b *BookEntries) restrictedBooks(
+	restriction Restriction,
+	ctx context.Context,
+) bookIdSet {
+	if len(restriction) == 0 {
+		return nil
+	}
+
+	key := b.namedSearches(ctx).day + "\x00" + restriction.key()
+	if books, found := b.restrictions.Load(key); found {
+		return books.(bookIdSet)
+	}
+
+	books := newFullBookIdSet(b.NumBooks())
+	allowed := make(map[RuleField]bookIdSet)
+
+	for _, rule := range restriction {
+		matched := b.ruleBooks(rule, ctx)
+
+		if !rule.Allow {
+			denied := matched.clone()
+			denied.complement(b.NumBooks())
+			books.intersect(denied)
+
+			continue
+		}
+
+		if field, found := allowed[rule.Field]; found {
+			field.union(matched)
+		} else {
+			allowed[rule.Field] = matched.clone()
+		}
+	}
+
+	for _, field := range allowed {
+		books.intersect(field)
+	}
+
+	b.restrictions.Store(key, books)
+
+	return books
+}
+
+// restrict narrows a scope to the books the restriction of ctx allows.
+func (b *BookEntries) restrict(scope Scope, ctx context.Context) Scope {
+	restricted := b.restrictedBooks(RestrictionFrom(ctx), ctx)
+	if restricted == nil {
+		return scope
+	}
+
+	if scope.books == nil {
+		scope.books = restricted
+
+		return scope
+	}
+
+	scope.books = scope.books.clone()
+	scope.books.intersect(restricted)
+
+	return scope
+}
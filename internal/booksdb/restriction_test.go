@@ -0,0 +1,200 @@
+package booksdb
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+func newRestrictionTestEntries() *BookEntries {
+	entries := newCalibreTestEntries()
+	entries.libraryQueries = map[string]string{"Discworld": "series:discworld"}
+	entries.searchKeys = newSortKeys(language.Und)
+
+	return entries
+}
+
+func TestRestriction(t *testing.T) {
+	entries := newRestrictionTestEntries()
+
+	allow := func(field RuleField, value string) Rule {
+		return Rule{Allow: true, Field: field, Value: value}
+	}
+	deny := func(field RuleField, value string) Rule {
+		return Rule{Field: field, Value: value}
+	}
+
+	restrictionCases := []struct {
+		name        string
+		restriction Restriction
+		want        []BookEntryId
+	}{
+		{"none", nil, []BookEntryId{0, 1, 2, 3}},
+		{"tag with descendants", Restriction{
+			allow(RuleTag, "fiction"),
+		}, []BookEntryId{0, 1, 3}},
+		{"denied tag", Restriction{
+			deny(RuleTag, "Humor"),
+		}, []BookEntryId{0, 1, 3}},
+		{"denied tag below", Restriction{
+			deny(RuleTag, "Fiction.Fantasy"),
+		}, []BookEntryId{2, 3}},
+		{"language", Restriction{
+			allow(RuleLanguage, "pl"),
+		}, []BookEntryId{2}},
+		{"library", Restriction{
+			allow(RuleLibrary, "Discworld"),
+		}, []BookEntryId{1, 2}},
+		{"library without a tag", Restriction{
+			allow(RuleLibrary, "Discworld"),
+			deny(RuleTag, "humor"),
+		}, []BookEntryId{1}},
+		{"any allowed tag", Restriction{
+			allow(RuleTag, "read"),
+			allow(RuleTag, "humor"),
+		}, []BookEntryId{0, 2}},
+		{"every allowed field", Restriction{
+			allow(RuleTag, "humor"),
+			allow(RuleLanguage, "eng"),
+			allow(RuleLibrary, "Discworld"),
+		}, []BookEntryId{2}},
+		{"unknown library allowed", Restriction{
+			allow(RuleLibrary, "Missing"),
+		}, nil},
+		{"unknown library denied", Restriction{
+			deny(RuleLibrary, "Missing"),
+		}, nil},
+		{"unknown field", Restriction{
+			deny(RuleField("author"), "Smith"),
+		}, nil},
+	}
+
+	for _, tc := range restrictionCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := ContextWithRestriction(context.Background(), tc.restriction)
+
+			scope, err := entries.LibraryScope("", ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := scope.filter([]BookEntryId{0, 1, 2, 3})
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("scope.filter = %v, want %v", got, tc.want)
+			}
+
+			if count := entries.NumBooksIn(scope); count != len(tc.want) {
+				t.Errorf("NumBooksIn = %d, want %d", count, len(tc.want))
+			}
+		})
+	}
+}
+
+// TestRestrictionSurfaces checks that scopes made with a restriction hide
+// books from searches, lookups and counts. The pages and the API are
+// tested with a whole library in the main package.
+func TestRestrictionSurfaces(t *testing.T) {
+	entries := newRestrictionTestEntries()
+
+	// Only Men at Arms: no Tolkien, no Smith, no Fiction.
+	ctx := ContextWithRestriction(context.Background(), Restriction{
+		{Allow: true, Field: RuleTag, Value: "Humor"},
+	})
+
+	scope, err := entries.LibraryScope("", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	library, err := entries.LibraryScope("Discworld", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := library.filter([]BookEntryId{0, 1, 2, 3}); !slices.Equal(got, []BookEntryId{2}) {
+		t.Errorf("virtual library within restriction = %v, want [2]", got)
+	}
+
+	// Search restricts even a scope made without the context.
+	results, err := entries.Search(
+		"title:hobbit or tags:humor",
+		ctx,
+		SearchOptions{Syntax: SyntaxCalibre},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results.Books) != 1 || results.Books[0].ID != 3 {
+		t.Errorf("Search = %v, want Men at Arms only", results.Books)
+	}
+
+	if _, found := entries.Details(1, scope); found {
+		t.Error("Details found a restricted book")
+	}
+
+	if _, found := entries.Details(3, scope); !found {
+		t.Error("Details did not find an allowed book")
+	}
+
+	if found, _ := entries.FindByIdentifier("isbn", "9780261102217", scope); len(found) != 0 {
+		t.Errorf("FindByIdentifier found %v", found)
+	}
+
+	libraries := entries.VirtualLibraries(context.Background())
+	counted := entries.CountIn(libraries, scope)
+	if counted[0].Count != 1 || libraries[0].Count != 2 {
+		t.Errorf("CountIn = %v", counted)
+	}
+}
+
+func TestNewRule(t *testing.T) {
+	ruleCases := []struct {
+		field, value string
+		want         error
+	}{
+		{"tag", "Kids", nil},
+		{"library", "Kids", nil},
+		{"language", "en", nil},
+		{"language", "eng", nil},
+		{"language", "not a language", ErrInvalidRule},
+		{"tag", " ", ErrInvalidRule},
+		{"author", "Smith", ErrUnknownRuleField},
+	}
+
+	for _, tc := range ruleCases {
+		if _, err := NewRule(true, tc.field, tc.value); !errors.Is(err, tc.want) {
+			t.Errorf("NewRule(%q, %q) error = %v, want %v", tc.field, tc.value, err, tc.want)
+		}
+	}
+}
+
+func TestNamedSearchesFollowTheDay(t *testing.T) {
+	entries := newCalibreTestEntries()
+	entries.savedQueries = map[string]string{"Recent": "date:>10daysago"}
+	entries.searchKeys = newSortKeys(language.Und)
+
+	recent := func(now time.Time) []BookEntryId {
+		return entries.namedSearchesOn(now, context.Background()).
+			saved[0].books.ids()
+	}
+
+	if got := recent(calibreTestNow); !slices.Equal(got, []BookEntryId{1, 3}) {
+		t.Errorf("Recent today = %v, want [1 3]", got)
+	}
+
+	entries.tagTrees.Store("cached", []TagNode{})
+
+	later := calibreTestNow.AddDate(0, 0, 6)
+	if got := recent(later); !slices.Equal(got, []BookEntryId{3}) {
+		t.Errorf("Recent six days later = %v, want [3]", got)
+	}
+
+	if _, found := entries.tagTrees.Load("cached"); found {
+		t.Error("tag trees of the previous day are still cached")
+	}
+}
@@ -0,0 +1,493 @@
+package booksdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"unicode"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	cacheDirName      = "calibre-browser"
+	ftsTablePrefix    = "titles_"
+	ftsTableKeyLength = 16
+	// ftsMaxTerms bounds the phrases of one FTS5 query, keeping it under
+	// the depth FTS5 allows for expressions.
+	ftsMaxTerms = 100
+)
+
+var ErrUnknownSearchBackend = errors.New("unknown search backend")
+
+// Searcher ranks books by how many words of a query their titles share,
+// best matches first.
+type Searcher interface {
+	FindSimilar(words []Word, ctx context.Context) ([]BookEntryId, error)
+	Close() error
+}
+
+// SearchBackend selects the Searcher titles are indexed with.
+type SearchBackend byte
+
+const (
+	// SearchMemory keeps an inverted index of title words in memory.
+	SearchMemory SearchBackend = iota
+	// SearchFts indexes titles in an SQLite FTS5 table in a cache database,
+	// which keeps the heap small for large libraries.
+	SearchFts
+)
+
+func NewSearchBackend(name string) (SearchBackend, error) {
+	switch name {
+	case "", "memory":
+		return SearchMemory, nil
+	case "fts":
+		return SearchFts, nil
+	default:
+		return SearchMemory, fmt.Errorf("%w %q", ErrUnknownSearchBackend, name)
+	}
+}
+
+func (s SearchBackend) String() string {
+	if s == SearchFts {
+		return "fts"
+	}
+
+	return "memory"
+}
+
+// RepositoryOptions configure how a library is indexed.
+type RepositoryOptions struct {
+	SearchBackend SearchBackend
+	// CacheDir holds the databases the browser derives from the library.
+	// It defaults to calibre-browser in the user's cache directory.
+	CacheDir string
+	// Locale is the language names and titles are sorted in.
+	Locale language.Tag
+	// SynonymsPath is the JSON synonym dictionary queries are expanded
+	// with, if any.
+	SynonymsPath string
+	// IndexWorkers bounds how many book files are read at once when their
+	// text is indexed. It defaults to half the available CPUs.
+	IndexWorkers int
+}
+
+func (o RepositoryOptions) cacheDir() string {
+	if o.CacheDir != "" {
+		return o.CacheDir
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, cacheDirName)
+}
+
+// FindSimilar implements Searcher.
+func (index *BookSearchIndex) FindSimilar(
+	words []Word,
+	_ context.Context,
+) ([]BookEntryId, error) {
+	return index.findSimilar(words), nil
+}
+
+// Close implements Searcher; the index is left to the garbage collector.
+func (index *BookSearchIndex) Close() error {
+	return nil
+}
+
+// ftsSearcher ranks titles stored in an FTS5 table the way BookSearchIndex
+// does, by the share of words a title and the query have in common. The
+// unicode61 tokenizer drops punctuation and diacritics, so it also matches
+// "guards" in "Guards!", which the in-memory index does not.
+type ftsSearcher struct {
+	db    *sql.DB
+	table string
+	// snapshots counts the entries using the table, which is dropped once
+	// the last of them is garbage collected.
+	snapshots atomic.Int64
+}
+
+// openCache opens the database the FTS5 tables of a library are kept in.
+// It is private to the process, named after the library and the process
+// id, so instances serving the same library never drop each other's
+// tables. Caches left by processes that are gone are removed.
+func openCache(dbPath string, cacheDir string, ctx context.Context) (*sql.DB, error) {
+	path, err := filepath.Abs(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(path))
+	prefix := filepath.Join(cacheDir, "search-"+hex.EncodeToString(sum[:8]))
+	removeStaleCaches(prefix, ctx)
+
+	dsn := url.URL{
+		Scheme:   "file",
+		Path:     fmt.Sprintf("%s-%d.db", prefix, os.Getpid()),
+		RawQuery: "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)",
+	}
+
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("error opening cache %q: %w", dsn.Path, err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("error opening cache %q: %w", dsn.Path, err)
+	}
+
+	return db, nil
+}
+
+// removeStaleCaches removes the caches of a library whose processes are
+// gone, together with their journals, and the one of this process if an
+// earlier process with the same id left it behind.
+func removeStaleCaches(prefix string, ctx context.Context) {
+	paths, err := filepath.Glob(prefix + "-*.db*")
+	if err != nil {
+		return
+	}
+
+	for _, path := range paths {
+		name := strings.TrimPrefix(path, prefix+"-")
+		name, _, _ = strings.Cut(name, ".")
+
+		pid, err := strconv.Atoi(name)
+		if err != nil || (pid != os.Getpid() && processRunning(pid)) {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			Logger(ctx).Warn("cannot remove stale search cache", "error", err)
+		}
+	}
+}
+
+// processRunning reports whether a process exists, including ones of other
+// users, which cannot be signalled.
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	err = process.Signal(syscall.Signal(0))
+
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// ftsTable names the table of a list of titles after its content, so
+// refreshing a library whose titles did not change reuses its table.
+func ftsTable(titles []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(titles, "\n")))
+
+	return ftsTablePrefix + hex.EncodeToString(sum[:])[:ftsTableKeyLength]
+}
+
+func ftsTableExists(db *sql.DB, table string, ctx context.Context) (bool, error) {
+	var count int
+
+	err := db.QueryRowContext(
+		ctx,
+		"SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?",
+		table,
+	).Scan(&count)
+
+	return count > 0, err
+}
+
+func buildFtsTable(
+	db *sql.DB,
+	table string,
+	titles []string,
+	ctx context.Context,
+) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+		"CREATE VIRTUAL TABLE %s USING fts5("+
+			"title, words UNINDEXED, "+
+			"tokenize = 'unicode61 remove_diacritics 2')",
+		table,
+	)); err != nil {
+		return err
+	}
+
+	insert, err := tx.PrepareContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (rowid, title, words) VALUES (?, ?, ?)",
+		table,
+	))
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for id, title := range titles {
+		words := splitTitle(title)
+		normalized := make([]string, 0, len(words))
+
+		for _, word := range words {
+			for _, form := range wordForms(word) {
+				normalized = append(normalized, string(form))
+			}
+		}
+
+		if _, err := insert.ExecContext(
+			ctx,
+			id,
+			strings.Join(normalized, " "),
+			titleSize(words),
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// newFtsSearcher returns a searcher over titles, building its table unless
+// the cache already has one for the same titles.
+func newFtsSearcher(
+	db *sql.DB,
+	titles []string,
+	ctx context.Context,
+) (*ftsSearcher, error) {
+	table := ftsTable(titles)
+
+	exists, err := ftsTableExists(db, table, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error reading search cache: %w", err)
+	}
+
+	if !exists {
+		Logger(ctx).Info(
+			"indexing titles in search cache",
+			"titles", len(titles),
+			"table", table,
+		)
+
+		if err := buildFtsTable(db, table, titles, ctx); err != nil {
+			return nil, fmt.Errorf("error building search cache: %w", err)
+		}
+	}
+
+	return &ftsSearcher{db: db, table: table}, nil
+}
+
+// FindSimilar implements Searcher. Every distinct word is matched as a
+// phrase of its own and weighted by how often the query repeats it.
+func (s *ftsSearcher) FindSimilar(
+	words []Word,
+	ctx context.Context,
+) ([]BookEntryId, error) {
+	var forms []Word
+
+	seen := make(map[Word]bool, 2*len(words))
+
+	for _, word := range words {
+		for _, form := range wordForms(word) {
+			if !seen[form] {
+				seen[form] = true
+				forms = append(forms, form)
+			}
+		}
+	}
+
+	titles := make(map[BookEntryId]ftsTitle)
+
+	for chunk := range slices.Chunk(forms, ftsMaxTerms) {
+		if err := s.findTitles(chunk, titles, ctx); err != nil {
+			return nil, fmt.Errorf("error searching titles: %w", err)
+		}
+	}
+
+	scores := make([]SimilarityIndexScore, 0, len(titles))
+	querySize := Count(len(words))
+
+	for id, title := range titles {
+		if count := title.matches(words); count > 0 {
+			scores = append(scores, SimilarityIndexScore{
+				id:    id,
+				score: similarity(count, title.size, querySize),
+			})
+		}
+	}
+
+	return rankBySimilarity(scores), nil
+}
+
+// ftsTitle is a title FTS5 found, with how often each of its word forms
+// occurs in it.
+type ftsTitle struct {
+	forms map[Word]Count
+	size  Count
+}
+
+// matches counts the words of a query a title shares, as the in-memory
+// index does: each occurrence of a word as typed, or of its
+// transliteration when the title lacks it as typed.
+func (t ftsTitle) matches(words []Word) (count Count) {
+	for _, word := range words {
+		found := t.forms[word]
+		if found == 0 {
+			found = t.forms[transliterate(word)]
+		}
+
+		count += found
+	}
+
+	return count
+}
+
+// findTitles adds the titles with any of forms to titles. FTS5 finds every
+// title containing the tokens of a form; forms with no token, only
+// punctuation, are looked for word by word instead.
+func (s *ftsSearcher) findTitles(
+	forms []Word,
+	titles map[BookEntryId]ftsTitle,
+	ctx context.Context,
+) error {
+	var (
+		phrases    []string
+		conditions []string
+		args       []any
+	)
+
+	for _, form := range forms {
+		if strings.ContainsFunc(string(form), isTokenRune) {
+			phrases = append(phrases, ftsQuery([]string{string(form)}))
+		} else {
+			conditions = append(
+				conditions,
+				"instr(' ' || title || ' ', ' ' || ? || ' ') > 0",
+			)
+			args = append(args, string(form))
+		}
+	}
+
+	if len(phrases) > 0 {
+		conditions = append(conditions, fmt.Sprintf(
+			"rowid IN (SELECT rowid FROM %s WHERE %s MATCH ?)",
+			s.table,
+			s.table,
+		))
+		args = append(args, strings.Join(phrases, " OR "))
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT rowid, title, words FROM %s WHERE %s",
+		s.table,
+		strings.Join(conditions, " OR "),
+	), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id    BookEntryId
+			text  string
+			title ftsTitle
+		)
+
+		if err := rows.Scan(&id, &text, &title.size); err != nil {
+			return err
+		}
+
+		title.forms = make(map[Word]Count)
+		for _, form := range strings.Split(text, " ") {
+			title.forms[Word(form)]++
+		}
+
+		titles[id] = title
+	}
+
+	return rows.Err()
+}
+
+// isTokenRune reports whether the unicode61 tokenizer keeps r in tokens.
+func isTokenRune(r rune) bool {
+	return unicode.In(r, unicode.L, unicode.N, unicode.Co)
+}
+
+// Close implements Searcher by dropping the table.
+func (s *ftsSearcher) Close() error {
+	_, err := s.db.Exec("DROP TABLE IF EXISTS " + s.table)
+
+	return err
+}
+
+// usedBy ties the table to entries, so it is kept as long as requests
+// still search them, even after newer entries replaced them.
+func (s *ftsSearcher) usedBy(entries *BookEntries) {
+	s.snapshots.Add(1)
+	runtime.AddCleanup(entries, (*ftsSearcher).release, s)
+}
+
+func (s *ftsSearcher) release() {
+	if s.snapshots.Add(-1) > 0 {
+		return
+	}
+
+	if err := s.Close(); err != nil {
+		Logger(context.Background()).Warn(
+			"cannot drop search cache table",
+			"table", s.table,
+			"error", err,
+		)
+	}
+}
+
+// newSearcher indexes titles with the backend of the repository. A
+// searcher for the same titles is reused.
+func (r *BookRepository) newSearcher(
+	titles []string,
+	ctx context.Context,
+) (Searcher, error) {
+	if r.options.SearchBackend != SearchFts {
+		return NewTitleIndex(titles), nil
+	}
+
+	if current, ok := r.searcher.(*ftsSearcher); ok &&
+		current.table == ftsTable(titles) {
+		return current, nil
+	}
+
+	if r.cache == nil {
+		cache, err := openCache(r.dbPath, r.options.cacheDir(), ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		r.cache = cache
+	}
+
+	return newFtsSearcher(r.cache, titles, ctx)
+}
@@ -0,0 +1,234 @@
+package booksdb
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var searcherTestTitles = []string{
+	"The Hobbit",
+	"The Lord of the Rings",
+	"Guards! Guards!",
+	"Men at Arms",
+	"Zażółć gęślą jaźń",
+	"Мастер и Маргарита",
+	"Ὀδύσσεια",
+	"Go Master",
+}
+
+func newTestSearchers(t testing.TB, titles []string) map[string]Searcher {
+	t.Helper()
+
+	ctx := context.Background()
+
+	repo := &BookRepository{
+		dbPath:  "metadata.db",
+		options: RepositoryOptions{SearchBackend: SearchFts, CacheDir: t.TempDir()},
+	}
+
+	fts, err := repo.newSearcher(titles, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { repo.cache.Close() })
+
+	return map[string]Searcher{
+		SearchMemory.String(): NewTitleIndex(titles),
+		SearchFts.String():    fts,
+	}
+}
+
+func TestSearchers(t *testing.T) {
+	searchCases := []struct {
+		query []string
+		want  []BookEntryId
+	}{
+		{[]string{"hobbit"}, []BookEntryId{0}},
+		{[]string{"lord", "rings"}, []BookEntryId{1}},
+		{[]string{"men", "arms"}, []BookEntryId{3}},
+		{[]string{"ZAŻÓŁĆ"}, []BookEntryId{4}},
+		{[]string{"margarita"}, []BookEntryId{5}},
+		{[]string{"bulgakov", "master"}, []BookEntryId{7, 5}},
+		{[]string{"мастер"}, []BookEntryId{7, 5}},
+		{[]string{"odysseia"}, []BookEntryId{6}},
+		{[]string{"ΟΔΎΣΣΕΙΑ"}, []BookEntryId{6}},
+		{[]string{"dragon"}, nil},
+		{[]string{`"`}, nil},
+	}
+
+	for name, searcher := range newTestSearchers(t, searcherTestTitles) {
+		for _, tc := range searchCases {
+			found, err := searcher.FindSimilar(
+				normalizeWordSlice(tc.query),
+				context.Background(),
+			)
+			if err != nil {
+				t.Errorf("%s: FindSimilar(%q) error = %v", name, tc.query, err)
+
+				continue
+			}
+
+			if !slices.Equal(found, tc.want) {
+				t.Errorf("%s: FindSimilar(%q) = %v, want %v", name, tc.query, found, tc.want)
+			}
+		}
+	}
+}
+
+// assertSameRanking fails unless every searcher ranks query as the
+// in-memory index does.
+func assertSameRanking(
+	t testing.TB,
+	searchers map[string]Searcher,
+	query []Word,
+) {
+	t.Helper()
+
+	want, _ := searchers[SearchMemory.String()].FindSimilar(
+		query,
+		context.Background(),
+	)
+
+	for name, searcher := range searchers {
+		found, err := searcher.FindSimilar(query, context.Background())
+		if err != nil {
+			t.Fatalf("%s: FindSimilar(%q) error = %v", name, query, err)
+		}
+
+		if !slices.Equal(found, want) {
+			t.Fatalf(
+				"%s: FindSimilar(%q) = %v, the in-memory index finds %v",
+				name, query, found, want,
+			)
+		}
+	}
+}
+
+func TestSearchersRankAlike(t *testing.T) {
+	// Titles repeating words, punctuation and scripts transliterated.
+	titles := append(
+		generateTitles(2000, 12),
+		"Pride & Prejudice",
+		"Мастер и Маргарита master",
+		"Guards! Guards!",
+	)
+	searchers := newTestSearchers(t, titles)
+
+	for range 200 {
+		assertSameRanking(t, searchers, generateQueryWords(rand.Intn(6)+1))
+	}
+
+	for _, query := range [][]string{
+		{"&"},
+		{"guards", "guards!"},
+		{"мастер", "master", "маргарита"},
+		{"the", "the", "hobbit"},
+	} {
+		assertSameRanking(t, searchers, normalizeWordSlice(query))
+	}
+
+	// Long queries are split across several FTS5 queries.
+	assertSameRanking(t, searchers, slices.Concat(
+		normalizeWordSlice(testWords[:]),
+		normalizeWordSlice(testWords[:]),
+	))
+}
+
+func TestFtsSearcherCache(t *testing.T) {
+	ctx := context.Background()
+	repo := &BookRepository{
+		dbPath:  "metadata.db",
+		options: RepositoryOptions{SearchBackend: SearchFts, CacheDir: t.TempDir()},
+	}
+
+	first, err := repo.newSearcher(searcherTestTitles, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer repo.cache.Close()
+
+	repo.searcher = first
+
+	if same, _ := repo.newSearcher(searcherTestTitles, ctx); same != first {
+		t.Error("unchanged titles were indexed again")
+	}
+
+	second, err := repo.newSearcher(searcherTestTitles[:2], ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries made with first are still searched after second replaced it.
+	fts := first.(*ftsSearcher)
+	fts.snapshots.Add(2)
+	fts.release()
+
+	if exists, _ := ftsTableExists(repo.cache, fts.table, ctx); !exists {
+		t.Error("table dropped while entries still use it")
+	}
+
+	fts.release()
+
+	if exists, _ := ftsTableExists(repo.cache, fts.table, ctx); exists {
+		t.Error("table left behind once no entries use it")
+	}
+
+	if found, err := second.FindSimilar([]Word{"hobbit"}, ctx); err != nil ||
+		!slices.Equal(found, []BookEntryId{0}) {
+		t.Errorf("FindSimilar after refresh = %v, %v, want [0]", found, err)
+	}
+}
+
+func TestOpenCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cache, err := openCache("metadata.db", dir, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer cache.Close()
+
+	live, err := filepath.Glob(filepath.Join(dir, "search-*.db"))
+	if err != nil || len(live) != 1 {
+		t.Fatalf("caches = %v, %v, want one", live, err)
+	}
+
+	// A cache of another instance, alive, and one of an instance that is
+	// gone, with ids no process can have.
+	prefix := strings.TrimSuffix(live[0], fmt.Sprintf("-%d.db", os.Getpid()))
+	others := map[string]bool{
+		fmt.Sprintf("%s-%d.db", prefix, os.Getppid()):            true,
+		fmt.Sprintf("%s-%d.db", prefix, 1<<30):                   false,
+		fmt.Sprintf("%s-%d.db-wal", prefix, 1<<30):               false,
+		filepath.Join(dir, fmt.Sprintf("search-0-%d.db", 1<<30)): true,
+	}
+
+	for path := range others {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	second, err := openCache("metadata.db", dir, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second.Close()
+
+	for path, kept := range others {
+		if _, err := os.Stat(path); (err == nil) != kept {
+			t.Errorf("%s: kept = %v, want %v", filepath.Base(path), err == nil, kept)
+		}
+	}
+}
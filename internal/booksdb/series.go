@@ -0,0 +1,258 @@
+package booksdb
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/grzadr/calibre-browser/internal/model"
+)
+
+// SeriesIndex is the position of a book within its series. Calibre allows
+// fractions, e.g. 1.5 for a novella set between the first two volumes.
+type SeriesIndex float64
+
+func (index SeriesIndex) String() string {
+	return strconv.FormatFloat(float64(index), 'f', -1, 64)
+}
+
+func (index SeriesIndex) isWhole() bool {
+	return index == SeriesIndex(math.Trunc(float64(index)))
+}
+
+// SeriesGap is a run of missing whole volumes, From and To inclusive.
+type SeriesGap struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+func (gap SeriesGap) String() string {
+	if gap.From == gap.To {
+		return strconv.Itoa(gap.From)
+	}
+
+	return fmt.Sprintf("%d–%d", gap.From, gap.To)
+}
+
+type series struct {
+	id      int64
+	name    string
+	sort    string
+	sortKey []byte
+	volumes []BookEntryId
+}
+
+type BookSeries struct {
+	Id    int64       `json:"id"`
+	Name  string      `json:"name"`
+	Index SeriesIndex `json:"index"`
+}
+
+type SeriesSummary struct {
+	Id    int64  `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type SeriesVolume struct {
+	Index SeriesIndex        `json:"index"`
+	Book  model.BookEntryRow `json:"book"`
+	// MissingBefore is set on the volume that follows a gap in the run.
+	MissingBefore *SeriesGap `json:"missing_before,omitempty"`
+}
+
+type SeriesDetails struct {
+	SeriesSummary
+
+	Volumes []SeriesVolume `json:"volumes"`
+	Gaps    []SeriesGap    `json:"gaps"`
+}
+
+func (b *BookEntries) loadSeries(
+	repo *BookRepository,
+	ctx context.Context,
+) error {
+	rows, err := repo.AllSeries(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing series: %w", err)
+	}
+
+	links, err := repo.BookSeries(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing series links: %w", err)
+	}
+
+	b.series = make([]series, len(rows))
+	keys := newSortKeys(repo.options.Locale)
+
+	for i, row := range rows {
+		sort := row.Name
+		if row.Sort.Valid && row.Sort.String != "" {
+			sort = row.Sort.String
+		}
+
+		b.series[i] = series{
+			id:      row.ID,
+			name:    row.Name,
+			sort:    sort,
+			sortKey: keys.key(sort),
+		}
+	}
+
+	slices.SortFunc(b.series, func(left, right series) int {
+		return compareKeys(left.sortKey, right.sortKey, left.sort, right.sort)
+	})
+
+	b.seriesIds = make(map[int64]int, len(b.series))
+
+	for position, s := range b.series {
+		b.seriesIds[s.id] = position
+	}
+
+	b.bookSeries = make([]int, len(b.books))
+	b.seriesIndexes = make([]SeriesIndex, len(b.books))
+
+	for i := range b.bookSeries {
+		b.bookSeries[i] = -1
+	}
+
+	for _, link := range links {
+		entryId, found := b.bookIds[uint16(link.Book)]
+		if !found {
+			continue
+		}
+
+		position, found := b.seriesIds[link.Series]
+		if !found {
+			continue
+		}
+
+		b.bookSeries[entryId] = position
+		b.seriesIndexes[entryId] = SeriesIndex(link.SeriesIndex)
+		b.series[position].volumes = append(
+			b.series[position].volumes,
+			entryId,
+		)
+	}
+
+	for _, s := range b.series {
+		slices.SortFunc(s.volumes, func(left, right BookEntryId) int {
+			return cmp.Or(
+				cmp.Compare(b.seriesIndexes[left], b.seriesIndexes[right]),
+				b.compareTitles(left, right),
+			)
+		})
+	}
+
+	return nil
+}
+
+// maxSeriesVolume bounds the whole volumes gaps are looked for between, as
+// Calibre accepts any number as a series index.
+const maxSeriesVolume = math.MaxInt32
+
+// findSeriesGaps returns the whole volumes missing from a run starting at
+// volume 1 (or lower, for prequels numbered 0) up to the last whole volume.
+// Gaps are the spans between volumes present, so a stray index such as
+// 1000000 costs no more than any other.
+func findSeriesGaps(indexes []SeriesIndex) (gaps []SeriesGap) {
+	var volumes []int
+
+	for _, index := range indexes {
+		if index.isWhole() && math.Abs(float64(index)) <= maxSeriesVolume {
+			volumes = append(volumes, int(index))
+		}
+	}
+
+	if len(volumes) == 0 {
+		return nil
+	}
+
+	slices.Sort(volumes)
+
+	next := min(1, volumes[0])
+
+	for _, volume := range slices.Compact(volumes) {
+		if volume > next {
+			gaps = append(gaps, SeriesGap{From: next, To: volume - 1})
+		}
+
+		next = volume + 1
+	}
+
+	return gaps
+}
+
+func (s series) summary(volumes []BookEntryId) SeriesSummary {
+	return SeriesSummary{Id: s.id, Name: s.name, Count: len(volumes)}
+}
+
+// SeriesList returns all series that have books in scope, in sort order.
+func (b *BookEntries) SeriesList(scope Scope) []SeriesSummary {
+	summaries := make([]SeriesSummary, 0, len(b.series))
+
+	for _, s := range b.series {
+		if volumes := scope.filter(s.volumes); len(volumes) > 0 {
+			summaries = append(summaries, s.summary(volumes))
+		}
+	}
+
+	return summaries
+}
+
+// SeriesDetails lists the volumes of a series by their series index and
+// flags missing whole volumes. Volumes outside scope count as missing.
+func (b *BookEntries) SeriesDetails(
+	seriesId int64,
+	scope Scope,
+) (details SeriesDetails, found bool) {
+	position, found := b.seriesIds[seriesId]
+	if !found {
+		return details, false
+	}
+
+	s := b.series[position]
+	volumes := scope.filter(s.volumes)
+
+	if len(volumes) == 0 && len(s.volumes) > 0 {
+		return details, false
+	}
+
+	details.SeriesSummary = s.summary(volumes)
+	details.Volumes = make([]SeriesVolume, len(volumes))
+	indexes := make([]SeriesIndex, len(volumes))
+
+	for i, entryId := range volumes {
+		indexes[i] = b.seriesIndexes[entryId]
+		details.Volumes[i] = SeriesVolume{
+			Index: indexes[i],
+			Book:  b.books[entryId],
+		}
+	}
+
+	details.Gaps = findSeriesGaps(indexes)
+
+	for i := range details.Gaps {
+		gap := &details.Gaps[i]
+		next, _ := slices.BinarySearch(indexes, SeriesIndex(gap.To+1))
+		details.Volumes[next].MissingBefore = gap
+	}
+
+	return details, true
+}
+
+func (b *BookEntries) bookSeriesOf(entryId BookEntryId) *BookSeries {
+	position := b.bookSeries[entryId]
+	if position < 0 {
+		return nil
+	}
+
+	return &BookSeries{
+		Id:    b.series[position].id,
+		Name:  b.series[position].name,
+		Index: b.seriesIndexes[entryId],
+	}
+}
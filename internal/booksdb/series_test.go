@@ -0,0 +1,48 @@
+package booksdb
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestFindSeriesGaps(t *testing.T) {
+	gapCases := []struct {
+		name    string
+		indexes []SeriesIndex
+		want    []SeriesGap
+	}{
+		{"complete", []SeriesIndex{1, 2, 3}, nil},
+		{"single gap", []SeriesIndex{1, 2, 4}, []SeriesGap{{3, 3}}},
+		{"novella", []SeriesIndex{1, 1.5, 2}, nil},
+		{"novella in gap", []SeriesIndex{1, 2.5, 4}, []SeriesGap{{2, 3}}},
+		{"late start", []SeriesIndex{3, 4}, []SeriesGap{{1, 2}}},
+		{"prequel", []SeriesIndex{0, 2}, []SeriesGap{{1, 1}}},
+		{"several", []SeriesIndex{2, 5, 6, 9}, []SeriesGap{
+			{1, 1}, {3, 4}, {7, 8},
+		}},
+		{"duplicates", []SeriesIndex{1, 1, 3, 3}, []SeriesGap{{2, 2}}},
+		{"fractions only", []SeriesIndex{0.5, 1.5}, nil},
+		{"huge index", []SeriesIndex{1, 1e9}, []SeriesGap{{2, 999999999}}},
+		{"beyond bound", []SeriesIndex{1, 1e12}, nil},
+		{"beyond int", []SeriesIndex{1, 3, 1e300, SeriesIndex(math.Inf(1))}, []SeriesGap{{2, 2}}},
+	}
+
+	for _, tc := range gapCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := findSeriesGaps(tc.indexes); !slices.Equal(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSeriesIndexString(t *testing.T) {
+	for index, want := range map[SeriesIndex]string{
+		1: "1", 1.5: "1.5", 12: "12", 0.25: "0.25",
+	} {
+		if got := index.String(); got != want {
+			t.Errorf("SeriesIndex(%v).String() = %q, want %q", float64(index), got, want)
+		}
+	}
+}
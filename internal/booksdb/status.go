@@ -0,0 +1,78 @@
+package booksdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrNotLoaded = errors.New("library is not loaded yet")
+
+// IndexStatus describes the entries in use and how the latest refresh of
+// the library went.
+type IndexStatus struct {
+	// Generation counts the entries swapped in since startup.
+	Generation uint64
+	Books      int
+	// Words is the number of distinct words in titles and descriptions.
+	Words       int
+	RefreshedAt time.Time
+	// LastError is the error of the latest refresh, nil when it succeeded.
+	LastError   error
+	LastErrorAt time.Time
+}
+
+var (
+	statusMu sync.Mutex
+	status   IndexStatus
+)
+
+// GetIndexStatus returns the status of the entries in use.
+func GetIndexStatus() IndexStatus {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	return status
+}
+
+// recordRefresh updates the status after a refresh of the library, keeping
+// the counts of the entries still in use when it failed.
+func recordRefresh(entries *BookEntries, err error) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	now := time.Now()
+
+	if err != nil {
+		status.LastError, status.LastErrorAt = err, now
+
+		return
+	}
+
+	status.Generation++
+	status.Books = entries.NumBooks()
+	status.Words = len(entries.vocabulary.words)
+	status.RefreshedAt = now
+	status.LastError = nil
+}
+
+// Ping checks that the library is loaded and its database can still be
+// read.
+func Ping(ctx context.Context) error {
+	// The entries are stored after the repository is set.
+	if GetBooksEntries() == nil {
+		return ErrNotLoaded
+	}
+
+	var tables int
+	if err := repository.db.QueryRowContext(
+		ctx,
+		"SELECT count(*) FROM sqlite_master",
+	).Scan(&tables); err != nil {
+		return fmt.Errorf("error reading db %q: %w", repository.dbPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package booksdb
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// suggestFrequencyWeight is how much of an edit the frequency of a word
+	// may make up for: the most frequent word of the library at distance 2
+	// ranks as if it were at distance 1.5.
+	suggestFrequencyWeight = 0.5
+	// suggestMinLength is the shortest word corrected; shorter words are
+	// too ambiguous to guess.
+	suggestMinLength = 3
+)
+
+// vocabulary counts in how many books each word of the titles and
+// descriptions appears, to suggest spellings of words that match nothing.
+// Spellings are grouped by their number of letters, since words whose
+// lengths differ by more than the edits allowed are never suggested.
+type vocabulary struct {
+	words   map[Word]int
+	lengths [][]spelling
+	maxFreq int
+}
+
+// spelling is a word of the vocabulary with the letters and digits its
+// distance to misspelled words is measured on, so "guards" is one edit
+// from "gards" even when the title index holds "guards!".
+type spelling struct {
+	word    Word
+	letters []rune
+	freq    int
+}
+
+// newVocabulary splits titles the way the title index does, so suggested
+// words match the titles they come from, and descriptions into words.
+func newVocabulary(titles []string, descriptions []string) vocabulary {
+	vocab := vocabulary{words: make(map[Word]int)}
+
+	for _, title := range titles {
+		vocab.add(splitTitle(title))
+	}
+
+	for _, description := range descriptions {
+		vocab.add(splitText(description))
+	}
+
+	for word, freq := range vocab.words {
+		letters := []rune(strings.Map(wordRune, string(word)))
+		for len(vocab.lengths) <= len(letters) {
+			vocab.lengths = append(vocab.lengths, nil)
+		}
+
+		vocab.maxFreq = max(vocab.maxFreq, freq)
+		vocab.lengths[len(letters)] = append(
+			vocab.lengths[len(letters)],
+			spelling{word: word, letters: letters, freq: freq},
+		)
+	}
+
+	return vocab
+}
+
+// wordRune drops the runes that are neither letters nor digits.
+func wordRune(r rune) rune {
+	if isWordRune(r) {
+		return r
+	}
+
+	return -1
+}
+
+// add counts the words of one book.
+func (v *vocabulary) add(words []Word) {
+	seen := make(map[Word]bool, len(words))
+
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			v.words[word]++
+		}
+	}
+}
+
+// maxEdits allows one typo in short words and two in longer ones.
+func maxEdits(length int) int {
+	if length <= 4 {
+		return 1
+	}
+
+	return 2
+}
+
+// editDistance is the optimal string alignment distance of two words: the
+// number of insertions, deletions, substitutions and transpositions of
+// adjacent letters turning one into the other. It gives up, returning
+// limit+1, as soon as the distance exceeds limit.
+func editDistance(left, right []rune, limit int) int {
+	var rows editRows
+
+	return rows.distance(left, right, limit)
+}
+
+// editRows are the rows of the distance table, kept between words so
+// measuring a word against the whole vocabulary allocates them once.
+type editRows [3][]int
+
+// distance is editDistance, computed in the rows.
+func (rows *editRows) distance(left, right []rune, limit int) int {
+	if abs(len(left)-len(right)) > limit {
+		return limit + 1
+	}
+
+	for k := range rows {
+		rows[k] = slices.Grow(rows[k][:0], len(right)+1)[:len(right)+1]
+	}
+
+	previous2, previous, current := rows[0], rows[1], rows[2]
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(left); i++ {
+		current[0] = i
+		best := current[0]
+
+		for j := 1; j <= len(right); j++ {
+			cost := 1
+			if left[i-1] == right[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(
+				previous[j]+1,
+				current[j-1]+1,
+				previous[j-1]+cost,
+			)
+
+			if i > 1 && j > 1 && left[i-1] == right[j-2] &&
+				left[i-2] == right[j-1] {
+				current[j] = min(current[j], previous2[j-2]+1)
+			}
+
+			best = min(best, current[j])
+		}
+
+		if best > limit {
+			return limit + 1
+		}
+
+		previous2, previous, current = previous, current, previous2
+	}
+
+	return previous[len(right)]
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+
+	return value
+}
+
+// correct returns the most likely spelling of a word missing from the
+// vocabulary: the closest one, with frequent words preferred among words at
+// a similar distance.
+func (v vocabulary) correct(word Word) (Word, bool) {
+	if _, known := v.words[word]; known ||
+		utf8.RuneCountInString(string(word)) < suggestMinLength {
+		return word, false
+	}
+
+	runes := []rune(string(word))
+	limit := maxEdits(len(runes))
+
+	var (
+		best      Word
+		bestScore = math.Inf(1)
+		rows      editRows
+	)
+
+	shortest := max(0, len(runes)-limit)
+	longest := min(len(v.lengths)-1, len(runes)+limit)
+
+	for length := shortest; length <= longest; length++ {
+		for _, candidate := range v.lengths[length] {
+			distance := rows.distance(runes, candidate.letters, limit)
+			if distance > limit {
+				continue
+			}
+
+			score := float64(distance) - suggestFrequencyWeight*
+				math.Log1p(float64(candidate.freq))/
+				math.Log1p(float64(v.maxFreq))
+
+			if score < bestScore ||
+				score == bestScore && candidate.word < best {
+				best, bestScore = candidate.word, score
+			}
+		}
+	}
+
+	return best, best != ""
+}
+
+// suggest corrects the misspelled free words of a simple query, keeping
+// field filters as they are. Corrected words are lowered and stripped of
+// diacritics, like the words they are compared to.
+func (v vocabulary) suggest(query string) (string, bool) {
+	tokens := strings.Fields(query)
+	corrected := false
+
+	for i, token := range tokens {
+		if name, _, found := strings.Cut(token, ":"); found &&
+			(queryFields[strings.ToLower(name)] != nil ||
+				strings.HasPrefix(name, customColumnPrefix)) {
+			continue
+		}
+
+		if correction, found := v.correct(normalizeWord(token)); found {
+			tokens[i] = string(correction)
+			corrected = true
+		}
+	}
+
+	return strings.Join(tokens, " "), corrected
+}
+
+// suggest returns a spelling of a query that finds books, if there is one.
+// Only simple queries are corrected, and the spelling is only looked up,
+// without quoting or listing the books it finds.
+func (b *BookEntries) suggest(
+	query string,
+	now time.Time,
+	ctx context.Context,
+	options SearchOptions,
+) string {
+	if options.Syntax != SyntaxSimple {
+		return ""
+	}
+
+	suggestion, corrected := b.vocabulary.suggest(query)
+	if !corrected {
+		return ""
+	}
+
+	options.Content = false
+
+	_, ids, err := b.find(suggestion, now, ctx, options)
+	if err != nil || len(ids) == 0 {
+		return ""
+	}
+
+	return suggestion
+}
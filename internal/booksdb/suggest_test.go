@@ -0,0 +1,82 @@
+package booksdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	distanceCases := []struct {
+		left, right string
+		want        int
+	}{
+		{"hobbit", "hobbit", 0},
+		{"hobit", "hobbit", 1},
+		{"hbobit", "hobbit", 1},
+		{"hobbti", "hobbit", 1},
+		{"dargon", "dragon", 1},
+		{"gards", "guards", 1},
+		{"kitten", "sitting", 3},
+		{"ab", "ba", 1},
+		{"żółw", "zolw", 3},
+	}
+
+	// Rows kept from longer words must not leak into shorter ones.
+	var rows editRows
+
+	for _, tc := range distanceCases {
+		want := min(tc.want, 3)
+
+		if got := editDistance([]rune(tc.left), []rune(tc.right), 2); got != want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tc.left, tc.right, got, want)
+		}
+
+		if got := rows.distance([]rune(tc.left), []rune(tc.right), 2); got != want {
+			t.Errorf("rows.distance(%q, %q) = %d, want %d", tc.left, tc.right, got, want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	entries := newCalibreTestEntries()
+	titles := make([]string, entries.NumBooks())
+
+	for id, book := range entries.books {
+		titles[id] = book.Title
+	}
+
+	entries.titles = NewTitleIndex(titles)
+	entries.vocabulary = newVocabulary(titles, entries.descriptions)
+
+	suggestCases := []struct {
+		query string
+		want  string
+	}{
+		{"hobit", "hobbit"},
+		{"gards", "guards!"},
+		{"the hobit", ""},
+		{"dargon", "dragon"},
+		{"description:dragon gards", "description:dragon guards!"},
+		{"description:london gards", ""},
+		{"xyzzy", ""},
+		{"zz", ""},
+	}
+
+	for _, tc := range suggestCases {
+		results, err := entries.Search(tc.query, context.Background(), SearchOptions{})
+		if err != nil {
+			t.Errorf("Search(%q) error = %v", tc.query, err)
+
+			continue
+		}
+
+		if results.Suggestion != tc.want {
+			t.Errorf("Search(%q) suggested %q, want %q", tc.query, results.Suggestion, tc.want)
+		}
+	}
+
+	results, _ := entries.Search("hobit", context.Background(), SearchOptions{Syntax: SyntaxCalibre})
+	if results.Suggestion != "" {
+		t.Errorf("Calibre syntax search suggested %q", results.Suggestion)
+	}
+}
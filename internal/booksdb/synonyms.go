@@ -0,0 +1,182 @@
+package booksdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// synonymsCheckInterval is how often the synonym file is checked for
+// changes; searches in between use the dictionary as loaded.
+const synonymsCheckInterval = time.Second
+
+// synonymDictionary expands query words into alternatives read from a
+// user-editable JSON file mapping a word to what it stands for, e.g.
+//
+//	{
+//	  "lotr": ["fellowship of the ring", "two towers", "return of the king"],
+//	  "sapkowski": ["author:Sapkowski"],
+//	  "sf": ["tag:Fiction.Science Fiction.*"]
+//	}
+//
+// An alternative is either a field filter of the simple syntax, with the
+// rest of the string as its value, or words all of which a title must
+// contain. The file is read again when it changes, without a restart.
+type synonymDictionary struct {
+	path string
+
+	mu        sync.Mutex
+	checked   time.Time
+	modTime   time.Time
+	size      int64
+	expansion map[Word][]string
+}
+
+func newSynonymDictionary(path string) *synonymDictionary {
+	dictionary := &synonymDictionary{path: path}
+	dictionary.refresh(time.Now())
+
+	return dictionary
+}
+
+func readSynonyms(path string) (map[Word][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string][]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error decoding %q: %w", path, err)
+	}
+
+	expansion := make(map[Word][]string, len(raw))
+
+	for word, alternatives := range raw {
+		key := normalizeWord(strings.TrimSpace(word))
+		expansion[key] = append(expansion[key], alternatives...)
+	}
+
+	return expansion, nil
+}
+
+// refresh reloads the file if it changed since it was last read. A file
+// that cannot be read or decoded leaves the dictionary as it was.
+func (d *synonymDictionary) refresh(now time.Time) {
+	d.checked = now
+
+	info, err := os.Stat(d.path)
+	if err != nil {
+		if d.expansion != nil {
+			slog.Warn(
+				"keeping synonyms, cannot read them",
+				"path", d.path,
+				"error", err,
+			)
+		}
+
+		return
+	}
+
+	if info.ModTime().Equal(d.modTime) && info.Size() == d.size {
+		return
+	}
+
+	expansion, err := readSynonyms(d.path)
+	if err != nil {
+		slog.Warn(
+			"keeping synonyms, cannot load them",
+			"path", d.path,
+			"error", err,
+		)
+
+		return
+	}
+
+	d.modTime, d.size, d.expansion = info.ModTime(), info.Size(), expansion
+
+	slog.Info("loaded synonyms", "synonyms", len(expansion), "path", d.path)
+}
+
+// alternatives returns the alternatives of every word that has some.
+func (d *synonymDictionary) alternatives(words []Word) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now := time.Now(); now.Sub(d.checked) >= synonymsCheckInterval {
+		d.refresh(now)
+	}
+
+	var alternatives []string
+
+	for _, word := range words {
+		alternatives = append(alternatives, d.expansion[word]...)
+	}
+
+	return alternatives
+}
+
+// titleFilter selects books whose title contains every word, regardless of
+// punctuation.
+type titleFilter struct {
+	words []Word
+}
+
+func (f titleFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	if len(f.words) == 0 {
+		return set
+	}
+
+	for id, book := range entries.books {
+		words := splitText(book.Title)
+
+		if !slices.ContainsFunc(f.words, func(word Word) bool {
+			return !slices.Contains(words, word)
+		}) {
+			set.add(BookEntryId(id))
+		}
+	}
+
+	return set
+}
+
+// parseAlternative turns an alternative of the dictionary into a filter.
+func parseAlternative(alternative string, now time.Time) (queryFilter, error) {
+	name, value, found := strings.Cut(strings.TrimSpace(alternative), ":")
+	if parse, known := queryFields[strings.ToLower(name)]; found && known {
+		return parse(strings.TrimSpace(value), now)
+	}
+
+	return titleFilter{words: splitText(alternative)}, nil
+}
+
+// expand returns filters selecting what the free words of a query stand
+// for. Alternatives that cannot be parsed are logged and skipped.
+func (b *BookEntries) expand(words []Word, now time.Time) []queryFilter {
+	if b.synonyms == nil || len(words) == 0 {
+		return nil
+	}
+
+	var filters []queryFilter
+
+	for _, alternative := range b.synonyms.alternatives(words) {
+		filter, err := parseAlternative(alternative, now)
+		if err != nil {
+			slog.Warn("skipping synonym", "synonym", alternative, "error", err)
+
+			continue
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters
+}
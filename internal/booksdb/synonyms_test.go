@@ -0,0 +1,105 @@
+package booksdb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func writeSynonyms(t *testing.T, path string, content string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func resultIds(books BookEntrySlice) (ids []uint16) {
+	for _, book := range books {
+		ids = append(ids, book.ID)
+	}
+
+	return ids
+}
+
+func TestSynonyms(t *testing.T) {
+	entries := newCalibreTestEntries()
+	titles := make([]string, entries.NumBooks())
+
+	for id, book := range entries.books {
+		titles[id] = book.Title
+	}
+
+	entries.titles = NewTitleIndex(titles)
+
+	path := filepath.Join(t.TempDir(), "synonyms.json")
+	modTime := time.Now().Add(-time.Hour)
+
+	writeSynonyms(t, path, `{
+		"Watch": ["guards guards", "men at arms"],
+		"wyrm": ["description:dragon"],
+		"teeth": ["hobbit"],
+		"broken": ["date:never"]
+	}`, modTime)
+
+	entries.synonyms = newSynonymDictionary(path)
+
+	searchCases := []struct {
+		query string
+		want  []uint16
+	}{
+		{"watch", []uint16{2, 3}},
+		{"wyrm", []uint16{1, 2}},
+		{"wyrm description:secret", []uint16{2}},
+		// Books matched by their title come before expanded ones.
+		{"teeth", []uint16{4, 1}},
+		{"broken", nil},
+		{"unknown", nil},
+	}
+
+	for _, tc := range searchCases {
+		results, err := entries.Search(tc.query, context.Background(), SearchOptions{})
+		if err != nil {
+			t.Errorf("Search(%q) error = %v", tc.query, err)
+
+			continue
+		}
+
+		if got := resultIds(results.Books); !slices.Equal(got, tc.want) {
+			t.Errorf("Search(%q) = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	writeSynonyms(t, path, `{"watch": ["white teeth"]}`, modTime.Add(time.Minute))
+
+	entries.synonyms.checked = time.Time{}
+
+	results, err := entries.Search("watch", context.Background(), SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := resultIds(results.Books); !slices.Equal(got, []uint16{4}) {
+		t.Errorf("Search(%q) after reload = %v, want [4]", "watch", got)
+	}
+
+	writeSynonyms(t, path, `{"watch": [`, modTime.Add(2*time.Minute))
+
+	entries.synonyms.checked = time.Time{}
+
+	results, err = entries.Search("watch", context.Background(), SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := resultIds(results.Books); !slices.Equal(got, []uint16{4}) {
+		t.Errorf("Search(%q) after invalid file = %v, want [4]", "watch", got)
+	}
+}
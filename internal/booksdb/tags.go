@@ -0,0 +1,352 @@
+package booksdb
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	tagSeparator      = "."
+	descendantsSuffix = ".*"
+	maxTagCloudWeight = 5
+	minTagCloudWeight = 1
+)
+
+type tag struct {
+	id   int64
+	name string
+	key  string
+	// sortKeys collate the levels of the name, so children sort under
+	// their parent whatever the separator collates as.
+	sortKeys [][]byte
+	books    []BookEntryId
+}
+
+type BookTag struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// TagNode is one level of a dotted tag hierarchy. Id is zero for levels
+// that only exist as a prefix of other tags ("Fiction" of "Fiction.Fantasy"
+// when no book is tagged plain "Fiction").
+type TagNode struct {
+	Id       int64     `json:"id,omitempty"`
+	Name     string    `json:"name"`
+	FullName string    `json:"full_name"`
+	Count    int       `json:"count"`
+	Total    int       `json:"total"`
+	Children []TagNode `json:"children,omitempty"`
+}
+
+type TagCloudEntry struct {
+	Id     int64  `json:"id"`
+	Name   string `json:"name"`
+	Count  int    `json:"count"`
+	Weight int    `json:"weight"`
+}
+
+type TagDetails struct {
+	Id                  int64          `json:"id"`
+	Name                string         `json:"name"`
+	IncludesDescendants bool           `json:"includes_descendants"`
+	Books               BookEntrySlice `json:"books"`
+}
+
+func tagKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func (b *BookEntries) loadTags(
+	repo *BookRepository,
+	ctx context.Context,
+) error {
+	rows, err := repo.AllTags(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing tags: %w", err)
+	}
+
+	links, err := repo.BookTags(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing tag links: %w", err)
+	}
+
+	b.tags = make([]tag, len(rows))
+	keys := newSortKeys(repo.options.Locale)
+
+	for i, row := range rows {
+		segments := strings.Split(row.Name, tagSeparator)
+		sortKeys := make([][]byte, len(segments))
+
+		for level, segment := range segments {
+			sortKeys[level] = keys.key(segment)
+		}
+
+		b.tags[i] = tag{
+			id:       row.ID,
+			name:     row.Name,
+			key:      tagKey(row.Name),
+			sortKeys: sortKeys,
+		}
+	}
+
+	// Sorting by key keeps the descendants of a tag next to each other, so
+	// they are found by binary search. Lists follow tagOrder instead.
+	slices.SortFunc(b.tags, func(left, right tag) int {
+		return strings.Compare(left.key, right.key)
+	})
+
+	b.tagOrder = make([]int, len(b.tags))
+
+	for position := range b.tagOrder {
+		b.tagOrder[position] = position
+	}
+
+	slices.SortFunc(b.tagOrder, func(left, right int) int {
+		return cmp.Or(
+			slices.CompareFunc(
+				b.tags[left].sortKeys,
+				b.tags[right].sortKeys,
+				bytes.Compare,
+			),
+			strings.Compare(b.tags[left].key, b.tags[right].key),
+		)
+	})
+
+	b.tagIds = make(map[int64]int, len(b.tags))
+
+	for position, t := range b.tags {
+		b.tagIds[t.id] = position
+	}
+
+	b.bookTags = make([][]int, len(b.books))
+
+	for _, link := range links {
+		entryId, found := b.bookIds[uint16(link.Book)]
+		if !found {
+			continue
+		}
+
+		position, found := b.tagIds[link.Tag]
+		if !found {
+			continue
+		}
+
+		b.bookTags[entryId] = append(b.bookTags[entryId], position)
+		b.tags[position].books = append(b.tags[position].books, entryId)
+	}
+
+	for _, positions := range b.bookTags {
+		slices.Sort(positions)
+	}
+
+	return nil
+}
+
+func (b *BookEntries) searchTag(key string) (int, bool) {
+	return slices.BinarySearchFunc(
+		b.tags,
+		key,
+		func(t tag, target string) int { return strings.Compare(t.key, target) },
+	)
+}
+
+// tagBooks returns the books tagged key and, if requested, with any of its
+// descendants. Descendants share the "key." prefix, so they sit next to
+// each other in the sorted tags.
+func (b *BookEntries) tagBooks(key string, descendants bool) []BookEntryId {
+	var ids []BookEntryId
+
+	if position, found := b.searchTag(key); found {
+		ids = append(ids, b.tags[position].books...)
+	}
+
+	if descendants {
+		prefix := key + tagSeparator
+		position, _ := b.searchTag(prefix)
+
+		for ; position < len(b.tags); position++ {
+			if !strings.HasPrefix(b.tags[position].key, prefix) {
+				break
+			}
+
+			ids = append(ids, b.tags[position].books...)
+		}
+	}
+
+	slices.Sort(ids)
+
+	return slices.Compact(ids)
+}
+
+func (b *BookEntries) buildTagTree(scope Scope) []TagNode {
+	root := TagNode{}
+
+	for _, position := range b.tagOrder {
+		t := b.tags[position]
+
+		books := scope.filter(t.books)
+		if len(books) == 0 {
+			continue
+		}
+
+		node := &root
+		segments := strings.Split(t.name, tagSeparator)
+
+		for depth, segment := range segments {
+			fullName := strings.Join(segments[:depth+1], tagSeparator)
+			index := slices.IndexFunc(node.Children, func(child TagNode) bool {
+				return tagKey(child.FullName) == tagKey(fullName)
+			})
+
+			if index < 0 {
+				node.Children = append(node.Children, TagNode{
+					Name:     segment,
+					FullName: fullName,
+				})
+				index = len(node.Children) - 1
+			}
+
+			node = &node.Children[index]
+		}
+
+		node.Id = t.id
+		node.Count = len(books)
+	}
+
+	for i := range root.Children {
+		b.countTagNode(&root.Children[i], scope)
+	}
+
+	return root.Children
+}
+
+func (b *BookEntries) countTagNode(node *TagNode, scope Scope) {
+	node.Total = len(scope.filter(b.tagBooks(tagKey(node.FullName), true)))
+
+	for i := range node.Children {
+		b.countTagNode(&node.Children[i], scope)
+	}
+}
+
+// TagTree returns the tag hierarchy with per-level counts of the books in
+// scope. Total counts each book once even when it has several tags below
+// the same level. Trees of scopes LibraryScope made are built once per
+// snapshot and shared, so callers must not modify them.
+func (b *BookEntries) TagTree(scope Scope) []TagNode {
+	if scope.books != nil && scope.key == "" {
+		return b.buildTagTree(scope)
+	}
+
+	if tree, found := b.tagTrees.Load(scope.key); found {
+		return tree.([]TagNode)
+	}
+
+	tree := b.buildTagTree(scope)
+	b.tagTrees.Store(scope.key, tree)
+
+	return tree
+}
+
+// TagCloud lists tags in name order with a weight between 1 and 5 growing
+// logarithmically with the number of books in scope.
+func (b *BookEntries) TagCloud(scope Scope) []TagCloudEntry {
+	cloud := make([]TagCloudEntry, 0, len(b.tags))
+	counts := make([]int, len(b.tags))
+	most := 1
+
+	for i, t := range b.tags {
+		counts[i] = len(scope.filter(t.books))
+		most = max(most, counts[i])
+	}
+
+	for _, i := range b.tagOrder {
+		t := b.tags[i]
+
+		if counts[i] == 0 {
+			continue
+		}
+
+		scale := math.Log1p(float64(counts[i])) / math.Log1p(float64(most))
+		cloud = append(cloud, TagCloudEntry{
+			Id:    t.id,
+			Name:  t.name,
+			Count: counts[i],
+			Weight: minTagCloudWeight + int(math.Round(
+				scale*(maxTagCloudWeight-minTagCloudWeight),
+			)),
+		})
+	}
+
+	return cloud
+}
+
+// TagDetails lists the books with a tag, optionally including books tagged
+// with any of its descendants. Only books in scope are listed.
+func (b *BookEntries) TagDetails(
+	tagId int64,
+	descendants bool,
+	scope Scope,
+) (details TagDetails, found bool) {
+	position, found := b.tagIds[tagId]
+	if !found {
+		return details, false
+	}
+
+	t := b.tags[position]
+	books := b.tagBooks(t.key, descendants)
+	scoped := scope.filter(books)
+
+	// A tag whose books are all out of scope, e.g. denied to the user, is
+	// not found, so its name does not show either.
+	if len(scoped) == 0 && len(books) > 0 {
+		return details, false
+	}
+
+	return TagDetails{
+		Id:                  t.id,
+		Name:                t.name,
+		IncludesDescendants: descendants,
+		Books:               b.selectIds(b.sortByTitle(scoped)),
+	}, true
+}
+
+func (b *BookEntries) bookTagsOf(entryId BookEntryId) []BookTag {
+	positions := b.bookTags[entryId]
+	bookTags := make([]BookTag, len(positions))
+
+	for i, position := range positions {
+		bookTags[i] = BookTag{Id: b.tags[position].id, Name: b.tags[position].name}
+	}
+
+	return bookTags
+}
+
+// tagFilter selects books with a tag, and with its descendants when the
+// query ends in ".*", e.g. tag:Fiction.Fantasy.*.
+type tagFilter struct {
+	key         string
+	descendants bool
+}
+
+func (f tagFilter) selectIds(entries *BookEntries, _ context.Context) bookIdSet {
+	set := newBookIdSet(entries.NumBooks())
+
+	for _, id := range entries.tagBooks(f.key, f.descendants) {
+		set.add(id)
+	}
+
+	return set
+}
+
+func parseTagFilter(value string, _ time.Time) (queryFilter, error) {
+	name, descendants := strings.CutSuffix(value, descendantsSuffix)
+
+	return tagFilter{key: tagKey(name), descendants: descendants}, nil
+}
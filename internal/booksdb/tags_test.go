@@ -0,0 +1,119 @@
+package booksdb
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestTagBooksDescendants(t *testing.T) {
+	entries := &BookEntries{tags: []tag{
+		{key: "fiction", books: []BookEntryId{0}},
+		{key: "fiction fantasy", books: []BookEntryId{1}},
+		{key: "fiction-noir", books: []BookEntryId{2}},
+		{key: "fiction.fantasy", books: []BookEntryId{3, 4}},
+		{key: "fiction.fantasy.epic", books: []BookEntryId{4, 5}},
+		{key: "fictional", books: []BookEntryId{6}},
+	}}
+
+	tagCases := []struct {
+		key         string
+		descendants bool
+		want        []BookEntryId
+	}{
+		{"fiction", false, []BookEntryId{0}},
+		{"fiction", true, []BookEntryId{0, 3, 4, 5}},
+		{"fiction.fantasy", true, []BookEntryId{3, 4, 5}},
+		{"fiction.fantasy.epic", true, []BookEntryId{4, 5}},
+		{"science", true, nil},
+	}
+
+	for _, tc := range tagCases {
+		got := entries.tagBooks(tc.key, tc.descendants)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf(
+				"tagBooks(%q, %v) = %v, want %v",
+				tc.key, tc.descendants, got, tc.want,
+			)
+		}
+	}
+}
+
+// newTagTestEntries completes the tags of newCalibreTestEntries, which
+// already come in key order.
+func newTagTestEntries() *BookEntries {
+	entries := newCalibreTestEntries()
+	entries.libraryQueries = map[string]string{"Discworld": "series:discworld"}
+	entries.searchKeys = newSortKeys(language.Und)
+
+	entries.tagIds = make(map[int64]int, len(entries.tags))
+
+	for position := range entries.tags {
+		entries.tags[position].id = int64(position + 1)
+		entries.tagIds[int64(position+1)] = position
+		entries.tags[position].key = tagKey(entries.tags[position].name)
+		entries.tagOrder = append(entries.tagOrder, position)
+	}
+
+	for id, positions := range entries.bookTags {
+		for _, position := range positions {
+			t := &entries.tags[position]
+			t.books = append(t.books, BookEntryId(id))
+		}
+	}
+
+	for _, book := range entries.books {
+		entries.titleKeys = append(
+			entries.titleKeys,
+			entries.searchKeys.key(book.Title),
+		)
+	}
+
+	return entries
+}
+
+func TestTagTreeCachedPerScope(t *testing.T) {
+	entries := newTagTestEntries()
+
+	whole, err := entries.LibraryScope("", context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discworld, err := entries.LibraryScope("Discworld", context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree := entries.TagTree(whole)
+	if again := entries.TagTree(whole); &again[0] != &tree[0] {
+		t.Error("the tag tree of the library was built again")
+	}
+
+	// Neither Discworld book is marked read.
+	if got := entries.TagTree(discworld); len(got) != 2 ||
+		got[0].Total != 1 || got[1].Total != 1 {
+		t.Errorf("TagTree(Discworld) = %+v, want Fiction and Humor once", got)
+	}
+}
+
+func TestTagDetailsSortedByTitle(t *testing.T) {
+	entries := newTagTestEntries()
+
+	details, found := entries.TagDetails(1, true, Scope{})
+	if !found {
+		t.Fatal("TagDetails did not find Fiction")
+	}
+
+	titles := make([]string, len(details.Books))
+	for i, book := range details.Books {
+		titles[i] = book.Title
+	}
+
+	want := []string{"Guards! Guards!", "The Hobbit", "White Teeth"}
+	if !slices.Equal(titles, want) {
+		t.Errorf("TagDetails books = %q, want %q", titles, want)
+	}
+}
@@ -0,0 +1,154 @@
+package booksdb
+
+import (
+	"strings"
+	"unicode"
+)
+
+// cyrillicLatin spells Russian letters the BGN/PCGN way, which is what
+// readers type, e.g. "Булгаков" as "bulgakov" and "щука" as "shchuka".
+// Soft and hard signs are dropped.
+var cyrillicLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	// Ukrainian and Belarusian letters Russian lacks
+	'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "w",
+	// Serbian and Macedonian letters
+	'ђ': "dj", 'ј': "j", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz",
+	'ѓ': "gj", 'ќ': "kj", 'ѕ': "dz",
+}
+
+// ukrainianLatin overrides the Russian spelling of letters Ukrainian
+// pronounces differently, in words with a letter only Ukrainian uses.
+var ukrainianLatin = map[rune]string{'г': "h", 'и': "y"}
+
+// greekLatin spells Greek letters after ELOT 743, which BGN/PCGN follows,
+// e.g. "Ὀδύσσεια" as "odysseia".
+var greekLatin = map[rune]string{
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+	// letters with a diaeresis are never part of a digraph
+	'ϊ': "i", 'ΐ': "i", 'ϋ': "y", 'ΰ': "y",
+}
+
+// greekBase strips the accents and breathings of Greek letters, so
+// polytonic titles are spelled like monotonic ones.
+var greekBase = map[rune]rune{
+	'ά': 'α', 'έ': 'ε', 'ή': 'η', 'ί': 'ι', 'ό': 'ο', 'ύ': 'υ', 'ώ': 'ω',
+}
+
+// greekExtended maps the ranges of the Greek Extended block, whose letters
+// carry polytonic accents, to their base letters.
+var greekExtended = []struct {
+	first, last rune
+	base        rune
+}{
+	{0x1F00, 0x1F0F, 'α'}, {0x1F10, 0x1F1D, 'ε'}, {0x1F20, 0x1F2F, 'η'},
+	{0x1F30, 0x1F3F, 'ι'}, {0x1F40, 0x1F4D, 'ο'}, {0x1F50, 0x1F5F, 'υ'},
+	{0x1F60, 0x1F6F, 'ω'}, {0x1F70, 0x1F71, 'α'}, {0x1F72, 0x1F73, 'ε'},
+	{0x1F74, 0x1F75, 'η'}, {0x1F76, 0x1F77, 'ι'}, {0x1F78, 0x1F79, 'ο'},
+	{0x1F7A, 0x1F7B, 'υ'}, {0x1F7C, 0x1F7D, 'ω'}, {0x1F80, 0x1F8F, 'α'},
+	{0x1F90, 0x1F9F, 'η'}, {0x1FA0, 0x1FAF, 'ω'}, {0x1FB0, 0x1FBC, 'α'},
+	{0x1FC2, 0x1FC7, 'η'}, {0x1FC8, 0x1FC9, 'ε'}, {0x1FCA, 0x1FCC, 'η'},
+	{0x1FD0, 0x1FDB, 'ι'}, {0x1FE0, 0x1FE3, 'υ'}, {0x1FE4, 0x1FE5, 'ρ'},
+	{0x1FE6, 0x1FEB, 'υ'}, {0x1FEC, 0x1FEC, 'ρ'}, {0x1FF2, 0x1FF7, 'ω'},
+	{0x1FF8, 0x1FF9, 'ο'}, {0x1FFA, 0x1FFC, 'ω'},
+}
+
+func greekBaseLetter(r rune) rune {
+	if base, found := greekBase[r]; found {
+		return base
+	}
+
+	for _, block := range greekExtended {
+		if r >= block.first && r <= block.last {
+			return block.base
+		}
+	}
+
+	return r
+}
+
+func isTransliterated(r rune) bool {
+	return unicode.In(r, unicode.Cyrillic, unicode.Greek)
+}
+
+// transliterate spells the Cyrillic and Greek letters of a normalized word
+// or text in Latin, leaving everything else as it is. Text without such
+// letters is returned unchanged.
+func transliterate(text Word) Word {
+	if !strings.ContainsFunc(string(text), isTransliterated) {
+		return text
+	}
+
+	ukrainian := strings.ContainsAny(string(text), "іїєґ")
+	runes := []rune(string(text))
+
+	var result strings.Builder
+
+	result.Grow(len(text))
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		if spelling, found := ukrainianLatin[r]; found && ukrainian {
+			result.WriteString(spelling)
+
+			continue
+		}
+
+		if spelling, found := cyrillicLatin[r]; found {
+			result.WriteString(spelling)
+
+			continue
+		}
+
+		if _, found := greekLatin[r]; !found {
+			r = greekBaseLetter(r)
+		}
+
+		spelling, found := greekLatin[r]
+		if !found {
+			result.WriteRune(r)
+
+			continue
+		}
+
+		var next rune
+		if i+1 < len(runes) {
+			next = greekBaseLetter(runes[i+1])
+		}
+
+		switch {
+		case r == 'ο' && next == 'υ':
+			spelling, i = "ou", i+1
+		case (r == 'α' || r == 'ε' || r == 'η') && next == 'υ':
+			spelling, i = spelling+"v", i+1
+		case r == 'γ' && (next == 'γ' || next == 'ξ' || next == 'χ'):
+			spelling = "n"
+		}
+
+		result.WriteString(spelling)
+	}
+
+	return Word(result.String())
+}
+
+// wordForms returns a normalized word together with its Latin spelling,
+// if it has a different one, so words in either script find each other.
+func wordForms(word Word) []Word {
+	if latin := transliterate(word); latin != word {
+		return []Word{word, latin}
+	}
+
+	return []Word{word}
+}
@@ -0,0 +1,33 @@
+package booksdb
+
+import "testing"
+
+func TestTransliterate(t *testing.T) {
+	transliterateCases := []struct {
+		text string
+		want Word
+	}{
+		{"Булгаков", "bulgakov"},
+		{"Мастер и Маргарита", "master i margarita"},
+		{"Щедрин", "shchedrin"},
+		{"Чехов", "chekhov"},
+		{"Пьеса", "pesa"},
+		{"Юрий", "yuriy"},
+		{"Київ", "kyyiv"},
+		{"Гоголь", "gogol"},
+		{"Григорій", "hryhoriy"},
+		{"Ὀδύσσεια", "odysseia"},
+		{"Ομήρου", "omirou"},
+		{"Ευριπίδης", "evripidis"},
+		{"Άγγελος", "angelos"},
+		{"Καΐκι", "kaiki"},
+		{"Tolkien", "tolkien"},
+		{"Łódź", "lodz"},
+	}
+
+	for _, tc := range transliterateCases {
+		if got := transliterate(normalizeWord(tc.text)); got != tc.want {
+			t.Errorf("transliterate(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	var registry Registry
+
+	requests := registry.NewCounter(
+		"requests_total",
+		"Requests served.",
+		"route",
+		"code",
+	)
+	latency := registry.NewHistogram(
+		"latency_seconds",
+		"Request latency.",
+		[]float64{0.1, 1},
+		"route",
+	)
+	registry.NewGaugeFunc("books", "Books in the library.", func() float64 {
+		return 42
+	})
+
+	requests.Inc("GET /book/{id}", "200")
+	requests.Inc("GET /book/{id}", "200")
+	requests.Inc(`GET /"quoted"`, "404")
+	latency.Observe(0.05, "GET /")
+	latency.Observe(0.5, "GET /")
+	latency.Observe(3, "GET /")
+
+	var output strings.Builder
+	if err := registry.Write(&output); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="GET /\"quoted\"",code="404"} 1
+requests_total{route="GET /book/{id}",code="200"} 2
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="GET /",le="0.1"} 1
+latency_seconds_bucket{route="GET /",le="1"} 2
+latency_seconds_bucket{route="GET /",le="+Inf"} 3
+latency_seconds_sum{route="GET /"} 3.55
+latency_seconds_count{route="GET /"} 3
+# HELP books Books in the library.
+# TYPE books gauge
+books 42
+`
+
+	if got := output.String(); got != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	var registry Registry
+
+	counter := registry.NewCounter("errors_total", "Errors.", "kind")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() without label values did not panic")
+		}
+	}()
+
+	counter.Inc()
+}
@@ -17,17 +17,19 @@ SELECT
     author_sort AS authors,
     timestamp AS added_at,
     last_modified AS modified_at,
+    pubdate AS published_at,
     path
 FROM books
 `
 
 type BookEntryRow struct {
-	ID         uint16    `json:"id"`
-	Title      string    `json:"title"`
-	Authors    string    `json:"authors"`
-	AddedAt    time.Time `json:"added_at"`
-	ModifiedAt time.Time `json:"modified_at"`
-	Path       string    `json:"path"`
+	ID          uint16    `json:"id"`
+	Title       string    `json:"title"`
+	Authors     string    `json:"authors"`
+	AddedAt     time.Time `json:"added_at"`
+	ModifiedAt  time.Time `json:"modified_at"`
+	PublishedAt time.Time `json:"published_at"`
+	Path        string    `json:"path"`
 }
 
 func (q *Queries) BookEntry(ctx context.Context) ([]BookEntryRow, error) {
@@ -45,6 +47,7 @@ func (q *Queries) BookEntry(ctx context.Context) ([]BookEntryRow, error) {
 			&i.Authors,
 			&i.AddedAt,
 			&i.ModifiedAt,
+			&i.PublishedAt,
 			&i.Path,
 		); err != nil {
 			return nil, err
@@ -24,19 +24,131 @@ func New(db DBTX) *Queries {
 func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	q := Queries{db: db}
 	var err error
+	if q.allAuthorsStmt, err = db.PrepareContext(ctx, allAuthors); err != nil {
+		return nil, fmt.Errorf("error preparing query AllAuthors: %w", err)
+	}
+	if q.allSeriesStmt, err = db.PrepareContext(ctx, allSeries); err != nil {
+		return nil, fmt.Errorf("error preparing query AllSeries: %w", err)
+	}
+	if q.allTagsStmt, err = db.PrepareContext(ctx, allTags); err != nil {
+		return nil, fmt.Errorf("error preparing query AllTags: %w", err)
+	}
+	if q.bookAuthorsStmt, err = db.PrepareContext(ctx, bookAuthors); err != nil {
+		return nil, fmt.Errorf("error preparing query BookAuthors: %w", err)
+	}
+	if q.bookCommentsStmt, err = db.PrepareContext(ctx, bookComments); err != nil {
+		return nil, fmt.Errorf("error preparing query BookComments: %w", err)
+	}
 	if q.bookEntryStmt, err = db.PrepareContext(ctx, bookEntry); err != nil {
 		return nil, fmt.Errorf("error preparing query BookEntry: %w", err)
 	}
+	if q.bookFormatsStmt, err = db.PrepareContext(ctx, bookFormats); err != nil {
+		return nil, fmt.Errorf("error preparing query BookFormats: %w", err)
+	}
+	if q.bookIdentifiersStmt, err = db.PrepareContext(ctx, bookIdentifiers); err != nil {
+		return nil, fmt.Errorf("error preparing query BookIdentifiers: %w", err)
+	}
+	if q.bookLanguagesStmt, err = db.PrepareContext(ctx, bookLanguages); err != nil {
+		return nil, fmt.Errorf("error preparing query BookLanguages: %w", err)
+	}
+	if q.bookPublishersStmt, err = db.PrepareContext(ctx, bookPublishers); err != nil {
+		return nil, fmt.Errorf("error preparing query BookPublishers: %w", err)
+	}
+	if q.bookRatingsStmt, err = db.PrepareContext(ctx, bookRatings); err != nil {
+		return nil, fmt.Errorf("error preparing query BookRatings: %w", err)
+	}
+	if q.bookSeriesStmt, err = db.PrepareContext(ctx, bookSeries); err != nil {
+		return nil, fmt.Errorf("error preparing query BookSeries: %w", err)
+	}
+	if q.bookTagsStmt, err = db.PrepareContext(ctx, bookTags); err != nil {
+		return nil, fmt.Errorf("error preparing query BookTags: %w", err)
+	}
+	if q.customColumnsStmt, err = db.PrepareContext(ctx, customColumns); err != nil {
+		return nil, fmt.Errorf("error preparing query CustomColumns: %w", err)
+	}
+	if q.preferenceStmt, err = db.PrepareContext(ctx, preference); err != nil {
+		return nil, fmt.Errorf("error preparing query Preference: %w", err)
+	}
 	return &q, nil
 }
 
 func (q *Queries) Close() error {
 	var err error
+	if q.allAuthorsStmt != nil {
+		if cerr := q.allAuthorsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing allAuthorsStmt: %w", cerr)
+		}
+	}
+	if q.allSeriesStmt != nil {
+		if cerr := q.allSeriesStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing allSeriesStmt: %w", cerr)
+		}
+	}
+	if q.allTagsStmt != nil {
+		if cerr := q.allTagsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing allTagsStmt: %w", cerr)
+		}
+	}
+	if q.bookAuthorsStmt != nil {
+		if cerr := q.bookAuthorsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing bookAuthorsStmt: %w", cerr)
+		}
+	}
+	if q.bookCommentsStmt != nil {
+		if cerr := q.bookCommentsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing bookCommentsStmt: %w", cerr)
+		}
+	}
 	if q.bookEntryStmt != nil {
 		if cerr := q.bookEntryStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing bookEntryStmt: %w", cerr)
 		}
 	}
+	if q.bookFormatsStmt != nil {
+		if cerr := q.bookFormatsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing bookFormatsStmt: %w", cerr)
+		}
+	}
+	if q.bookIdentifiersStmt != nil {
+		if cerr := q.bookIdentifiersStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing bookIdentifiersStmt: %w", cerr)
+		}
+	}
+	if q.bookLanguagesStmt != nil {
+		if cerr := q.bookLanguagesStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing bookLanguagesStmt: %w", cerr)
+		}
+	}
+	if q.bookPublishersStmt != nil {
+		if cerr := q.bookPublishersStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing bookPublishersStmt: %w", cerr)
+		}
+	}
+	if q.bookRatingsStmt != nil {
+		if cerr := q.bookRatingsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing bookRatingsStmt: %w", cerr)
+		}
+	}
+	if q.bookSeriesStmt != nil {
+		if cerr := q.bookSeriesStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing bookSeriesStmt: %w", cerr)
+		}
+	}
+	if q.bookTagsStmt != nil {
+		if cerr := q.bookTagsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing bookTagsStmt: %w", cerr)
+		}
+	}
+	if q.customColumnsStmt != nil {
+		if cerr := q.customColumnsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing customColumnsStmt: %w", cerr)
+		}
+	}
+	if q.preferenceStmt != nil {
+		if cerr := q.preferenceStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing preferenceStmt: %w", cerr)
+		}
+	}
 	return err
 }
 
@@ -74,15 +186,43 @@ func (q *Queries) queryRow(ctx context.Context, stmt *sql.Stmt, query string, ar
 }
 
 type Queries struct {
-	db            DBTX
-	tx            *sql.Tx
-	bookEntryStmt *sql.Stmt
+	db                  DBTX
+	tx                  *sql.Tx
+	allAuthorsStmt      *sql.Stmt
+	allSeriesStmt       *sql.Stmt
+	allTagsStmt         *sql.Stmt
+	bookAuthorsStmt     *sql.Stmt
+	bookCommentsStmt    *sql.Stmt
+	bookEntryStmt       *sql.Stmt
+	bookFormatsStmt     *sql.Stmt
+	bookIdentifiersStmt *sql.Stmt
+	bookLanguagesStmt   *sql.Stmt
+	bookPublishersStmt  *sql.Stmt
+	bookRatingsStmt     *sql.Stmt
+	bookSeriesStmt      *sql.Stmt
+	bookTagsStmt        *sql.Stmt
+	customColumnsStmt   *sql.Stmt
+	preferenceStmt      *sql.Stmt
 }
 
 func (q *Queries) WithTx(tx *sql.Tx) *Queries {
 	return &Queries{
-		db:            tx,
-		tx:            tx,
-		bookEntryStmt: q.bookEntryStmt,
+		db:                  tx,
+		tx:                  tx,
+		allAuthorsStmt:      q.allAuthorsStmt,
+		allSeriesStmt:       q.allSeriesStmt,
+		allTagsStmt:         q.allTagsStmt,
+		bookAuthorsStmt:     q.bookAuthorsStmt,
+		bookCommentsStmt:    q.bookCommentsStmt,
+		bookEntryStmt:       q.bookEntryStmt,
+		bookFormatsStmt:     q.bookFormatsStmt,
+		bookIdentifiersStmt: q.bookIdentifiersStmt,
+		bookLanguagesStmt:   q.bookLanguagesStmt,
+		bookPublishersStmt:  q.bookPublishersStmt,
+		bookRatingsStmt:     q.bookRatingsStmt,
+		bookSeriesStmt:      q.bookSeriesStmt,
+		bookTagsStmt:        q.bookTagsStmt,
+		customColumnsStmt:   q.customColumnsStmt,
+		preferenceStmt:      q.preferenceStmt,
 	}
 }
@@ -9,6 +9,13 @@ import (
 	"time"
 )
 
+type Author struct {
+	ID   int64          `json:"id"`
+	Name string         `json:"name"`
+	Sort sql.NullString `json:"sort"`
+	Link string         `json:"link"`
+}
+
 type Book struct {
 	ID           uint16         `json:"id"`
 	Title        string         `json:"title"`
@@ -25,3 +32,111 @@ type Book struct {
 	HasCover     sql.NullBool   `json:"has_cover"`
 	LastModified time.Time      `json:"last_modified"`
 }
+
+type BooksAuthorsLink struct {
+	ID     int64 `json:"id"`
+	Book   int64 `json:"book"`
+	Author int64 `json:"author"`
+}
+
+type BooksLanguagesLink struct {
+	ID        int64 `json:"id"`
+	Book      int64 `json:"book"`
+	LangCode  int64 `json:"lang_code"`
+	ItemOrder int64 `json:"item_order"`
+}
+
+type BooksPublishersLink struct {
+	ID        int64 `json:"id"`
+	Book      int64 `json:"book"`
+	Publisher int64 `json:"publisher"`
+}
+
+type BooksRatingsLink struct {
+	ID     int64 `json:"id"`
+	Book   int64 `json:"book"`
+	Rating int64 `json:"rating"`
+}
+
+type BooksSeriesLink struct {
+	ID     int64 `json:"id"`
+	Book   int64 `json:"book"`
+	Series int64 `json:"series"`
+}
+
+type BooksTagsLink struct {
+	ID   int64 `json:"id"`
+	Book int64 `json:"book"`
+	Tag  int64 `json:"tag"`
+}
+
+type Comment struct {
+	ID   int64  `json:"id"`
+	Book int64  `json:"book"`
+	Text string `json:"text"`
+}
+
+type CustomColumn struct {
+	ID            int64  `json:"id"`
+	Label         string `json:"label"`
+	Name          string `json:"name"`
+	Datatype      string `json:"datatype"`
+	MarkForDelete bool   `json:"mark_for_delete"`
+	Editable      bool   `json:"editable"`
+	Display       string `json:"display"`
+	IsMultiple    bool   `json:"is_multiple"`
+	Normalized    bool   `json:"normalized"`
+}
+
+type Datum struct {
+	ID               int64  `json:"id"`
+	Book             int64  `json:"book"`
+	Format           string `json:"format"`
+	UncompressedSize int64  `json:"uncompressed_size"`
+	Name             string `json:"name"`
+}
+
+type Identifier struct {
+	ID   int64  `json:"id"`
+	Book int64  `json:"book"`
+	Type string `json:"type"`
+	Val  string `json:"val"`
+}
+
+type Language struct {
+	ID       int64  `json:"id"`
+	LangCode string `json:"lang_code"`
+	Link     string `json:"link"`
+}
+
+type Preference struct {
+	ID  int64  `json:"id"`
+	Key string `json:"key"`
+	Val string `json:"val"`
+}
+
+type Publisher struct {
+	ID   int64          `json:"id"`
+	Name string         `json:"name"`
+	Sort sql.NullString `json:"sort"`
+	Link string         `json:"link"`
+}
+
+type Rating struct {
+	ID     int64         `json:"id"`
+	Rating sql.NullInt64 `json:"rating"`
+	Link   string        `json:"link"`
+}
+
+type Series struct {
+	ID   int64          `json:"id"`
+	Name string         `json:"name"`
+	Sort sql.NullString `json:"sort"`
+	Link string         `json:"link"`
+}
+
+type Tag struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Link string `json:"link"`
+}
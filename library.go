@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/url"
+
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+const (
+	libraryCookie       = "library"
+	libraryCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// pageScope returns the virtual library selected with the library switcher,
+// within what the user may see. A cookie naming a library that no longer
+// exists shows the whole library.
+func pageScope(entries *booksdb.BookEntries, r *http.Request) booksdb.Scope {
+	var name string
+
+	if cookie, err := r.Cookie(libraryCookie); err == nil {
+		name, _ = url.QueryUnescape(cookie.Value)
+	}
+
+	scope, err := entries.LibraryScope(name, r.Context())
+	if err != nil {
+		scope, _ = entries.LibraryScope("", r.Context())
+	}
+
+	return scope
+}
+
+// createLibrarySwitcherHandler renders the virtual library selector loaded
+// into every page, which keeps the pre-rendered search page cacheable.
+func createLibrarySwitcherHandler(templates fs.FS) http.HandlerFunc {
+	tmpl := parsePage(templates, "library.html")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries := booksdb.GetBooksEntries()
+		visible, _ := entries.LibraryScope("", r.Context())
+
+		executePage(w, r, tmpl, struct {
+			Libraries []booksdb.NamedSearch
+			Current   string
+		}{
+			Libraries: entries.CountIn(
+				entries.VirtualLibraries(r.Context()),
+				visible,
+			),
+			Current: pageScope(entries, r).Library,
+		})
+	}
+}
+
+// createSelectLibraryHandler stores the chosen virtual library in a cookie,
+// escaped as names may hold any character, and sends the browser back to the page it came from.
+func createSelectLibraryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.FormValue("library")
+
+		if _, err := booksdb.GetBooksEntries().LibraryScope(
+			name,
+			r.Context(),
+		); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		cookie := &http.Cookie{
+			Name:     libraryCookie,
+			Value:    url.QueryEscape(name),
+			Path:     "/",
+			MaxAge:   libraryCookieMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+
+		if name == "" {
+			cookie.MaxAge = -1
+		}
+
+		http.SetCookie(w, cookie)
+
+		target := "/"
+		if referer, err := url.Parse(r.Referer()); err == nil &&
+			referer.Host == r.Host && referer.Path != "" {
+			target = referer.RequestURI()
+		}
+
+		http.Redirect(w, r, target, http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grzadr/calibre-browser/internal/arguments"
+)
+
+const (
+	configDirName = "calibre-browser"
+	// selfSignedValidity is how long a generated certificate lasts; it is
+	// created again once expired.
+	selfSignedValidity = 2 * 365 * 24 * time.Hour
+	httpsPort          = 443
+	// readHeaderTimeout drops clients that never finish their request
+	// headers.
+	readHeaderTimeout = 10 * time.Second
+)
+
+// listen opens the Unix socket or TCP address the server accepts
+// connections on. A socket left behind by an earlier run is replaced, but
+// not one another server still accepts connections on.
+func listen(conf arguments.Config) (net.Listener, error) {
+	if conf.SocketPath == "" {
+		return net.Listen(
+			"tcp",
+			net.JoinHostPort(conf.Addr, strconv.Itoa(conf.Port)),
+		)
+	}
+
+	if info, err := os.Stat(conf.SocketPath); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf(
+				"%q exists and is not a socket",
+				conf.SocketPath,
+			)
+		}
+
+		if conn, err := net.Dial("unix", conf.SocketPath); err == nil {
+			conn.Close()
+
+			return nil, fmt.Errorf("%q is in use", conf.SocketPath)
+		}
+
+		if err := os.Remove(conf.SocketPath); err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %w", err)
+		}
+	}
+
+	return net.Listen("unix", conf.SocketPath)
+}
+
+// tlsPaths returns where the certificate and key are, defaulting to the
+// user config directory for self-signed ones so they survive cache
+// cleanups and clients can keep trusting them.
+func tlsPaths(conf arguments.Config) (certPath, keyPath string, err error) {
+	if conf.TlsCertPath != "" {
+		return conf.TlsCertPath, conf.TlsKeyPath, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", "", fmt.Errorf("error locating config directory: %w", err)
+	}
+
+	dir = filepath.Join(dir, configDirName)
+
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), nil
+}
+
+// newTlsConfig loads the certificate HTTPS is served with, creating a
+// self-signed one when asked to and there is no valid one yet. It returns
+// nil when TLS is off.
+func newTlsConfig(conf arguments.Config) (*tls.Config, error) {
+	if !conf.Tls() {
+		return nil, nil
+	}
+
+	certPath, keyPath, err := tlsPaths(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+
+	if conf.TlsSelfSigned &&
+		(errors.Is(err, fs.ErrNotExist) || err == nil && expired(certificate)) {
+		if err := createSelfSigned(certPath, keyPath); err != nil {
+			return nil, fmt.Errorf("error creating certificate: %w", err)
+		}
+
+		certificate, err = tls.LoadX509KeyPair(certPath, keyPath)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error loading certificate: %w", err)
+	}
+
+	slog.Info(
+		"serving HTTPS",
+		"certificate", certPath,
+		"sha256", fmt.Sprintf("%x", sha256.Sum256(certificate.Certificate[0])),
+	)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func expired(certificate tls.Certificate) bool {
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+
+	return err != nil || time.Now().After(leaf.NotAfter)
+}
+
+// lanNames lists the names and addresses the server is reachable by on a
+// local network: localhost, the host name and every interface address.
+func lanNames() (names []string, ips []net.IP) {
+	names = []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		names = append(names, hostname)
+	}
+
+	ips = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return names, ips
+	}
+
+	for _, addr := range addrs {
+		if network, ok := addr.(*net.IPNet); ok && !network.IP.IsLoopback() {
+			ips = append(ips, network.IP)
+		}
+	}
+
+	return names, ips
+}
+
+// createSelfSigned writes a self-signed ECDSA certificate for the LAN names
+// of this host and its private key, readable by the owner only.
+func createSelfSigned(certPath, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	names, ips := lanNames()
+	now := time.Now()
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: names[len(names)-1]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              names,
+		IPAddresses:           ips,
+	}
+
+	der, err := x509.CreateCertificate(
+		rand.Reader,
+		template,
+		template,
+		&key.PublicKey,
+		key,
+	)
+	if err != nil {
+		return err
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range []string{certPath, keyPath} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(
+		keyPath,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}),
+		0o600,
+	); err != nil {
+		return err
+	}
+
+	slog.Info(
+		"created self-signed certificate",
+		"certificate", certPath,
+		"names", names,
+		"ips", ips,
+	)
+
+	return os.WriteFile(
+		certPath,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		0o644,
+	)
+}
+
+// newRedirectServer returns the server sending plain HTTP requests on the
+// redirect port to HTTPS.
+func newRedirectServer(conf arguments.Config) *http.Server {
+	return &http.Server{
+		Addr: net.JoinHostPort(
+			conf.Addr,
+			strconv.Itoa(conf.RedirectPort),
+		),
+		Handler:           createRedirectHandler(conf.Port),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+}
+
+// serveRedirect listens on the redirect port until server is shut down.
+func serveRedirect(server *http.Server) {
+	slog.Info("redirecting HTTP to HTTPS", "addr", server.Addr)
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fatal("error serving redirects", err)
+	}
+}
+
+// createRedirectHandler sends plain HTTP requests to the same URL over
+// HTTPS on port.
+func createRedirectHandler(port int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+
+		authority := net.JoinHostPort(host, strconv.Itoa(port))
+		if port == httpsPort {
+			authority = strings.TrimSuffix(authority, ":"+strconv.Itoa(port))
+		}
+
+		target := "https://" + authority + r.URL.RequestURI()
+
+		// 308 keeps the method, so htmx posts survive the redirect.
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	}
+}
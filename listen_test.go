@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/grzadr/calibre-browser/internal/arguments"
+)
+
+func TestListenSocket(t *testing.T) {
+	// Socket paths are limited to about a hundred bytes, too few for
+	// t.TempDir on some systems.
+	dir, err := os.MkdirTemp("", "listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := arguments.Config{SocketPath: filepath.Join(dir, "web.sock")}
+
+	live, err := listen(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := listen(conf); err == nil {
+		t.Error("listen() replaced a socket in use")
+	}
+
+	// A listener closed without unlinking leaves its socket behind, as
+	// a server that crashed does.
+	live.(*net.UnixListener).SetUnlinkOnClose(false)
+	live.Close()
+
+	stale, err := listen(conf)
+	if err != nil {
+		t.Fatalf("listen() did not replace a stale socket: %v", err)
+	}
+	stale.Close()
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := listen(arguments.Config{SocketPath: file}); err == nil {
+		t.Error("listen() replaced a file that is not a socket")
+	}
+}
+
+func TestCreateRedirectHandler(t *testing.T) {
+	redirectCases := []struct {
+		host string
+		port int
+		want string
+	}{
+		{"example.com:8080", 8443, "https://example.com:8443/books?q=x"},
+		{"example.com", 443, "https://example.com/books?q=x"},
+		{"example.com:80", 443, "https://example.com/books?q=x"},
+		{"[::1]:8080", 8443, "https://[::1]:8443/books?q=x"},
+		{"[::1]", 443, "https://[::1]/books?q=x"},
+	}
+
+	for _, tc := range redirectCases {
+		r := httptest.NewRequest(http.MethodPost, "/books?q=x", nil)
+		r.Host = tc.host
+		w := httptest.NewRecorder()
+
+		createRedirectHandler(tc.port)(w, r)
+
+		if w.Code != http.StatusPermanentRedirect ||
+			w.Header().Get("Location") != tc.want {
+			t.Errorf(
+				"redirect of %s to port %d = %d %q, want %q",
+				tc.host, tc.port, w.Code, w.Header().Get("Location"), tc.want,
+			)
+		}
+	}
+}
+
+func TestCreateSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls", "cert.pem")
+	keyPath := filepath.Join(dir, "tls", "key.pem")
+
+	if err := createSelfSigned(certPath, keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expired(certificate) {
+		t.Error("new certificate has expired")
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(leaf.DNSNames, "localhost") ||
+		!slices.ContainsFunc(leaf.IPAddresses, net.IP.IsLoopback) {
+		t.Errorf(
+			"certificate names = %v %v, want localhost",
+			leaf.DNSNames, leaf.IPAddresses,
+		)
+	}
+
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("key mode = %v, want 0600", info.Mode().Perm())
+	}
+}
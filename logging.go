@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/grzadr/calibre-browser/internal/arguments"
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+const (
+	requestIdHeader = "X-Request-ID"
+	// maxRequestIdLength bounds the IDs taken from clients, which end up in
+	// every log line of their requests.
+	maxRequestIdLength = 128
+)
+
+// newLogger returns the logger writing to stderr in the configured format
+// and level.
+func newLogger(conf arguments.Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(conf.LogLevel)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", conf.LogLevel, err)
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	switch conf.LogFormat {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, options)), nil
+	}
+
+	return nil, fmt.Errorf(
+		"invalid log format %q: expected text or json",
+		conf.LogFormat,
+	)
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// validRequestId accepts IDs of printable ASCII without spaces, so clients
+// cannot forge log lines with them.
+func validRequestId(id string) bool {
+	return id != "" && len(id) <= maxRequestIdLength &&
+		!strings.ContainsFunc(id, func(r rune) bool { return r <= ' ' || r > '~' })
+}
+
+// requestId returns the ID the client or a proxy gave the request, or a
+// new one.
+func requestId(r *http.Request) string {
+	if id := r.Header.Get(requestIdHeader); validRequestId(id) {
+		return id
+	}
+
+	return rand.Text()
+}
+
+// logRequests tags each request with an ID, echoed in the response, and
+// hands handlers a logger carrying it. Requests are logged once served.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		id := requestId(r)
+		w.Header().Set(requestIdHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(
+			recorder,
+			r.WithContext(booksdb.ContextWithLogger(r.Context(), logger)),
+		)
+
+		logger.Info(
+			"request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.code(),
+			"bytes", recorder.bytes,
+			"duration", time.Since(started),
+		)
+	})
+}
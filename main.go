@@ -5,17 +5,19 @@ import (
 	"context"
 	"crypto/sha256"
 	"embed"
+	"errors"
 	"fmt"
+	"html/template"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
-	"text/template"
+	"sync/atomic"
 	"time"
 
 	"github.com/grzadr/calibre-browser/internal/arguments"
+	"github.com/grzadr/calibre-browser/internal/auth"
 	"github.com/grzadr/calibre-browser/internal/booksdb"
 )
 
@@ -25,66 +27,133 @@ var staticFiles embed.FS
 //go:embed templates/*
 var templateFiles embed.FS
 
-func createSearchHandler() http.HandlerFunc {
+func createSearchHandler(templates fs.FS) http.HandlerFunc {
 	// 1. Parse template at startup (happens once)
-	search := template.Must(template.ParseFS(templateFiles,
-		"templates/search-results.html"))
+	search := template.Must(template.New("search-results.html").
+		Funcs(pageFuncs).ParseFS(templates,
+		"layout.html", "search-results.html")).
+		Lookup("search-results.html")
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		// 2. Get search query
+		// 2. Get search query, its syntax and the saved search picked next
+		// to it
 		query := r.FormValue("search")
 
 		entries := booksdb.GetBooksEntries()
 
-		// 3. Perform search
-		args := strings.Fields(query)
-		results, _ := booksdb.SelectEntriesByTitleCommand(entries, args)
+		// 3. Perform search within the selected virtual library, inside
+		// the books' text too when asked to
+		content, _ := strconv.ParseBool(r.FormValue("content"))
 
-		log.Println("search completed")
+		results, err := searchBooks(entries, query, r.Context(), booksdb.SearchOptions{
+			Scope:   pageScope(entries, r),
+			Syntax:  booksdb.NewQuerySyntax(r.FormValue("syntax")),
+			Saved:   r.FormValue("saved"),
+			Content: content,
+		})
+
+		data := struct {
+			booksdb.SearchResults
+
+			Error string
+		}{SearchResults: results}
+
+		if err != nil {
+			booksdb.Logger(r.Context()).Warn("search error", "error", err)
+			data.Error = err.Error()
+		}
 
 		// 4. Execute template with results
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 		// THIS IS WHERE WE USE tmpl! ↓↓↓
-		err := search.Execute(w, results)
-
-		log.Println("search template executed")
+		err = search.Execute(w, data)
 		//     ^^^^^^^^^^^^^
 		// Converts Go data → HTML using template
 		if err != nil {
-			log.Printf("template error: %v", err)
+			booksdb.Logger(r.Context()).Error("template error", "error", err)
 		}
 	}
 }
 
-func createIndexHandler() http.HandlerFunc {
-	// Parse template once at startup
-	tmpl := template.Must(template.ParseFS(templateFiles,
-		"templates/index.html"))
+// indexPage is the data of the search page.
+type indexPage struct {
+	Title         string
+	BookCount     int
+	SavedSearches []booksdb.NamedSearch
+	ContentSearch bool
+	Generated     time.Time // Added for the footer
+}
 
-	// Pre-render template with initial data
-	var buf bytes.Buffer
+func newIndexPage(
+	entries *booksdb.BookEntries,
+	scope booksdb.Scope,
+	ctx context.Context,
+) indexPage {
+	return indexPage{
+		Title:     "Book Search",
+		BookCount: entries.NumBooksIn(scope),
+		SavedSearches: entries.CountIn(
+			entries.SavedSearches(ctx),
+			scope,
+		),
+		ContentSearch: entries.HasContent(),
+		Generated:     time.Now(),
+	}
+}
 
-	entries := booksdb.GetBooksEntries()
+// renderedIndex is the index page as anyone allowed every book sees it,
+// rendered for one library snapshot on one day.
+type renderedIndex struct {
+	entries *booksdb.BookEntries
+	day     string
+	content []byte
+	etag    string
+}
 
-	initialData := struct {
-		Title     string
-		BookCount int
-		Generated time.Time // Added for the footer
-	}{
-		Title:     "Book Search",
-		BookCount: entries.NumBooks(),
-		Generated: time.Now(), // Server startup time
+func renderIndex(
+	tmpl *template.Template,
+	entries *booksdb.BookEntries,
+	day string,
+) (*renderedIndex, error) {
+	var buf bytes.Buffer
+
+	if err := tmpl.Execute(&buf, newIndexPage(
+		entries,
+		booksdb.Scope{},
+		context.Background(),
+	)); err != nil {
+		return nil, fmt.Errorf("failed to render index template: %w", err)
 	}
 
-	if err := tmpl.Execute(&buf, initialData); err != nil {
-		log.Fatal("Failed to pre-render index template:", err)
+	return &renderedIndex{
+		entries: entries,
+		day:     day,
+		content: buf.Bytes(),
+		etag:    fmt.Sprintf(`"%x"`, sha256.Sum256(buf.Bytes())),
+	}, nil
+}
+
+func createIndexHandler(templates fs.FS) http.HandlerFunc {
+	// Parse template once at startup
+	tmpl := template.Must(template.New("index.html").Funcs(pageFuncs).
+		ParseFS(templates, "index.html"))
+
+	// The page is rendered again once the library is refreshed or saved
+	// searches are evaluated for a new day; rendering it now fails a
+	// broken template early.
+	var rendered atomic.Pointer[renderedIndex]
+
+	initial, err := renderIndex(
+		tmpl,
+		booksdb.GetBooksEntries(),
+		time.Now().Format(time.DateOnly),
+	)
+	if err != nil {
+		panic(err)
 	}
 
-	// Pre-calculate values for efficiency
-	content := buf.Bytes()
-	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(content))
-	contentLength := strconv.Itoa(len(content))
+	rendered.Store(initial)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
@@ -93,63 +162,263 @@ func createIndexHandler() http.HandlerFunc {
 			return
 		}
 
+		entries := booksdb.GetBooksEntries()
+
+		// Restricted users only see the counts of the books they may see.
+		if len(booksdb.RestrictionFrom(r.Context())) > 0 {
+			scope, _ := entries.LibraryScope("", r.Context())
+
+			w.Header().Set("Cache-Control", "private, no-cache")
+			executePage(w, r, tmpl, newIndexPage(entries, scope, r.Context()))
+
+			return
+		}
+
+		day := time.Now().Format(time.DateOnly)
+
+		page := rendered.Load()
+		if page.entries != entries || page.day != day {
+			fresh, err := renderIndex(tmpl, entries, day)
+			if err != nil {
+				booksdb.Logger(r.Context()).Error("template error", "error", err)
+				http.Error(w, "template error", http.StatusInternalServerError)
+
+				return
+			}
+
+			rendered.Store(fresh)
+			page = fresh
+		}
+
 		// Set headers
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Header().Set("ETag", etag)
-		w.Header().Set("Cache-Control", "public, max-age=3600") // 1 hour
-		w.Header().Set("Content-Length", contentLength)
+		w.Header().Set("ETag", page.etag)
+		// Shared caches may only keep it when no login is required.
+		if userStore != nil {
+			w.Header().Set("Cache-Control", "private, max-age=3600")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=3600") // 1 hour
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(page.content)))
 
 		// Check if client has cached version
-		if match := r.Header.Get("If-None-Match"); match == etag {
+		if match := r.Header.Get("If-None-Match"); match == page.etag {
 			w.WriteHeader(http.StatusNotModified)
 
 			return
 		}
 
-		w.Write(content)
+		w.Write(page.content)
 	}
 }
 
-func setupRoutes() *http.ServeMux {
+// setupRoutes sets up the handlers, parsing their templates from
+// templates.
+func setupRoutes(templates fs.FS) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// Method-based routing (Go 1.22+)
-	mux.HandleFunc("GET /", createIndexHandler())
-	mux.HandleFunc("POST /search", createSearchHandler())
+	mux.HandleFunc("GET /", createIndexHandler(templates))
+	mux.HandleFunc("POST /search", createSearchHandler(templates))
+	mux.HandleFunc("GET /book/{id}", createBookHandler(templates))
+	mux.HandleFunc("GET /isbn/{isbn}", createIsbnHandler())
+	mux.HandleFunc("GET /authors", createAuthorIndexHandler(templates))
+	mux.HandleFunc("GET /author/{id}", createAuthorHandler(templates))
+	mux.HandleFunc("GET /series", createSeriesIndexHandler(templates))
+	mux.HandleFunc("GET /series/{id}", createSeriesHandler(templates))
+	mux.HandleFunc("GET /tags", createTagIndexHandler(templates))
+	mux.HandleFunc("GET /tag/{id}", createTagHandler(templates))
+	mux.HandleFunc("GET /library", createLibrarySwitcherHandler(templates))
+	mux.HandleFunc("POST /library", createSelectLibraryHandler())
+	mux.HandleFunc("GET /api/search", createApiSearchHandler())
+	mux.HandleFunc("GET /api/book/{id}", createApiBookHandler())
+	mux.HandleFunc("GET /api/custom-columns", createApiCustomColumnsHandler())
+	mux.HandleFunc("GET /api/libraries", createApiLibrariesHandler())
+	mux.HandleFunc("GET /api/content-index", createApiContentIndexHandler())
+
+	if userStore != nil {
+		mux.HandleFunc("GET /login", createLoginPageHandler(templates))
+		mux.HandleFunc("POST /login", createLoginHandler(templates))
+		mux.HandleFunc("POST /logout", createLogoutHandler())
+	}
+
+	setupProbes(mux)
 
-	// FIX: Use fs.Sub to serve from the static subdirectory
-	staticFS, err := fs.Sub(staticFiles, "static")
+	assets, err := staticAssets()
 	if err != nil {
-		log.Fatal("Failed to create static sub-filesystem:", err)
+		panic(err)
 	}
 
-	mux.Handle("GET /static/", http.StripPrefix("/static/",
-		http.FileServerFS(staticFS)))
+	mux.Handle("GET "+assetsPrefix, assets)
 
 	return mux
 }
 
+func repositoryOptions(
+	conf arguments.Config,
+) (options booksdb.RepositoryOptions, err error) {
+	backend, err := booksdb.NewSearchBackend(conf.SearchBackend)
+	if err != nil {
+		return options, err
+	}
+
+	locale, err := booksdb.ParseLocale(conf.Locale)
+	if err != nil {
+		return options, err
+	}
+
+	return booksdb.RepositoryOptions{
+		SearchBackend: backend,
+		CacheDir:      conf.CacheDir,
+		IndexWorkers:  conf.IndexWorkers,
+		Locale:        locale,
+		SynonymsPath:  conf.SynonymsPath,
+	}, nil
+}
+
+// configCheckArgs strips the "config check" command off the arguments,
+// reporting whether it was given.
+func configCheckArgs(args []string) ([]string, bool) {
+	if len(args) > 2 && args[1] == "config" && args[2] == "check" {
+		return append([]string{args[0]}, args[3:]...), true
+	}
+
+	return args, false
+}
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	conf, err := arguments.ParseArgsServer(os.Args)
+	if args, ok := usersArgs(os.Args); ok {
+		if err := runUsers(args, ctx); err != nil {
+			fatal("error managing users", err)
+		}
+
+		return
+	}
+
+	args, check := configCheckArgs(os.Args)
+
+	conf, err := arguments.ParseArgsServer(args)
+	if err != nil {
+		fatal("error parsing args", err)
+	}
+
+	options, err := repositoryOptions(conf)
+	if err != nil {
+		fatal("error parsing args", err)
+	}
+
+	logger, err := newLogger(conf)
 	if err != nil {
-		log.Fatalln(fmt.Errorf("error parsing args: %w", err))
+		fatal("error parsing args", err)
+	}
+
+	slog.SetDefault(logger)
+
+	if conf.ConfigPath != "" {
+		slog.Info("read config", "path", conf.ConfigPath)
+	}
+
+	// config check prints the effective settings instead of serving.
+	if check {
+		if err := conf.WriteSettings(os.Stdout); err != nil {
+			fatal("error printing config", err)
+		}
+
+		return
+	}
+
+	// Pages cannot work without their scripts, so a build missing any
+	// does not start.
+	if _, err := staticAssets(); err != nil {
+		fatal("error loading static files", err)
+	}
+
+	if conf.Auth {
+		userStore, err = auth.OpenStore(conf.UsersDbPath, ctx)
+		if err != nil {
+			fatal("error opening users db", err)
+		}
+
+		defer userStore.Close()
 	}
 
-	if err := booksdb.PopulateBooksRepository(conf.DbPath, ctx); err != nil {
-		log.Fatalf("error initializng database %q: %s\n", conf.DbPath, err)
+	// Until the library is loaded only the probes answer, so orchestrators
+	// can tell a slow start from a dead process.
+	probes := http.NewServeMux()
+	setupProbes(probes)
+
+	handler := &routes{}
+	handler.mux.Store(probes)
+
+	go func() {
+		if err := booksdb.PopulateBooksRepository(
+			conf.DbPath,
+			ctx,
+			options,
+		); err != nil {
+			fatal("error initializing database", err)
+		}
+
+		// The index page is rendered with the library, once it is loaded.
+		mux, err := loadRoutes(conf)
+		if err != nil {
+			fatal("error loading routes", err)
+		}
+
+		// A reload may already have swapped newer routes in.
+		handler.mux.CompareAndSwap(probes, mux)
+	}()
+
+	tlsConfig, err := newTlsConfig(conf)
+	if err != nil {
+		fatal("error configuring TLS", err)
 	}
 
-	mux := setupRoutes()
+	listener, err := listen(conf)
+	if err != nil {
+		fatal("error listening", err)
+	}
 
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+		Handler: logRequests(
+			instrument(securityHeaders(requireLogin(handler))),
+		),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: readHeaderTimeout,
 		// Each connection gets its own goroutine automatically
 	}
 
-	// This single ListenAndServe handles thousands of concurrent connections
-	server.ListenAndServe()
+	servers := []*http.Server{server}
+
+	if conf.RedirectPort != 0 {
+		redirect := newRedirectServer(conf)
+		servers = append(servers, redirect)
+
+		go serveRedirect(redirect)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		handleSignals(args, conf, handler, ctx, servers...)
+	}()
+
+	slog.Info("listening", "addr", listener.Addr().String())
+
+	if tlsConfig != nil {
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		fatal("error serving", err)
+	}
+
+	// Serve returns as soon as shutdown begins; wait for requests in flight.
+	<-done
 }
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+	"github.com/grzadr/calibre-browser/internal/metrics"
+)
+
+const (
+	metricsPrefix = "calibre_browser_"
+	// readyTimeout bounds how long /readyz waits for the database.
+	readyTimeout = 2 * time.Second
+)
+
+// resultBuckets are upper bounds of the number of books a search finds.
+var resultBuckets = []float64{0, 1, 5, 10, 25, 50, 100, 250, 500, 1000, 5000}
+
+// registry holds the metrics of the process. They outlive reloads, which
+// replace the routes but not the counts.
+var registry metrics.Registry
+
+var (
+	requestsTotal = registry.NewCounter(
+		metricsPrefix+"http_requests_total",
+		"HTTP requests served, by route and status code.",
+		"route",
+		"code",
+	)
+	requestDuration = registry.NewHistogram(
+		metricsPrefix+"http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by route.",
+		metrics.DefaultBuckets,
+		"route",
+	)
+	searchDuration = registry.NewHistogram(
+		metricsPrefix+"search_duration_seconds",
+		"Time taken to search the library.",
+		metrics.DefaultBuckets,
+	)
+	searchResults = registry.NewHistogram(
+		metricsPrefix+"search_results",
+		"Books found by successful searches.",
+		resultBuckets,
+	)
+	searchErrors = registry.NewCounter(
+		metricsPrefix+"search_errors_total",
+		"Searches failing, e.g. on invalid queries.",
+	)
+)
+
+func init() {
+	registry.NewGaugeFunc(
+		metricsPrefix+"books",
+		"Books in the library.",
+		func() float64 { return float64(booksdb.GetIndexStatus().Books) },
+	)
+	registry.NewGaugeFunc(
+		metricsPrefix+"index_words",
+		"Distinct words indexed in titles and descriptions.",
+		func() float64 { return float64(booksdb.GetIndexStatus().Words) },
+	)
+	registry.NewGaugeFunc(
+		metricsPrefix+"index_generation",
+		"Times the library was loaded since startup.",
+		func() float64 { return float64(booksdb.GetIndexStatus().Generation) },
+	)
+	registry.NewGaugeFunc(
+		metricsPrefix+"index_refresh_timestamp_seconds",
+		"Unix time the library was last loaded, zero if never.",
+		func() float64 {
+			return unixSeconds(booksdb.GetIndexStatus().RefreshedAt)
+		},
+	)
+	registry.NewGaugeFunc(
+		metricsPrefix+"index_refresh_failed",
+		"Whether the latest attempt to load the library failed.",
+		func() float64 {
+			if booksdb.GetIndexStatus().LastError != nil {
+				return 1
+			}
+
+			return 0
+		},
+	)
+	registry.NewGaugeFunc(
+		metricsPrefix+"index_refresh_error_timestamp_seconds",
+		"Unix time loading the library last failed, zero if never.",
+		func() float64 {
+			return unixSeconds(booksdb.GetIndexStatus().LastErrorAt)
+		},
+	)
+}
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// searchBooks searches entries, recording how long it took and how many
+// books it found.
+func searchBooks(
+	entries *booksdb.BookEntries,
+	query string,
+	ctx context.Context,
+	options booksdb.SearchOptions,
+) (booksdb.SearchResults, error) {
+	started := time.Now()
+	results, err := entries.Search(query, ctx, options)
+
+	searchDuration.Observe(time.Since(started).Seconds())
+
+	if err != nil {
+		searchErrors.Inc()
+	} else {
+		searchResults.Observe(float64(len(results.Books)))
+	}
+
+	return results, err
+}
+
+// statusRecorder remembers the status code a handler responds with and
+// how many bytes of body it writes.
+type statusRecorder struct {
+	http.ResponseWriter
+
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	written, err := r.ResponseWriter.Write(data)
+	r.bytes += written
+
+	return written, err
+}
+
+// code returns the status code sent, which is 200 when the handler wrote
+// nothing.
+func (r *statusRecorder) code() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+
+	return r.status
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// patternKey holds the route a request matched. Handlers between
+// instrument and the routes, such as requireLogin, pass copies of the
+// request on, so the pattern the mux sets does not reach instrument.
+type patternKey struct{}
+
+// recordPattern tells instrument the route a request matched.
+func recordPattern(r *http.Request) {
+	if pattern, ok := r.Context().Value(patternKey{}).(*string); ok {
+		*pattern = r.Pattern
+	}
+}
+
+// instrument counts the requests next serves and times them, by the route
+// pattern the ServeMux matched so ids in paths do not multiply the series.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		pattern := new(string)
+
+		next.ServeHTTP(
+			recorder,
+			r.WithContext(context.WithValue(r.Context(), patternKey{}, pattern)),
+		)
+
+		route := *pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		requestsTotal.Inc(route, strconv.Itoa(recorder.code()))
+		requestDuration.Observe(time.Since(started).Seconds(), route)
+	})
+}
+
+// setupProbes adds the endpoints of health checks and metrics, which work
+// before the library is loaded.
+func setupProbes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", createHealthHandler())
+	mux.HandleFunc("GET /readyz", createReadyHandler())
+	mux.HandleFunc("GET /metrics", createMetricsHandler())
+}
+
+// createHealthHandler reports the process is alive.
+func createHealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok\n"))
+	}
+}
+
+// createReadyHandler reports whether the library is loaded and its
+// database reachable, so requests can be sent to this instance.
+func createReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		if err := booksdb.Ping(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.Write([]byte("ok\n"))
+	}
+}
+
+func createMetricsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		if err := registry.Write(w); err != nil {
+			booksdb.Logger(r.Context()).Error("error writing metrics", "error", err)
+		}
+	}
+}
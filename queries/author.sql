@@ -0,0 +1,13 @@
+-- name: AllAuthors :many
+SELECT
+    id,
+    name,
+    sort
+FROM authors;
+
+-- name: BookAuthors :many
+SELECT
+    book,
+    author
+FROM books_authors_link
+ORDER BY id;
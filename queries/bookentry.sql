@@ -5,5 +5,6 @@ SELECT
     author_sort AS authors,
     timestamp AS added_at,
     last_modified AS modified_at,
+    pubdate AS published_at,
     path
 FROM books;
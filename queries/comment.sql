@@ -0,0 +1,5 @@
+-- name: BookComments :many
+SELECT
+    book,
+    text
+FROM comments;
@@ -0,0 +1,11 @@
+-- name: CustomColumns :many
+SELECT
+    id,
+    label,
+    name,
+    datatype,
+    is_multiple,
+    normalized
+FROM custom_columns
+WHERE mark_for_delete = 0
+ORDER BY id;
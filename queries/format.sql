@@ -0,0 +1,8 @@
+-- name: BookFormats :many
+SELECT
+    book,
+    format,
+    uncompressed_size,
+    name
+FROM data
+ORDER BY book, format;
@@ -0,0 +1,13 @@
+-- name: BookIdentifiers :many
+SELECT
+    book,
+    type,
+    val
+FROM identifiers
+UNION ALL
+SELECT
+    id AS book,
+    'isbn' AS type,
+    isbn AS val
+FROM books
+WHERE isbn != '';
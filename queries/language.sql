@@ -0,0 +1,7 @@
+-- name: BookLanguages :many
+SELECT
+    link.book,
+    languages.lang_code
+FROM books_languages_link AS link
+JOIN languages ON languages.id = link.lang_code
+ORDER BY link.book, link.item_order;
@@ -0,0 +1,4 @@
+-- name: Preference :one
+SELECT val
+FROM preferences
+WHERE key = ?;
@@ -0,0 +1,6 @@
+-- name: BookPublishers :many
+SELECT
+    link.book,
+    publishers.name
+FROM books_publishers_link AS link
+JOIN publishers ON publishers.id = link.publisher;
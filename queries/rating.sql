@@ -0,0 +1,7 @@
+-- name: BookRatings :many
+SELECT
+    link.book,
+    ratings.rating
+FROM books_ratings_link AS link
+JOIN ratings ON ratings.id = link.rating
+WHERE ratings.rating IS NOT NULL;
@@ -0,0 +1,14 @@
+-- name: AllSeries :many
+SELECT
+    id,
+    name,
+    sort
+FROM series;
+
+-- name: BookSeries :many
+SELECT
+    link.book,
+    link.series,
+    books.series_index
+FROM books_series_link AS link
+JOIN books ON books.id = link.book;
@@ -0,0 +1,11 @@
+-- name: AllTags :many
+SELECT
+    id,
+    name
+FROM tags;
+
+-- name: BookTags :many
+SELECT
+    book,
+    tag
+FROM books_tags_link;
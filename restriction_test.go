@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/grzadr/calibre-browser/internal/auth"
+)
+
+// newRestrictedTestServer serves the test library to a user only allowed
+// books tagged Kids, which leaves out the malicious book.
+func newRestrictedTestServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	handler := newLoginTestServer(t)
+
+	if err := userStore.AddRule(
+		testUser,
+		auth.Rule{Allow: true, Field: "tag", Value: "kids"},
+		context.Background(),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	return handler
+}
+
+func TestRestrictedPages(t *testing.T) {
+	handler := newRestrictedTestServer(t)
+
+	pageCases := []struct {
+		path   string
+		status int
+	}{
+		{"/", http.StatusOK},
+		{"/book/1", http.StatusNotFound},
+		{"/book/2", http.StatusOK},
+		{"/isbn/9780261102217", http.StatusNotFound},
+		{"/authors", http.StatusOK},
+		{"/author/1", http.StatusNotFound},
+		{"/author/2", http.StatusOK},
+		{"/series", http.StatusOK},
+		{"/series/1", http.StatusNotFound},
+		{"/tags", http.StatusOK},
+		{"/tag/1", http.StatusNotFound},
+		{"/tag/2", http.StatusOK},
+		{"/library", http.StatusOK},
+		{"/api/search?q=hack", http.StatusOK},
+		{"/api/search?q=title:hack&syntax=calibre", http.StatusOK},
+		{"/api/book/1", http.StatusNotFound},
+		{"/api/book/2", http.StatusOK},
+		{"/api/libraries", http.StatusOK},
+	}
+
+	for _, tc := range pageCases {
+		r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		r.SetBasicAuth(testUser, testPassword)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tc.status {
+			t.Errorf("GET %s: status %d, want %d", tc.path, w.Code, tc.status)
+		}
+
+		assertNothingRestricted(t, "GET "+tc.path, w.Body.String())
+	}
+}
+
+func TestRestrictedSearch(t *testing.T) {
+	handler := newRestrictedTestServer(t)
+	session, csrf := logIn(t, handler)
+
+	// "hakc" would be corrected to "hack" if the suggestion looked at
+	// every book.
+	for _, query := range []string{"hack", "hakc", "eve", ""} {
+		r := postForm("/search", url.Values{"search": {query}})
+		r.AddCookie(session)
+		r.Header.Set(csrfHeader, csrf.Value)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("POST /search %q: status %d", query, w.Code)
+		}
+
+		assertNothingRestricted(t, "POST /search "+query, w.Body.String())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(session)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if !strings.Contains(w.Body.String(), "Search across 1 books") {
+		t.Error("search page counts restricted books")
+	}
+}
+
+// assertNothingRestricted fails when a response names the restricted book,
+// its author, tag or series, escaped or not.
+func assertNothingRestricted(t *testing.T, request, body string) {
+	t.Helper()
+
+	for _, restricted := range []string{
+		"Hack",
+		"hack</",
+		"Eve",
+		"onerror",
+		"/book/1\"",
+		`"id":1,`,
+	} {
+		if strings.Contains(body, restricted) {
+			t.Errorf("%s: body contains %q", request, restricted)
+		}
+	}
+}
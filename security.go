@@ -0,0 +1,30 @@
+package main
+
+import "net/http"
+
+// contentSecurityPolicy only lets pages load scripts, styles and data from
+// this server, and forbids inline scripts, eval and framing. Metadata that
+// slips past escaping still cannot run.
+const contentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self'; " +
+	"style-src 'self'; " +
+	"img-src 'self' data:; " +
+	"object-src 'none'; " +
+	"base-uri 'none'; " +
+	"form-action 'self'; " +
+	"frame-ancestors 'none'"
+
+// securityHeaders sets the headers hardening every response against
+// injected scripts, MIME sniffing, leaking URLs and clickjacking.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("Content-Security-Policy", contentSecurityPolicy)
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", "same-origin")
+		// frame-ancestors for browsers predating it
+		header.Set("X-Frame-Options", "DENY")
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grzadr/calibre-browser/internal/arguments"
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+// maliciousLibrary is a library whose metadata tries to inject scripts
+// into every page it shows up on.
+var maliciousLibrary = []string{
+	`INSERT INTO books (id, title, sort, timestamp, pubdate, author_sort,
+		isbn, lccn, path, last_modified) VALUES (
+		1, '<script>alert(1)</script> Hack', 'Hack',
+		'2021-01-01 10:00:00+00:00', '2020-01-01 00:00:00+00:00',
+		'Eve', '', '', 'Eve/Hack (1)', '2021-01-01 10:00:00+00:00')`,
+	`INSERT INTO authors (id, name, sort) VALUES
+		(1, '<b>Eve</b>', 'Eve')`,
+	`INSERT INTO books_authors_link (book, author) VALUES (1, 1)`,
+	`INSERT INTO tags (id, name) VALUES
+		(1, '<img src=x onerror=alert(2)>')`,
+	`INSERT INTO books_tags_link (book, tag) VALUES (1, 1)`,
+	// Descriptions are shown with their tags stripped and entities
+	// decoded, so this one reads as a script.
+	`INSERT INTO comments (book, text) VALUES
+		(1, '<p>&lt;script&gt;alert(4)&lt;/script&gt;</p>')`,
+	`INSERT INTO preferences (key, val) VALUES ('saved_searches',
+		'{"\"><script>alert(3)</script>": "title:hack"}')`,
+}
+
+// kidsBook is a harmless book next to the malicious one, for a user only
+// allowed books tagged Kids. The malicious book is also the only one in
+// a series, with an ISBN and in Polish.
+var kidsBook = []string{
+	`INSERT INTO books (id, title, sort, timestamp, pubdate, author_sort,
+		isbn, lccn, path, last_modified) VALUES (
+		2, 'Picture Book', 'Picture Book',
+		'2021-01-01 10:00:00+00:00', '2020-01-01 00:00:00+00:00',
+		'Kim', '', '', 'Kim/Picture Book (2)', '2021-01-01 10:00:00+00:00')`,
+	`INSERT INTO authors (id, name, sort) VALUES (2, 'Kim', 'Kim')`,
+	`INSERT INTO books_authors_link (book, author) VALUES (2, 2)`,
+	`INSERT INTO tags (id, name) VALUES (2, 'Kids')`,
+	`INSERT INTO books_tags_link (book, tag) VALUES (2, 2)`,
+	`INSERT INTO series (id, name, sort) VALUES (1, 'Hack Saga', 'Hack Saga')`,
+	`INSERT INTO books_series_link (book, series) VALUES (1, 1)`,
+	`INSERT INTO identifiers (book, type, val) VALUES
+		(1, 'isbn', '9780261102217')`,
+	`INSERT INTO languages (id, lang_code) VALUES (1, 'pol'), (2, 'eng')`,
+	`INSERT INTO books_languages_link (book, lang_code) VALUES
+		(1, 1), (2, 2)`,
+}
+
+// testLibraryDir holds the test library and its caches.
+var testLibraryDir string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "calibre-browser-test")
+	if err != nil {
+		panic(err)
+	}
+
+	testLibraryDir = dir
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+var openTestLibrary = sync.OnceValue(func() error {
+	dir := testLibraryDir
+	dbPath := filepath.Join(dir, "metadata.db")
+
+	schema, err := os.ReadFile("schemas/schemas.sql")
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	for _, statement := range slices.Concat(
+		[]string{string(schema)},
+		maliciousLibrary,
+		kidsBook,
+	) {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return booksdb.PopulateBooksRepository(
+		dbPath,
+		context.Background(),
+		booksdb.RepositoryOptions{CacheDir: dir},
+	)
+})
+
+// newTestServer serves the malicious library with every middleware.
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	if err := openTestLibrary(); err != nil {
+		t.Fatal(err)
+	}
+
+	mux, err := loadRoutes(arguments.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return securityHeaders(mux)
+}
+
+func TestMaliciousMetadataIsEscaped(t *testing.T) {
+	handler := newTestServer(t)
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/", nil),
+		httptest.NewRequest(http.MethodGet, "/book/1", nil),
+		httptest.NewRequest(http.MethodGet, "/author/1", nil),
+		httptest.NewRequest(http.MethodGet, "/authors", nil),
+		httptest.NewRequest(http.MethodGet, "/tag/1", nil),
+		httptest.NewRequest(http.MethodGet, "/tags", nil),
+		httptest.NewRequest(http.MethodGet, "/api/search?q=hack", nil),
+	}
+
+	search := httptest.NewRequest(
+		http.MethodPost,
+		"/search",
+		strings.NewReader(url.Values{"search": {"hack"}}.Encode()),
+	)
+	search.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	requests = append(requests, search)
+
+	for _, r := range requests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		body := w.Body.String()
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s %s: status %d", r.Method, r.URL, w.Code)
+		}
+
+		for _, injected := range []string{
+			"<script>alert",
+			"<b>Eve</b>",
+			"<img src=x",
+		} {
+			if strings.Contains(body, injected) {
+				t.Errorf("%s %s: body contains %q", r.Method, r.URL, injected)
+			}
+		}
+	}
+}
+
+func TestMaliciousMetadataIsShownEscaped(t *testing.T) {
+	handler := newTestServer(t)
+
+	pageCases := []struct {
+		path string
+		want []string
+	}{
+		{"/", []string{`&#34;&gt;&lt;script&gt;alert(3)&lt;/script&gt;`}},
+		{"/book/1", []string{
+			"&lt;script&gt;alert(1)&lt;/script&gt; Hack",
+			"&lt;b&gt;Eve&lt;/b&gt;",
+			"&lt;script&gt;alert(4)&lt;/script&gt;",
+		}},
+		{"/tag/1", []string{"&lt;img src=x onerror=alert(2)&gt;"}},
+	}
+
+	for _, tc := range pageCases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+		for _, want := range tc.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("GET %s: body lacks %q", tc.path, want)
+			}
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	handler := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/book/1", nil))
+
+	headerCases := map[string]string{
+		"Content-Security-Policy": contentSecurityPolicy,
+		"X-Content-Type-Options":  "nosniff",
+		"Referrer-Policy":         "same-origin",
+		"X-Frame-Options":         "DENY",
+	}
+
+	for name, want := range headerCases {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("header %s = %q, want %q", name, got, want)
+		}
+	}
+
+	for _, directive := range []string{
+		"script-src 'self'",
+		"frame-ancestors 'none'",
+	} {
+		if !strings.Contains(contentSecurityPolicy, directive) {
+			t.Errorf("Content-Security-Policy lacks %q", directive)
+		}
+	}
+}
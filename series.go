@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+func createSeriesIndexHandler(templates fs.FS) http.HandlerFunc {
+	tmpl := parsePage(templates, "series-index.html")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries := booksdb.GetBooksEntries()
+
+		executePage(w, r, tmpl, entries.SeriesList(pageScope(entries, r)))
+	}
+}
+
+func createSeriesHandler(templates fs.FS) http.HandlerFunc {
+	tmpl := parsePage(templates, "series.html")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		seriesId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		entries := booksdb.GetBooksEntries()
+
+		details, found := entries.SeriesDetails(
+			seriesId,
+			pageScope(entries, r),
+		)
+		if !found {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		executePage(w, r, tmpl, details)
+	}
+}
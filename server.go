@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/grzadr/calibre-browser/internal/arguments"
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+// shutdownTimeout bounds how long requests in flight may take to finish
+// once the server is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
+// routes serves the current routes, which a reload swaps without closing
+// any connection.
+type routes struct {
+	mux atomic.Pointer[http.ServeMux]
+}
+
+func (r *routes) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.Load().ServeHTTP(w, req)
+	recordPattern(req)
+}
+
+// loadRoutes parses the templates, built-in or from the configured
+// directory, and sets up the handlers using them.
+func loadRoutes(conf arguments.Config) (mux *http.ServeMux, err error) {
+	templates, err := fs.Sub(templateFiles, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.TemplatesDir != "" {
+		templates = os.DirFS(conf.TemplatesDir)
+	}
+
+	// Handlers parse their templates with template.Must, which panics on
+	// a broken template; a reload must fail without stopping the server.
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("error parsing templates: %v", recovered)
+		}
+	}()
+
+	return setupRoutes(templates), nil
+}
+
+// restartRequired reports the settings that only change on restart.
+func restartRequired(current, next arguments.Config) []string {
+	var names []string
+
+	if current.DbPath != next.DbPath {
+		names = append(names, "db")
+	}
+
+	if current.Addr != next.Addr || current.Port != next.Port ||
+		current.SocketPath != next.SocketPath {
+		names = append(names, "listen address")
+	}
+
+	if current.Tls() != next.Tls() || current.TlsCertPath != next.TlsCertPath ||
+		current.TlsKeyPath != next.TlsKeyPath ||
+		current.RedirectPort != next.RedirectPort {
+		names = append(names, "TLS")
+	}
+
+	if current.CacheDir != next.CacheDir ||
+		current.IndexWorkers != next.IndexWorkers {
+		names = append(names, "indexing")
+	}
+
+	if current.Auth != next.Auth || current.UsersDbPath != next.UsersDbPath {
+		names = append(names, "auth")
+	}
+
+	return names
+}
+
+// reload reads the configuration again, then the library and the
+// templates, and swaps the new routes in. On error the server keeps
+// running as it was.
+func reload(
+	args []string,
+	current arguments.Config,
+	handler *routes,
+	ctx context.Context,
+) (arguments.Config, error) {
+	conf, err := arguments.ParseArgsServer(args)
+	if err != nil {
+		return current, fmt.Errorf("error parsing config: %w", err)
+	}
+
+	options, err := repositoryOptions(conf)
+	if err != nil {
+		return current, fmt.Errorf("error parsing config: %w", err)
+	}
+
+	logger, err := newLogger(conf)
+	if err != nil {
+		return current, fmt.Errorf("error parsing config: %w", err)
+	}
+
+	if names := restartRequired(current, conf); len(names) > 0 {
+		slog.Warn("changes take effect on restart", "settings", names)
+	}
+
+	mux, err := loadRoutes(conf)
+	if err != nil {
+		return current, err
+	}
+
+	if err := booksdb.ReloadBooksRepository(options, ctx); err != nil {
+		return current, err
+	}
+
+	handler.mux.Store(mux)
+	slog.SetDefault(logger)
+
+	if conf.ConfigPath != "" {
+		slog.Info("read config", "path", conf.ConfigPath)
+	}
+
+	return conf, nil
+}
+
+// handleSignals reloads on SIGHUP and shuts the servers down gracefully on
+// SIGINT or SIGTERM, letting requests in flight finish. It returns once
+// they have.
+func handleSignals(
+	args []string,
+	conf arguments.Config,
+	handler *routes,
+	ctx context.Context,
+	servers ...*http.Server,
+) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			slog.Info("received SIGHUP, reloading")
+
+			started := time.Now()
+
+			var err error
+			if conf, err = reload(args, conf, handler, ctx); err != nil {
+				slog.Error("reload failed, keeping the previous state", "error", err)
+			} else {
+				slog.Info("reloaded", "duration", time.Since(started))
+			}
+
+			continue
+		}
+
+		slog.Info("initiating graceful shutdown", "signal", sig)
+		signal.Stop(signals)
+
+		break
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); errors.Is(err, context.DeadlineExceeded) {
+			slog.Warn("timeout reached, closing remaining connections")
+			server.Close()
+		} else if err != nil {
+			slog.Error("error shutting down", "error", err)
+		}
+	}
+
+	slog.Info("all connections closed")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+// execTestLibrary runs statement on the test library and reloads it.
+func execTestLibrary(t *testing.T, statement string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(testLibraryDir, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec(statement); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := booksdb.ReloadBooksRepository(
+		booksdb.RepositoryOptions{},
+		context.Background(),
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexFollowsReload(t *testing.T) {
+	handler := newTestServer(t)
+
+	bookCount := func() string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		body := w.Body.String()
+		if _, after, found := strings.Cut(body, "• "); found {
+			count, _, _ := strings.Cut(after, " books")
+
+			return count
+		}
+
+		return body
+	}
+
+	if got := bookCount(); got != "2" {
+		t.Fatalf("index before reload shows %q books, want 2", got)
+	}
+
+	execTestLibrary(t, `INSERT INTO books (id, title, sort, timestamp,
+		pubdate, author_sort, isbn, lccn, path, last_modified) VALUES (
+		3, 'New Book', 'New Book',
+		'2021-01-01 10:00:00+00:00', '2020-01-01 00:00:00+00:00',
+		'Kim', '', '', 'Kim/New Book (3)', '2021-01-01 10:00:00+00:00')`)
+	t.Cleanup(func() { execTestLibrary(t, `DELETE FROM books WHERE id = 3`) })
+
+	if got := bookCount(); got != "3" {
+		t.Errorf("index after reload shows %q books, want 3", got)
+	}
+}
@@ -0,0 +1,28 @@
+// Sends the CSRF token of the session with every request changing
+// something: in a header for htmx, in a field for plain forms.
+function csrfToken() {
+    const cookie = document.cookie
+        .split("; ")
+        .find((pair) => pair.startsWith("csrf_token="));
+
+    return cookie ? decodeURIComponent(cookie.slice("csrf_token=".length)) : "";
+}
+
+document.addEventListener("htmx:configRequest", (event) => {
+    if (event.detail.verb !== "get") {
+        event.detail.headers["X-CSRF-Token"] = csrfToken();
+    }
+});
+
+document.addEventListener("submit", (event) => {
+    const form = event.target;
+    if (form.method !== "post" || form.elements.csrf_token) {
+        return;
+    }
+
+    const field = document.createElement("input");
+    field.type = "hidden";
+    field.name = "csrf_token";
+    field.value = csrfToken();
+    form.append(field);
+});
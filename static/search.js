@@ -0,0 +1,23 @@
+// Runs a "Did you mean" suggestion by putting it into the search box,
+// which then searches as if it had been typed.
+document.addEventListener("click", (event) => {
+    const link = event.target.closest("a[data-suggestion]");
+    if (!link) {
+        return;
+    }
+
+    event.preventDefault();
+
+    const input = document.querySelector(".search-input");
+    input.value = link.dataset.suggestion;
+    htmx.trigger(input, "input");
+});
+
+// Searches at once on Enter, without waiting for the typing delay. htmx
+// trigger filters would do this too, but they need eval, which the
+// Content-Security-Policy forbids.
+document.addEventListener("keyup", (event) => {
+    if (event.key === "Enter" && event.target.matches(".search-input")) {
+        htmx.trigger(event.target, "enter");
+    }
+});
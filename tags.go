@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+func createTagIndexHandler(templates fs.FS) http.HandlerFunc {
+	tmpl := parsePage(templates, "tags.html")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries := booksdb.GetBooksEntries()
+		scope := pageScope(entries, r)
+
+		executePage(w, r, tmpl, struct {
+			Cloud []booksdb.TagCloudEntry
+			Tree  []booksdb.TagNode
+		}{
+			Cloud: entries.TagCloud(scope),
+			Tree:  entries.TagTree(scope),
+		})
+	}
+}
+
+func createTagHandler(templates fs.FS) http.HandlerFunc {
+	tmpl := parsePage(templates, "tag.html")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		tagId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		descendants, _ := strconv.ParseBool(r.FormValue("descendants"))
+
+		entries := booksdb.GetBooksEntries()
+
+		details, found := entries.TagDetails(
+			tagId,
+			descendants,
+			pageScope(entries, r),
+		)
+		if !found {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		executePage(w, r, tmpl, details)
+	}
+}
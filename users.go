@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/grzadr/calibre-browser/internal/arguments"
+	"github.com/grzadr/calibre-browser/internal/auth"
+	"github.com/grzadr/calibre-browser/internal/booksdb"
+)
+
+var errUsersUsage = errors.New("usage: users [options] " +
+	"list | add|remove|reset|rules|clear <name> | " +
+	"allow|deny <name> tag|library|language <value>")
+
+// usersArity is the number of arguments of each users command.
+var usersArity = map[string]int{
+	"list":   0,
+	"add":    1,
+	"remove": 1,
+	"reset":  1,
+	"rules":  1,
+	"clear":  1,
+	"allow":  3,
+	"deny":   3,
+}
+
+// usersArgs strips the "users" command off the arguments, reporting
+// whether it was given.
+func usersArgs(args []string) ([]string, bool) {
+	if len(args) > 1 && args[1] == "users" {
+		return append([]string{args[0]}, args[2:]...), true
+	}
+
+	return args, false
+}
+
+// readPassword reads a password from the first line of in or, when in is a
+// terminal, which would echo it, generates one and prints it to out.
+func readPassword(in *os.File, out io.Writer) (string, error) {
+	if info, err := in.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		password := rand.Text()
+		fmt.Fprintf(out, "password: %s\n", password)
+
+		return password, nil
+	}
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("error reading password: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// runUsers manages the users allowed to log in and what they may see.
+func runUsers(args []string, ctx context.Context) error {
+	conf, rest, err := arguments.ParseArgsUsers(args)
+	if err != nil {
+		return err
+	}
+
+	if len(rest) == 0 {
+		return errUsersUsage
+	}
+
+	command, rest := rest[0], rest[1:]
+
+	if arity, found := usersArity[command]; !found || len(rest) != arity {
+		return errUsersUsage
+	}
+
+	store, err := auth.OpenStore(conf.UsersDbPath, ctx)
+	if err != nil {
+		return err
+	}
+
+	defer store.Close()
+
+	switch command {
+	case "list":
+		names, err := store.Users(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			fmt.Println(name)
+		}
+
+		return nil
+	case "remove":
+		return store.RemoveUser(rest[0], ctx)
+	case "add", "reset":
+		password, err := readPassword(os.Stdin, os.Stdout)
+		if err != nil {
+			return err
+		}
+
+		if command == "add" {
+			return store.AddUser(rest[0], password, ctx)
+		}
+
+		return store.ResetPassword(rest[0], password, ctx)
+	case "rules":
+		rules, err := store.Rules(rest[0], ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, rule := range rules {
+			fmt.Println(booksdb.Rule{
+				Allow: rule.Allow,
+				Field: booksdb.RuleField(rule.Field),
+				Value: rule.Value,
+			})
+		}
+
+		return nil
+	case "clear":
+		return store.ClearRules(rest[0], ctx)
+	case "allow", "deny":
+		// Checked here, as the users database does not know the library.
+		rule, err := booksdb.NewRule(command == "allow", rest[1], rest[2])
+		if err != nil {
+			return err
+		}
+
+		return store.AddRule(rest[0], auth.Rule{
+			Allow: rule.Allow,
+			Field: string(rule.Field),
+			Value: rule.Value,
+		}, ctx)
+	}
+
+	return errUsersUsage
+}